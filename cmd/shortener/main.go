@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/app"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/config"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
+	"github.com/Renal37/musthave_shortener_tpl.git/repository"
 	"log"
 	_ "net/http/pprof"
+	"strconv"
 )
 
 var (
@@ -39,6 +43,15 @@ func initializeAndStartApp() {
 
 	// Инициализация конфигурации
 	addrConfig := config.InitConfig()
+
+	// Команда migrate управляет схемой базы данных вместо запуска сервера
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(addrConfig.DBPath, args[1:]); err != nil {
+			log.Fatalf("Ошибка миграции: %v", err)
+		}
+		return
+	}
+
 	storageInstance := storage.NewStorage()
 	appInstance := app.NewApp(storageInstance, addrConfig)
 
@@ -49,3 +62,59 @@ func initializeAndStartApp() {
 		log.Fatalf("Ошибка при запуске приложения: %v", err)
 	}
 }
+
+// runMigrate выполняет команду migrate up|down [N]|status для базы данных DBPath.
+func runMigrate(DBPath string, args []string) error {
+	if DBPath == "" {
+		return errors.New("не задан путь к базе данных (-d или DB_PATH)")
+	}
+	if len(args) == 0 {
+		return errors.New("использование: shortener migrate up|down [N]|status")
+	}
+
+	db, err := repository.OpenDatabase(DBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp()
+		for _, version := range applied {
+			fmt.Printf("Применена миграция %d\n", version)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Схема базы данных актуальна")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("некорректное количество шагов отката: %q", args[1])
+			}
+		}
+		reverted, err := db.MigrateDown(steps)
+		for _, version := range reverted {
+			fmt.Printf("Откачена миграция %d\n", version)
+		}
+		return err
+	case "status":
+		statuses, err := db.MigrationsStatus()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "не применена"
+			if status.Applied {
+				state = "применена " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестная команда migrate: %q", args[0])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/config"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
@@ -15,7 +16,7 @@ func TestInitializeAndStartApp(t *testing.T) {
 	// Создаем фиктивную конфигурацию и хранилище
 	mockConfig := &config.Config{
 		DBPath:     "",
-		FilePath:   "test_file_path",
+		FilePath:   filepath.Join(t.TempDir(), "short-url-db.json"),
 		ServerAddr: "localhost:8080",
 		BaseURL:    "http://localhost",
 		LogLevel:   "info",
@@ -49,3 +50,18 @@ func TestInitializeAndStartApp(t *testing.T) {
 	// Даем серверу время для завершения
 	time.Sleep(2 * time.Second)
 }
+
+func TestRunMigrate_InvalidArgs(t *testing.T) {
+	if err := runMigrate("", []string{"up"}); err == nil {
+		t.Error("Ожидалась ошибка без пути к базе данных")
+	}
+	if err := runMigrate("postgres://localhost/db", nil); err == nil {
+		t.Error("Ожидалась ошибка без подкоманды")
+	}
+	if err := runMigrate("postgres://localhost/db", []string{"sideways"}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестной подкоманды")
+	}
+	if err := runMigrate("postgres://localhost/db", []string{"down", "zero"}); err == nil {
+		t.Error("Ожидалась ошибка для некорректного количества шагов")
+	}
+}
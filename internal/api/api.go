@@ -6,14 +6,10 @@ import (
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/middleware"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
-	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
-	"github.com/Renal37/musthave_shortener_tpl.git/repository"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
 	"time"
 )
 
@@ -29,27 +25,28 @@ type RestAPI struct {
 // Параметры:
 // - ctx: Контекст, используемый для управления жизненным циклом сервера.
 // - ServerAddr: Адрес, на котором сервер будет прослушивать запросы.
-// - BaseURL: Базовый URL для сервиса сокращения ссылок.
-// - LogLevel: Уровень логирования для сервера.
-// - db: Подключение к базе данных, используемое сервисом сокращения ссылок.
-// - dbDNSTurn: Флаг, указывающий, включен ли DNS для базы данных.
-// - storage: Хранилище, используемое сервисом сокращения ссылок.
+// - shortener: Сервис сокращения ссылок, работающий с выбранным хранилищем.
+// - TemplatesDir: Каталог HTML-шаблонов, заменяющих встроенные; пустая строка — только встроенные.
+//
+// Контексты запросов наследуются от ctx, поэтому при остановке сервера
+// незавершённые запросы к хранилищу отменяются. Глобальный логгер должен быть
+// инициализирован вызывающей стороной до запуска сервера и фоновых воркеров.
 //
 // Возвращает ошибку, если сервер не удалось запустить или корректно завершить.
-func StartRestAPI(ctx context.Context, ServerAddr, BaseURL, LogLevel string, db *repository.StoreDB, dbDNSTurn bool, storage *storage.Storage, EnableHTTPS bool, CertFile, KeyFile string) error {
-	if err := logger.Initialize(LogLevel); err != nil {
-		return fmt.Errorf("ошибка инициализации логгера: %w", err)
-	}
-
+func StartRestAPI(ctx context.Context, ServerAddr string, shortener *services.ShortenerService, EnableHTTPS bool, CertFile, KeyFile, TemplatesDir string) error {
 	logger.Log.Info("Запуск сервера", zap.String("address", ServerAddr))
-	storageShortener := services.NewShortenerService(BaseURL, storage, db, dbDNSTurn)
-
 	api := &RestAPI{
-		Shortener: storageShortener,
+		Shortener: shortener,
+	}
+
+	templates, err := LoadTemplates(TemplatesDir)
+	if err != nil {
+		return err
 	}
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	r.SetHTMLTemplate(templates)
 
 	r.Use(
 		gin.Recovery(),
@@ -60,7 +57,9 @@ func StartRestAPI(ctx context.Context, ServerAddr, BaseURL, LogLevel string, db
 
 	api.SetRoutes(r)
 
-	// Создаем HTTP или HTTPS сервер
+	// Создаем HTTP или HTTPS сервер. Контекст запросов не наследует ctx:
+	// иначе его отмена обрывала бы запросы до того, как Shutdown их дождётся.
+	// Зависшие обращения к хранилищу ограничены таймаутами операций.
 	srv := &http.Server{
 		Addr:    ServerAddr,
 		Handler: r,
@@ -95,30 +94,3 @@ func StartRestAPI(ctx context.Context, ServerAddr, BaseURL, LogLevel string, db
 	logger.Log.Info("Сервер успешно остановлен")
 	return nil
 }
-
-func startServer(ServerAddr string, r *gin.Engine) error {
-	server := &http.Server{
-		Addr:    ServerAddr,
-		Handler: r,
-	}
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Ошибка при запуске сервера: %v", err) // Меняем на log.Printf
-		}
-	}()
-
-	<-quit
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Ошибка при остановке сервера: %v\n", err)
-		return err // Возвращаем ошибку
-	}
-
-	return nil
-}
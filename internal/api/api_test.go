@@ -8,16 +8,15 @@ import (
 	"time"
 
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/api"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
-	"github.com/Renal37/musthave_shortener_tpl.git/repository"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestStartRestAPI(t *testing.T) {
 	// Инициализация зависимостей
-	storageInstance := storage.NewStorage()
-	db := &repository.StoreDB{} // Предположим, что это mock или stub
+	storageShortener := services.NewShortenerService("http://localhost:8080", storage.NewStorage())
 
 	// Создаем контекст с отменой
 	ctx, cancel := context.WithCancel(context.Background())
@@ -25,7 +24,7 @@ func TestStartRestAPI(t *testing.T) {
 
 	// Запускаем сервер в отдельной горутине
 	go func() {
-		err := api.StartRestAPI(ctx, ":8080", "http://localhost:8080", "info", db, false, storageInstance, false, "", "")
+		err := api.StartRestAPI(ctx, ":8080", storageShortener, false, "", "", "")
 		assert.NoError(t, err)
 	}()
 
@@ -52,8 +51,7 @@ func TestStartRestAPI(t *testing.T) {
 
 func TestStartRestAPIWithHTTPS(t *testing.T) {
 	// Инициализация зависимостей
-	storageInstance := storage.NewStorage()
-	db := &repository.StoreDB{} // Предположим, что это mock или stub
+	storageShortener := services.NewShortenerService("https://localhost:8443", storage.NewStorage())
 
 	// Создаем контекст с отменой
 	ctx, cancel := context.WithCancel(context.Background())
@@ -61,7 +59,7 @@ func TestStartRestAPIWithHTTPS(t *testing.T) {
 
 	// Запускаем сервер с HTTPS в отдельной горутине
 	go func() {
-		err := api.StartRestAPI(ctx, ":8443", "https://localhost:8443", "info", db, false, storageInstance, true, "cert.pem", "key.pem")
+		err := api.StartRestAPI(ctx, ":8443", storageShortener, true, "cert.pem", "key.pem", "")
 		assert.NoError(t, err)
 	}()
 
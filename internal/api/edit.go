@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateRequest — тело запроса на изменение оригинального URL ссылки.
+type UpdateRequest struct {
+	URL string `json:"url"` // Новый оригинальный URL
+}
+
+// UpdateResponse — ссылка после изменения оригинального URL.
+type UpdateResponse struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"` // Новый URL в каноническом виде
+}
+
+// HistoryResponse — прежний оригинальный URL ссылки.
+type HistoryResponse struct {
+	OriginalURL string    `json:"original_url"`
+	ChangedAt   time.Time `json:"changed_at"` // Момент замены в формате RFC 3339
+}
+
+// UpdateUserURL заменяет оригинальный URL ссылки пользователя и возвращает ссылку с новым URL.
+// Новый URL проверяется так же, как при сокращении. Если он уже сокращён, возвращает статус
+// 409 Conflict и имеющуюся короткую ссылку в поле short_url; чужая ссылка отклоняется
+// со статусом 403 Forbidden, удалённая или истёкшая — 410 Gone.
+func (s *RestAPI) UpdateUserURL(ctx *gin.Context) {
+	userID, ok := requestUser(ctx)
+	if !ok {
+		return
+	}
+	var body UpdateRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "Не удалось прочитать тело запроса",
+			"code":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	shortID := ctx.Param("id")
+	originalURL, err := s.Shortener.UpdateURL(ctx.Request.Context(), userID, shortID, strings.TrimSpace(body.URL))
+	if err != nil {
+		code := errorStatus(err)
+		response := gin.H{"message": editErrorText(err), "code": code}
+		if existing, exists := s.Shortener.GetExistURL(err); exists {
+			response["short_url"] = existing
+		}
+		ctx.JSON(code, response)
+		return
+	}
+	ctx.JSON(http.StatusOK, UpdateResponse{ShortURL: s.Shortener.ShortURL(shortID), OriginalURL: originalURL})
+}
+
+// UserURLHistory возвращает прежние оригинальные URL ссылки пользователя от старых к новым.
+// Ссылка, которую не изменяли, возвращает пустой список; чужая ссылка отклоняется со статусом 403 Forbidden.
+func (s *RestAPI) UserURLHistory(ctx *gin.Context) {
+	userID, ok := requestUser(ctx)
+	if !ok {
+		return
+	}
+	history, err := s.Shortener.History(ctx.Request.Context(), userID, ctx.Param("id"))
+	if err != nil {
+		code := errorStatus(err)
+		ctx.JSON(code, gin.H{
+			"message": editErrorText(err),
+			"code":    code,
+		})
+		return
+	}
+	response := make([]HistoryResponse, 0, len(history))
+	for _, entry := range history {
+		response = append(response, HistoryResponse{OriginalURL: entry.OriginalURL, ChangedAt: entry.ChangedAt})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RestoreResponse — результат восстановления одной ссылки.
+type RestoreResponse struct {
+	ShortURL string `json:"short_url"`
+	Status   string `json:"status"`             // restored, not_found, not_owner, not_deleted, grace_expired или conflict
+	Existing string `json:"existing,omitempty"` // Ссылка, которой теперь принадлежит оригинальный URL, при конфликте
+}
+
+// RestoreUserURLs восстанавливает удалённые ссылки пользователя из списка идентификаторов в теле запроса
+// и возвращает результат для каждой из них в том же порядке со статусом 200 OK.
+// Ссылку нельзя восстановить, если время восстановления истекло или её оригинальный URL сокращён заново.
+func (s *RestAPI) RestoreUserURLs(ctx *gin.Context) {
+	userID, ok := requestUser(ctx)
+	if !ok {
+		return
+	}
+	var shortURLs []string
+	if err := ctx.BindJSON(&shortURLs); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	items, err := s.Shortener.RestoreURLs(ctx.Request.Context(), userID, shortURLs)
+	if err != nil {
+		code := errorStatus(err)
+		ctx.JSON(code, gin.H{
+			"message": "Не удалось восстановить URL-адреса",
+			"code":    code,
+		})
+		return
+	}
+	response := make([]RestoreResponse, 0, len(items))
+	for _, item := range items {
+		result := RestoreResponse{ShortURL: s.Shortener.ShortURL(item.ShortURL), Status: string(item.Status)}
+		if item.Existing != "" {
+			result.Existing = s.Shortener.ShortURL(item.Existing)
+		}
+		response = append(response, result)
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// requestUser возвращает пользователя запроса. Если пользователь не определён или получил
+// идентификатор только что, отвечает ошибкой и возвращает false.
+func requestUser(ctx *gin.Context) (string, bool) {
+	userIDFromContext, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Не удалось получить userID",
+			"error":   "не удалось получить пользователя из контекста",
+		})
+		return "", false
+	}
+	if UserNew, _ := ctx.Get("new"); UserNew == true {
+		ctx.JSON(http.StatusUnauthorized, nil)
+		return "", false
+	}
+	userID, _ := userIDFromContext.(string)
+	return userID, true
+}
+
+// editErrorText возвращает текст ответа для ошибки изменения ссылки или чтения её истории.
+func editErrorText(err error) string {
+	switch code := errorStatus(err); {
+	case code == http.StatusConflict:
+		return "URL уже сокращён"
+	case code == http.StatusNotFound, code == http.StatusGone, code == http.StatusForbidden,
+		code == http.StatusBadRequest, code == http.StatusUnavailableForLegalReasons:
+		return err.Error()
+	default:
+		return "Не удалось обработать ссылку"
+	}
+}
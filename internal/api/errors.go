@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+)
+
+// errorStatus сопоставляет ошибку сервиса с HTTP-статусом ответа.
+// Все обработчики определяют статус ошибки только через эту функцию.
+func errorStatus(err error) int {
+	var conflict *services.ErrConflict
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrDeleted), errors.Is(err, services.ErrExpired),
+		errors.Is(err, services.ErrExhausted):
+		return http.StatusGone
+	case errors.As(err, &conflict), errors.Is(err, services.ErrAliasTaken):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidAlias), errors.Is(err, services.ErrInvalidExpiry),
+		errors.Is(err, services.ErrInvalidMaxClicks), errors.Is(err, services.ErrInvalidPassword),
+		errors.Is(err, services.ErrInvalidURL), errors.Is(err, services.ErrInvalidRedirect),
+		errors.Is(err, services.ErrInvalidTitle), errors.Is(err, services.ErrInvalidListQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrPasswordRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrWrongPassword), errors.Is(err, services.ErrNotOwner):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrBlocked):
+		return http.StatusUnavailableForLegalReasons
+	case errors.Is(err, services.ErrTooManyAttempts):
+		return http.StatusTooManyRequests
+	case errors.Is(err, services.ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorText возвращает текст ответа для ошибки сокращения URL. Ошибки псевдонима и других параметров
+// ссылки сообщаются подробно, чтобы клиент мог исправить запрос и отличить занятый псевдоним
+// от уже сокращённого URL.
+func errorText(err error) string {
+	switch {
+	case errors.Is(err, services.ErrAliasTaken), errors.Is(err, services.ErrInvalidAlias),
+		errors.Is(err, services.ErrInvalidExpiry), errors.Is(err, services.ErrInvalidMaxClicks),
+		errors.Is(err, services.ErrInvalidPassword), errors.Is(err, services.ErrInvalidURL),
+		errors.Is(err, services.ErrBlocked), errors.Is(err, services.ErrInvalidRedirect),
+		errors.Is(err, services.ErrInvalidTitle):
+		return err.Error()
+	default:
+		return "Не удалось сократить URL"
+	}
+}
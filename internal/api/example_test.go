@@ -16,7 +16,7 @@ import (
 func ShortenURLHandlers() {
 	// Инициализация зависимостей
 	storageInstance := storage.NewStorage()
-	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance, nil, false)
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
 	handler := api.RestAPI{Shortener: storageShortener}
 
 	// Настройка роутера Gin
@@ -44,7 +44,7 @@ func ShortenURLHandlers() {
 func RedirectToOriginalURLHandlers() {
 	// Инициализация зависимостей
 	storageInstance := storage.NewStorage()
-	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance, nil, false)
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
 	handler := api.RestAPI{Shortener: storageShortener}
 	// Добавляем URL в хранилище
 	storageInstance.Set("test_id", "https://practicum.yandex.ru/")
@@ -3,15 +3,34 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Request представляет структуру для обработки запроса на сокращение URL
 type Request struct {
-	URL string `json:"url"`
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"` // Необязательный псевдоним короткой ссылки
+	LinkParams
+}
+
+// LinkParams содержит необязательные параметры короткой ссылки, общие для запросов на сокращение.
+type LinkParams struct {
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`    // Момент истечения срока действия в формате RFC 3339
+	TTL          int64      `json:"ttl,omitempty"`           // Срок действия в секундах
+	MaxClicks    int        `json:"max_clicks,omitempty"`    // Допустимое количество переходов
+	Password     string     `json:"password,omitempty"`      // Пароль для перехода по ссылке
+	ForwardQuery *bool      `json:"forward_query,omitempty"` // Передавать параметры запроса перехода; по умолчанию — настройка сервиса
+	ForwardPath  *bool      `json:"forward_path,omitempty"`  // Дописывать путь после идентификатора; по умолчанию — настройка сервиса
+	RedirectCode int        `json:"redirect_code,omitempty"` // Статус перенаправления: 301, 302, 307 или 308; по умолчанию — настройка сервиса
+	CacheMaxAge  *int       `json:"cache_max_age,omitempty"` // Время кеширования перенаправления в секундах; по умолчанию — настройка сервиса
+	Title        string     `json:"title,omitempty"`         // Название ссылки для страницы предпросмотра
 }
 
 // Response представляет структуру для ответа с сокращенным URL
@@ -24,6 +43,8 @@ type Response struct {
 type RequestBodyURLs struct {
 	CorrelationID string `json:"correlation_id"`
 	OriginalURL   string `json:"original_url"`
+	Alias         string `json:"alias,omitempty"` // Необязательный псевдоним короткой ссылки
+	LinkParams
 }
 
 // ResponseBodyURLs представляет ответ с уникальным идентификатором корреляции
@@ -33,6 +54,31 @@ type ResponseBodyURLs struct {
 	ShortURL      string `json:"short_url"`
 }
 
+// options собирает параметры ссылки из полей запроса.
+// Поля expires_at и ttl взаимоисключающие; ttl должен быть положительным.
+func (p LinkParams) options() (services.LinkOptions, error) {
+	opts := services.LinkOptions{
+		MaxClicks:    p.MaxClicks,
+		Password:     p.Password,
+		ForwardQuery: p.ForwardQuery,
+		ForwardPath:  p.ForwardPath,
+		RedirectCode: p.RedirectCode,
+		CacheMaxAge:  p.CacheMaxAge,
+		Title:        p.Title,
+	}
+	switch {
+	case p.ExpiresAt != nil && p.TTL != 0:
+		return opts, fmt.Errorf("%w: поля expires_at и ttl нельзя задавать одновременно", services.ErrInvalidExpiry)
+	case p.TTL < 0:
+		return opts, fmt.Errorf("%w: ttl должен быть положительным", services.ErrInvalidExpiry)
+	case p.TTL > 0:
+		opts.ExpiresAt = time.Now().Add(time.Duration(p.TTL) * time.Second)
+	case p.ExpiresAt != nil:
+		opts.ExpiresAt = *p.ExpiresAt
+	}
+	return opts, nil
+}
+
 // ShortenURLHandler обрабатывает запросы на сокращение URL, переданного в теле запроса в виде строки.
 // Возвращает сокращенный URL. Если URL уже существует, возвращает имеющийся сокращенный URL
 // со статусом 409 Conflict.
@@ -47,14 +93,15 @@ func (s *RestAPI) ShortenURLHandler(c *gin.Context) {
 	userID, _ := userIDFromContext.(string)
 
 	url := strings.TrimSpace(string(body))
-	shortURL, err := s.Shortener.Set(userID, url)
+	shortURL, err := s.Shortener.Set(c.Request.Context(), userID, url)
 	if err != nil {
-		shortURL, err = s.Shortener.GetExistURL(url, err)
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Не удалось сократить URL", http.StatusInternalServerError)
+		var exists bool
+		shortURL, exists = s.Shortener.GetExistURL(err)
+		if !exists {
+			c.String(errorStatus(err), errorText(err))
 			return
 		}
-		httpStatus = http.StatusConflict
+		httpStatus = errorStatus(err)
 	}
 	c.Header("Content-Type", "text/plain")
 	c.String(httpStatus, shortURL)
@@ -62,7 +109,11 @@ func (s *RestAPI) ShortenURLHandler(c *gin.Context) {
 
 // ShortenURLJSON обрабатывает запросы на сокращение URL в формате JSON.
 // Возвращает JSON с сокращенным URL. Если URL уже существует, возвращает имеющийся сокращенный URL
-// со статусом 409 Conflict.
+// со статусом 409 Conflict; ссылка с необязательными параметрами всегда создаётся новой. Необязательное поле alias задаёт псевдоним короткой ссылки:
+// недопустимый псевдоним отклоняется со статусом 400 Bad Request, занятый — 409 Conflict
+// с сообщением об ошибке вместо ссылки. Необязательные поля expires_at или ttl ограничивают
+// срок действия ссылки, max_clicks — количество переходов по ней, password — пароль для перехода;
+// некорректные значения отклоняются со статусом 400 Bad Request.
 func (s *RestAPI) ShortenURLJSON(c *gin.Context) {
 	var decoderBody Request
 	httpStatus := http.StatusCreated
@@ -83,19 +134,25 @@ func (s *RestAPI) ShortenURLJSON(c *gin.Context) {
 	userID, _ := userIDFromContext.(string)
 
 	url := strings.TrimSpace(decoderBody.URL)
-	shortURL, err := s.Shortener.Set(userID, url)
+	opts, err := decoderBody.options()
+	var shortURL string
+	if err == nil {
+		shortURL, err = s.Shortener.SetLink(c.Request.Context(), userID, url, decoderBody.Alias, opts)
+	}
 	if err != nil {
-		shortURL, err = s.Shortener.GetExistURL(url, err)
-		if err != nil {
+		var exists bool
+		shortURL, exists = s.Shortener.GetExistURL(err)
+		if !exists {
+			code := errorStatus(err)
 			errorMessage := map[string]interface{}{
-				"message": "Не удалось сократить URL",
-				"code":    http.StatusInternalServerError,
+				"message": errorText(err),
+				"code":    code,
 			}
 			answer, _ := json.Marshal(errorMessage)
-			c.Data(http.StatusInternalServerError, "application/json", answer)
+			c.Data(code, "application/json", answer)
 			return
 		}
-		httpStatus = http.StatusConflict
+		httpStatus = errorStatus(err)
 	}
 
 	response := Response{Result: shortURL}
@@ -112,26 +169,55 @@ func (s *RestAPI) ShortenURLJSON(c *gin.Context) {
 }
 
 // RedirectToOriginalURL перенаправляет пользователя на оригинальный URL по сокращенному идентификатору.
-// Если URL недоступен, возвращает статус 410 Gone.
+// Переход засчитывается в лимит переходов ссылки. Если URL удалён, истёк срок его действия
+// или исчерпаны переходы, возвращает статус 410 Gone, если не найден — 404 Not Found.
+// Пароль защищённой ссылки передаётся в заголовке X-Link-Password; без него показывается
+// форма ввода пароля со статусом 401 Unauthorized. Путь после идентификатора и параметры запроса
+// передаются на оригинальный URL, если это разрешено настройками ссылки или сервиса.
+// Статус перенаправления (по умолчанию 307) и заголовок Cache-Control задаются ссылкой или настройками сервиса.
+// Если к идентификатору дописан "+" или передан параметр preview=1, вместо перехода показывается
+// страница предпросмотра ссылки.
 func (s *RestAPI) RedirectToOriginalURL(c *gin.Context) {
-	code := http.StatusTemporaryRedirect
-	shortID := c.Param("id")
-	originalURL, err := s.Shortener.Get(shortID)
+	shortID, preview := previewID(c)
+	if preview {
+		s.previewLink(c, shortID)
+		return
+	}
+	password := c.GetHeader(passwordHeader)
+	redirect, err := s.Shortener.Visit(c.Request.Context(), shortID, unlock(c, password), passthrough(c))
 	if err != nil {
-		if err.Error() == http.StatusText(http.StatusGone) {
-			c.Status(http.StatusGone)
-			return
-		}
-		c.String(http.StatusTemporaryRedirect, err.Error())
+		visitError(c, err, password == "")
 		return
 	}
 
-	c.Header("Location", originalURL)
-	c.String(code, originalURL)
+	c.Header("Cache-Control", cacheControl(redirect))
+	c.Header("Location", redirect.Location)
+	c.String(redirect.Code, redirect.Location)
+}
+
+// cacheControl возвращает значение заголовка Cache-Control для перенаправления redirect.
+// Перенаправление без времени кеширования браузер и CDN должны перепроверять при каждом переходе.
+func cacheControl(redirect services.Redirect) string {
+	switch {
+	case redirect.NoStore:
+		return "private, no-store"
+	case redirect.MaxAge > 0:
+		return fmt.Sprintf("public, max-age=%d", redirect.MaxAge)
+	default:
+		return "no-cache"
+	}
+}
+
+// passthrough возвращает путь после идентификатора и параметры запроса перехода.
+func passthrough(c *gin.Context) services.Passthrough {
+	return services.Passthrough{Path: c.Param("path"), Query: c.Request.URL.Query()}
 }
 
 // ShortenURLsJSON обрабатывает запросы на сокращение нескольких URL в формате JSON.
-// Возвращает JSON со списком сокращенных URL с их идентификаторами корреляции.
+// Все URL сохраняются одной транзакцией: при ошибке не сохраняется ни один из них.
+// Возвращает JSON со списком сокращенных URL с их идентификаторами корреляции;
+// если часть URL уже была сокращена, ответ содержит имеющиеся ссылки и статус 409 Conflict.
+// Срок действия и количество переходов задаются для каждого URL отдельно.
 func (s *RestAPI) ShortenURLsJSON(c *gin.Context) {
 	var decoderBody []RequestBodyURLs
 	httpStatus := http.StatusCreated
@@ -151,28 +237,44 @@ func (s *RestAPI) ShortenURLsJSON(c *gin.Context) {
 	userIDFromContext, _ := c.Get("userID")
 	userID, _ := userIDFromContext.(string)
 
-	var URLResponses []ResponseBodyURLs
+	urls := make([]services.BatchURL, 0, len(decoderBody))
 	for _, req := range decoderBody {
-		url := strings.TrimSpace(req.OriginalURL)
-		shortURL, err := s.Shortener.Set(userID, url)
-		if err != nil {
-			shortURL, err = s.Shortener.GetExistURL(url, err)
-			if err != nil {
-				errorMessage := map[string]interface{}{
-					"message": "Не удалось сократить URL",
-					"code":    http.StatusInternalServerError,
-				}
-				answer, _ := json.Marshal(errorMessage)
-				c.Data(http.StatusInternalServerError, "application/json", answer)
-				return
-			}
-			httpStatus = http.StatusConflict
+		opts, optsErr := req.options()
+		if optsErr != nil {
+			err = optsErr
+			break
 		}
-		urlResponse := ResponseBodyURLs{
-			req.CorrelationID,
-			shortURL,
+		urls = append(urls, services.BatchURL{
+			CorrelationID: req.CorrelationID,
+			OriginalURL:   strings.TrimSpace(req.OriginalURL),
+			Alias:         req.Alias,
+			Options:       opts,
+		})
+	}
+	var results []services.BatchResult
+	if err == nil {
+		results, err = s.Shortener.SetBatch(c.Request.Context(), userID, urls)
+	}
+	if err != nil {
+		code := errorStatus(err)
+		errorMessage := map[string]interface{}{
+			"message": errorText(err),
+			"code":    code,
 		}
-		URLResponses = append(URLResponses, urlResponse)
+		answer, _ := json.Marshal(errorMessage)
+		c.Data(code, "application/json", answer)
+		return
+	}
+
+	URLResponses := make([]ResponseBodyURLs, 0, len(results))
+	for _, result := range results {
+		if result.Conflict {
+			httpStatus = http.StatusConflict
+		}
+		URLResponses = append(URLResponses, ResponseBodyURLs{
+			result.CorrelationID,
+			result.ShortURL,
+		})
 	}
 	respJSON, err := json.Marshal(URLResponses)
 	if err != nil {
@@ -194,7 +296,7 @@ func (s *RestAPI) ShortenURLsJSON(c *gin.Context) {
 
 // Ping проверяет доступность службы, возвращая статус 200 OK в случае успешного ответа.
 func (s *RestAPI) Ping(ctx *gin.Context) {
-	err := s.Shortener.Ping()
+	err := s.Shortener.Ping(ctx.Request.Context())
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, "")
 		return
@@ -202,48 +304,111 @@ func (s *RestAPI) Ping(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, "")
 }
 
-// UserURLsHandler возвращает все URL-адреса, созданные пользователем.
+// UserURLResponse — ссылка пользователя в списке.
+type UserURLResponse struct {
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	Title       string     `json:"title,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`           // Момент создания в формате RFC 3339
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // Момент истечения срока действия
+	Deleted     bool       `json:"deleted"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // Момент удаления
+}
+
+// UserURLsHandler возвращает страницу URL-адресов, созданных пользователем, в порядке создания.
+// Параметры запроса: limit — размер страницы (не больше 1000, по умолчанию весь список), cursor — курсор
+// следующей страницы, order — asc (по умолчанию) или desc, contains — подстрока оригинального URL,
+// host — его хост, status — active, deleted или all (по умолчанию).
+// Если страница не последняя, заголовок Link содержит адрес следующей с rel="next".
+// Пустой список возвращается со статусом 204 No Content, некорректные параметры — 400 Bad Request.
 // Если пользователь не найден, возвращает статус 401 Unauthorized.
 func (s *RestAPI) UserURLsHandler(ctx *gin.Context) {
-	code := http.StatusOK
-	userIDFromContext, exists := ctx.Get("userID")
-	if !exists {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Не удалось получить userID",
-			"error":   errors.New("не удалось получить пользователя из контекста").Error(),
-		})
+	userID, ok := requestUser(ctx)
+	if !ok {
 		return
 	}
-	UserNew, _ := ctx.Get("new")
-	if UserNew == true {
-		code = http.StatusUnauthorized
-		ctx.JSON(code, nil)
-		return
-	}
-	userID, _ := userIDFromContext.(string)
-	urls, err := s.Shortener.GetFullRep(userID)
-	ctx.Header("Content-type", "application/json")
-	if err != nil {
-		if err.Error() == http.StatusText(http.StatusGone) {
-			ctx.Status(http.StatusGone)
+	query, err := listQuery(ctx)
+	if err == nil {
+		var page services.ListPage
+		page, err = s.Shortener.ListURLs(ctx.Request.Context(), userID, query)
+		if err == nil {
+			s.writeURLsPage(ctx, page)
 			return
 		}
-		code = http.StatusInternalServerError
-		ctx.JSON(code, gin.H{
-			"message": "Не удалось получить URL-адреса пользователя",
-			"code":    code,
-		})
-		return
 	}
 
-	if len(urls) == 0 {
-		ctx.JSON(http.StatusNoContent, nil)
+	code := errorStatus(err)
+	message := "Не удалось получить URL-адреса пользователя"
+	if code == http.StatusBadRequest {
+		message = err.Error()
+	}
+	ctx.JSON(code, gin.H{
+		"message": message,
+		"code":    code,
+	})
+}
+
+// listQuery разбирает параметры запроса списка ссылок пользователя.
+func listQuery(ctx *gin.Context) (services.ListQuery, error) {
+	query := services.ListQuery{
+		Cursor:   ctx.Query("cursor"),
+		Contains: ctx.Query("contains"),
+		Host:     ctx.Query("host"),
+		Status:   services.ListStatus(ctx.Query("status")),
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("%w: limit должен быть положительным целым числом", services.ErrInvalidListQuery)
+		}
+	}
+	switch ctx.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, fmt.Errorf("%w: order должен быть asc или desc", services.ErrInvalidListQuery)
+	}
+	return query, nil
+}
+
+// writeURLsPage отвечает страницей списка ссылок и ссылкой на следующую страницу в заголовке Link.
+func (s *RestAPI) writeURLsPage(ctx *gin.Context, page services.ListPage) {
+	if page.NextCursor != "" {
+		next := *ctx.Request.URL
+		values := next.Query()
+		values.Set("cursor", page.NextCursor)
+		next.RawQuery = values.Encode()
+		ctx.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	if len(page.Links) == 0 {
+		ctx.Status(http.StatusNoContent)
 		return
 	}
-	ctx.JSON(code, urls)
+
+	response := make([]UserURLResponse, 0, len(page.Links))
+	for _, link := range page.Links {
+		item := UserURLResponse{
+			ShortURL:    s.Shortener.ShortURL(link.ShortID),
+			OriginalURL: link.OriginalURL,
+			Title:       link.Title,
+			CreatedAt:   link.CreatedAt.UTC(),
+			Deleted:     link.Deleted,
+		}
+		if !link.ExpiresAt.IsZero() {
+			expiresAt := link.ExpiresAt.UTC()
+			item.ExpiresAt = &expiresAt
+		}
+		if link.Deleted && !link.DeletedAt.IsZero() {
+			deletedAt := link.DeletedAt.UTC()
+			item.DeletedAt = &deletedAt
+		}
+		response = append(response, item)
+	}
+	ctx.JSON(http.StatusOK, response)
 }
 
-// DeleteUserUrls удаляет URL-адреса пользователя на основе списка сокращенных URL-адресов.
+// DeleteUserUrls ставит URL-адреса пользователя в очередь удаления и возвращает статус 202 Accepted.
 func (s *RestAPI) DeleteUserUrls(ctx *gin.Context) {
 	code := http.StatusAccepted
 	userIDFromContext, exists := ctx.Get("userID")
@@ -265,9 +430,9 @@ func (s *RestAPI) DeleteUserUrls(ctx *gin.Context) {
 		return
 	}
 
-	err := s.Shortener.DeleteURLsRep(userID, shortURLs)
+	err := s.Shortener.DeleteURLsRep(ctx.Request.Context(), userID, shortURLs)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+		ctx.JSON(errorStatus(err), gin.H{
 			"message": "Не удалось удалить URL-адрес",
 			"error":   errors.New("не удалось удалить URL-адрес").Error(),
 		})
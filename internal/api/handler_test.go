@@ -1,20 +1,29 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_shortenURLHandler(t *testing.T) {
 	storageInstance := storage.NewStorage()
-	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance, nil, false)
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
 
 	type args struct {
 		code        int
@@ -59,7 +68,7 @@ func Test_shortenURLHandler(t *testing.T) {
 
 func Test_shortenURLHandlerJSON(t *testing.T) {
 	storageInstance := storage.NewStorage()
-	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance, nil, false)
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
 
 	type args struct {
 		code        int
@@ -115,7 +124,7 @@ func Test_shortenURLHandlerJSON(t *testing.T) {
 
 func Test_shortenURLsHandlerJSON(t *testing.T) {
 	storageInstance := storage.NewStorage()
-	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance, nil, false)
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
 
 	type args struct {
 		code        int
@@ -143,11 +152,11 @@ func Test_shortenURLsHandlerJSON(t *testing.T) {
 			body: []RequestBodyURLs{
 				{
 					CorrelationID: "1",
-					OriginalURL:   "google.com",
+					OriginalURL:   "https://google.com/",
 				},
 				{
 					CorrelationID: "2",
-					OriginalURL:   "google.kz",
+					OriginalURL:   "https://google.kz/",
 				},
 			},
 		},
@@ -177,9 +186,109 @@ func Test_shortenURLsHandlerJSON(t *testing.T) {
 	}
 }
 
+func Test_shortenURLsHandlerJSON_Conflict(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+	assert.NoError(t, storageInstance.Create(context.Background(), "https://google.com/", "existing", "user1", services.LinkOptions{}))
+
+	r := gin.Default()
+	r.POST("/api/shorten/batch", handler.ShortenURLsJSON)
+	body := `[{"correlation_id":"1","original_url":"https://google.com/"},{"correlation_id":"2","original_url":"https://google.kz/"}]`
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var response []ResponseBodyURLs
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 2)
+	assert.Equal(t, ResponseBodyURLs{CorrelationID: "1", ShortURL: "http://localhost:8080/existing"}, response[0])
+	assert.Equal(t, "2", response[1].CorrelationID)
+}
+
+func Test_shortenURLJSON_Alias(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	handler.SetRoutes(r)
+
+	tests := []struct {
+		name    string
+		body    string
+		code    int
+		message string
+	}{
+		{name: "created", body: `{"url":"https://practicum.yandex.ru/","alias":"practicum"}`, code: http.StatusCreated},
+		{name: "alias taken", body: `{"url":"https://yandex.ru/","alias":"practicum"}`, code: http.StatusConflict, message: "псевдоним уже занят: practicum"},
+		{name: "url shortened", body: `{"url":"https://practicum.yandex.ru/","alias":"other"}`, code: http.StatusConflict},
+		{name: "route", body: `{"url":"https://yandex.ru/","alias":"ping"}`, code: http.StatusBadRequest},
+		{name: "charset", body: `{"url":"https://yandex.ru/","alias":"a/b"}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			assert.Equal(t, tt.code, w.Code)
+			var response map[string]interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.code != http.StatusBadRequest && tt.message == "" {
+				assert.Equal(t, "http://localhost:8080/practicum", response["result"])
+			}
+			if tt.message != "" {
+				assert.Equal(t, tt.message, response["message"])
+			}
+		})
+	}
+}
+
+func Test_shortenURLJSON_Expiry(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	handler.SetRoutes(r)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "ttl", body: `{"url":"https://practicum.yandex.ru/","ttl":3600}`, code: http.StatusCreated},
+		{name: "expires_at", body: `{"url":"https://yandex.ru/","expires_at":"` + future + `"}`, code: http.StatusCreated},
+		{name: "both", body: `{"url":"https://ya.ru/","ttl":60,"expires_at":"` + future + `"}`, code: http.StatusBadRequest},
+		{name: "negative ttl", body: `{"url":"https://ya.ru/","ttl":-1}`, code: http.StatusBadRequest},
+		{name: "past", body: `{"url":"https://ya.ru/","expires_at":"` + past + `"}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+
+	// В пакетном запросе некорректный срок действия отклоняет весь пакет
+	body := `[{"correlation_id":"1","original_url":"https://ya.ru/","ttl":60},{"correlation_id":"2","original_url":"https://go.dev/","ttl":-5}]`
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	_, err := storageInstance.Get(context.Background(), "", "https://ya.ru/")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+}
+
 func Test_redirectToOriginalURLHandler(t *testing.T) {
 	storageInstance := storage.NewStorage()
-	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance, nil, false)
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
 
 	type argsGet struct {
 		code     int
@@ -206,7 +315,7 @@ func Test_redirectToOriginalURLHandler(t *testing.T) {
 
 	for _, tt := range testsGET {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.Storage.Shortener.Storage.Set(tt.argsGet.testURL, tt.argsGet.location)
+			storageInstance.Set(tt.argsGet.testURL, tt.argsGet.location)
 
 			r := gin.Default()
 			r.GET("/:id", tt.Storage.RedirectToOriginalURL)
@@ -223,7 +332,7 @@ func Test_redirectToOriginalURLHandler(t *testing.T) {
 }
 func Test_shortenURLHandler_Error(t *testing.T) {
 	storageInstance := storage.NewStorage()
-	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance, nil, false)
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
 
 	tests := []struct {
 		name    string
@@ -266,3 +375,620 @@ func Test_shortenURLHandler_Error(t *testing.T) {
 		})
 	}
 }
+
+func Test_shortenURLHandler_Conflict(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	r.POST("/", handler.ShortenURLHandler)
+
+	var shortURLs []string
+	for _, code := range []int{http.StatusCreated, http.StatusConflict} {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://practicum.yandex.ru/"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+
+		assert.Equal(t, code, w.Code)
+		shortURLs = append(shortURLs, w.Body.String())
+	}
+	// При конфликте возвращается уже существующая короткая ссылка
+	assert.Equal(t, shortURLs[0], shortURLs[1])
+}
+
+func Test_redirectToOriginalURLHandler_MaxClicks(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	handler.SetRoutes(r)
+
+	body := `{"url":"https://practicum.yandex.ru/","alias":"invite","max_clicks":2}`
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	for _, code := range []int{http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, http.StatusGone} {
+		request = httptest.NewRequest(http.MethodGet, "/invite", nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, code, w.Code)
+	}
+
+	body = `{"url":"https://yandex.ru/","max_clicks":-1}`
+	request = httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_redirectToOriginalURLHandler_Password(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	r.SetHTMLTemplate(template.Must(LoadTemplates("")))
+	handler.SetRoutes(r)
+
+	body := `{"url":"https://practicum.yandex.ru/","alias":"locked","password":"p4ssw0rd"}`
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Без пароля показывается форма
+	request = httptest.NewRequest(http.MethodGet, "/locked", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `<form method="post">`)
+
+	// Пароль в заголовке
+	request = httptest.NewRequest(http.MethodGet, "/locked", nil)
+	request.Header.Set("X-Link-Password", "wrong")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	request = httptest.NewRequest(http.MethodGet, "/locked", nil)
+	request.Header.Set("X-Link-Password", "p4ssw0rd")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://practicum.yandex.ru/", w.Header().Get("Location"))
+
+	// Пароль из формы
+	request = httptest.NewRequest(http.MethodPost, "/locked", strings.NewReader("password=wrong"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Неверный пароль")
+
+	request = httptest.NewRequest(http.MethodPost, "/locked", strings.NewReader("password=p4ssw0rd"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "https://practicum.yandex.ru/", w.Header().Get("Location"))
+}
+
+func Test_redirectToOriginalURLHandler_Errors(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	ctx := context.Background()
+	assert.NoError(t, storageInstance.Create(ctx, "https://practicum.yandex.ru/", "deleted", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.DeleteURLs(ctx, "user1", []string{"deleted"}))
+	expired := services.LinkOptions{ExpiresAt: time.Now().Add(-time.Second)}
+	assert.NoError(t, storageInstance.Create(ctx, "https://yandex.ru/", "expired", "user1", expired))
+
+	r := gin.Default()
+	r.GET("/:id", handler.RedirectToOriginalURL)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{path: "/deleted", code: http.StatusGone},
+		{path: "/expired", code: http.StatusGone},
+		{path: "/missing", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, tt.code, w.Code, tt.path)
+	}
+}
+
+func Test_errorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, errorStatus(services.ErrNotFound))
+	assert.Equal(t, http.StatusGone, errorStatus(fmt.Errorf("get: %w", services.ErrDeleted)))
+	assert.Equal(t, http.StatusGone, errorStatus(services.ErrExpired))
+	assert.Equal(t, http.StatusGone, errorStatus(services.ErrExhausted))
+	assert.Equal(t, http.StatusTooManyRequests, errorStatus(services.ErrTooManyAttempts))
+	assert.Equal(t, http.StatusBadRequest, errorStatus(services.ErrInvalidExpiry))
+	assert.Equal(t, http.StatusBadRequest, errorStatus(services.ErrInvalidListQuery))
+	assert.Equal(t, http.StatusForbidden, errorStatus(services.ErrNotOwner))
+	assert.Equal(t, http.StatusConflict, errorStatus(&services.ErrConflict{Existing: "abc"}))
+	assert.Equal(t, http.StatusGatewayTimeout, errorStatus(context.DeadlineExceeded))
+	assert.Equal(t, http.StatusInternalServerError, errorStatus(errors.New("database error")))
+}
+
+func Test_shortenURLHandler_InvalidURL(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	r.POST("/", handler.ShortenURLHandler)
+	r.POST("/api/shorten", handler.ShortenURLJSON)
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("ftp://example.com/"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `схема "ftp" не поддерживается`)
+
+	request = httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"example.com"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "не указана схема")
+
+	// Один и тот же адрес, записанный по-разному, получает одну короткую ссылку
+	var shortURLs []string
+	for _, body := range []string{"http://Example.com:80", "http://example.com/"} {
+		request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		shortURLs = append(shortURLs, w.Body.String())
+	}
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, shortURLs[0], shortURLs[1])
+}
+
+func Test_redirectToOriginalURLHandler_Blocked(t *testing.T) {
+	path := t.TempDir() + "/blocklist.txt"
+	if err := os.WriteFile(path, []byte("evil.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	blocklist, err := services.LoadBlocklist(path)
+	assert.NoError(t, err)
+
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	storageShortener.Blocklist = blocklist
+	handler := RestAPI{Shortener: storageShortener}
+	// Ссылка создана до того, как домен попал в список
+	assert.NoError(t, storageInstance.Create(context.Background(), "https://evil.com/", "old", "user1", services.LinkOptions{MaxClicks: 3}))
+
+	r := gin.Default()
+	r.POST("/", handler.ShortenURLHandler)
+	r.GET("/:id", handler.RedirectToOriginalURL)
+
+	request := httptest.NewRequest(http.MethodGet, "/old", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	// Отклонённый переход не расходует лимит
+	record, _ := storageInstance.Record("old")
+	assert.Equal(t, 3, record.ClicksLeft)
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://EVIL.com/page"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	assert.Equal(t, "домен заблокирован: evil.com", w.Body.String())
+}
+
+func Test_redirectToOriginalURLHandler_Passthrough(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	storageShortener.Forwarding = services.Forwarding{Query: true}
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	r.POST("/api/shorten", handler.ShortenURLJSON)
+	r.GET("/:id", handler.RedirectToOriginalURL)
+	r.GET("/:id/*path", handler.RedirectToOriginalURL)
+
+	for _, body := range []string{
+		`{"url":"https://example.com/docs?lang=ru","alias":"docs","forward_path":true}`,
+		`{"url":"https://example.org/","alias":"plain","forward_query":false}`,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	tests := []struct {
+		target   string
+		location string
+	}{
+		{target: "/docs", location: "https://example.com/docs?lang=ru"},
+		{target: "/docs/guide?utm_source=x&lang=en", location: "https://example.com/docs/guide?lang=ru&utm_source=x"},
+		{target: "/plain/extra?utm_source=x", location: "https://example.org/"},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code, tt.target)
+		assert.Equal(t, tt.location, w.Header().Get("Location"), tt.target)
+	}
+}
+
+func Test_redirectToOriginalURLHandler_RedirectCode(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	r.POST("/api/shorten", handler.ShortenURLJSON)
+	r.GET("/:id", handler.RedirectToOriginalURL)
+
+	tests := []struct {
+		body         string
+		target       string
+		code         int
+		cacheControl string
+	}{
+		{body: `{"url":"https://example.com/","alias":"plain"}`, target: "/plain", code: http.StatusTemporaryRedirect, cacheControl: "no-cache"},
+		{
+			body:         `{"url":"https://example.org/","alias":"permanent","redirect_code":301,"cache_max_age":86400}`,
+			target:       "/permanent",
+			code:         http.StatusMovedPermanently,
+			cacheControl: "public, max-age=86400",
+		},
+		{
+			body:         `{"url":"https://example.net/","alias":"limited","redirect_code":308,"max_clicks":5,"cache_max_age":60}`,
+			target:       "/limited",
+			code:         http.StatusPermanentRedirect,
+			cacheControl: "private, no-store",
+		},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, http.StatusCreated, w.Code, tt.body)
+
+		request = httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, tt.code, w.Code, tt.target)
+		assert.Equal(t, tt.cacheControl, w.Header().Get("Cache-Control"), tt.target)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://ya.ru/","redirect_code":303}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_redirectToOriginalURLHandler_Preview(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	r := gin.Default()
+	r.SetHTMLTemplate(template.Must(LoadTemplates("")))
+	r.POST("/api/shorten", handler.ShortenURLJSON)
+	r.GET("/:id", handler.RedirectToOriginalURL)
+	r.GET("/:id/*path", handler.RedirectToOriginalURL)
+
+	for _, body := range []string{
+		`{"url":"https://example.com/docs","alias":"docs","title":"Документация","max_clicks":1}`,
+		`{"url":"https://example.org/secret","alias":"locked","password":"p4ssw0rd"}`,
+		`{"url":"https://example.net/","alias":"gone"}`,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+	assert.NoError(t, storageInstance.DeleteURLs(context.Background(), "", []string{"gone"}))
+
+	tests := []struct {
+		target   string
+		contains []string
+	}{
+		{target: "/docs+", contains: []string{"Документация", "https://example.com/docs", `href="http://localhost:8080/docs"`}},
+		{target: "/docs/guide?preview=1&lang=en", contains: []string{`href="http://localhost:8080/docs/guide?lang=en"`}},
+		{target: "/locked+", contains: []string{"защищена паролем", `href="http://localhost:8080/locked"`}},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, http.StatusOK, w.Code, tt.target)
+		assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"), tt.target)
+		for _, text := range tt.contains {
+			assert.Contains(t, w.Body.String(), text, tt.target)
+		}
+		assert.NotContains(t, w.Body.String(), "https://example.org/secret", tt.target)
+	}
+
+	// Предпросмотр не расходует переходы
+	request := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	for target, code := range map[string]int{"/docs+": http.StatusGone, "/gone+": http.StatusGone, "/missing+": http.StatusNotFound} {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, code, w.Code, target)
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "preview.html"), []byte(`custom {{.Title}}`), 0o644))
+
+	tmpl, err := LoadTemplates(dir)
+	assert.NoError(t, err)
+	var out strings.Builder
+	assert.NoError(t, tmpl.ExecuteTemplate(&out, "preview.html", previewPage{Title: "docs"}))
+	assert.Equal(t, "custom docs", out.String())
+	assert.NotNil(t, tmpl.Lookup("password.html"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.html"), []byte(`{{.Title`), 0o644))
+	_, err = LoadTemplates(dir)
+	assert.Error(t, err)
+}
+
+func Test_qrCode(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+
+	ctx := context.Background()
+	assert.NoError(t, storageInstance.Create(ctx, "https://practicum.yandex.ru/", "abc", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.Create(ctx, "https://yandex.ru/", "deleted", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.DeleteURLs(ctx, "user1", []string{"deleted"}))
+
+	r := gin.Default()
+	r.GET("/api/qr/:id", handler.QRCode)
+
+	tests := []struct {
+		target      string
+		accept      string
+		code        int
+		contentType string
+	}{
+		{target: "/api/qr/abc", code: http.StatusOK, contentType: "image/png"},
+		{target: "/api/qr/abc?format=svg&size=512&margin=0&level=h", code: http.StatusOK, contentType: "image/svg+xml"},
+		{target: "/api/qr/abc", accept: "image/svg+xml", code: http.StatusOK, contentType: "image/svg+xml"},
+		{target: "/api/qr/abc?format=png", accept: "image/svg+xml", code: http.StatusOK, contentType: "image/png"},
+		{target: "/api/qr/abc", accept: "application/json", code: http.StatusNotAcceptable},
+		{target: "/api/qr/abc?format=gif", code: http.StatusBadRequest},
+		{target: "/api/qr/abc?size=10", code: http.StatusBadRequest},
+		{target: "/api/qr/abc?margin=-1", code: http.StatusBadRequest},
+		{target: "/api/qr/abc?level=X", code: http.StatusBadRequest},
+		{target: "/api/qr/deleted", code: http.StatusGone},
+		{target: "/api/qr/missing", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.accept != "" {
+			request.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, tt.code, w.Code, tt.target)
+		if tt.contentType != "" {
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"), tt.target)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/api/qr/abc?size=300", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	img, err := png.Decode(w.Body)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, img.Bounds().Dx(), 300)
+	assert.Greater(t, img.Bounds().Dx(), 200)
+}
+
+func Test_updateUserURL(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+	assert.NoError(t, storageInstance.Create(context.Background(), "https://example.com/typo", "abc", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.Create(context.Background(), "https://example.org/", "def", "user1", services.LinkOptions{}))
+
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", c.GetHeader("X-User"))
+	})
+	r.PATCH("/api/user/urls/:id", handler.UpdateUserURL)
+	r.GET("/api/user/urls/:id/history", handler.UserURLHistory)
+
+	patch := func(user, shortID, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPatch, "/api/user/urls/"+shortID, strings.NewReader(body))
+		request.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+
+	w := patch("user1", "abc", `{"url":"https://Example.com/fixed"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated UpdateResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, UpdateResponse{ShortURL: "http://localhost:8080/abc", OriginalURL: "https://example.com/fixed"}, updated)
+
+	// Уже сокращённый URL возвращает имеющуюся ссылку
+	w = patch("user1", "abc", `{"url":"https://example.org/"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"short_url":"http://localhost:8080/def"`)
+
+	assert.Equal(t, http.StatusForbidden, patch("user2", "abc", `{"url":"https://example.net/"}`).Code)
+	assert.Equal(t, http.StatusNotFound, patch("user1", "missing", `{"url":"https://example.net/"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch("user1", "abc", `{"url":"ftp://example.net/"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch("user1", "abc", `not json`).Code)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls/abc/history", nil)
+	request.Header.Set("X-User", "user1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history []HistoryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "https://example.com/typo", history[0].OriginalURL)
+		assert.False(t, history[0].ChangedAt.IsZero())
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/api/user/urls/def/history", nil)
+	request.Header.Set("X-User", "user1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func Test_userURLs(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+	ctx := context.Background()
+	assert.NoError(t, storageInstance.Create(ctx, "https://example.com/docs", "abc", "user1", services.LinkOptions{Title: "Docs"}))
+	assert.NoError(t, storageInstance.Create(ctx, "https://example.org/", "def", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.Create(ctx, "https://Example.com/blog", "ghi", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.Create(ctx, "https://example.net/", "jkl", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.DeleteURLs(ctx, "user1", []string{"jkl"}))
+
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", c.GetHeader("X-User"))
+	})
+	r.GET("/api/user/urls", handler.UserURLsHandler)
+
+	get := func(user, target string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		request.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	shortURLs := func(w *httptest.ResponseRecorder) []string {
+		var response []UserURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		result := make([]string, 0, len(response))
+		for _, item := range response {
+			assert.False(t, item.CreatedAt.IsZero())
+			result = append(result, item.ShortURL)
+		}
+		return result
+	}
+
+	// Без параметров, как и раньше, все ссылки по возрастанию одной страницей
+	w := get("user1", "/api/user/urls")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Link"))
+	assert.Equal(t, []string{"http://localhost:8080/abc", "http://localhost:8080/def",
+		"http://localhost:8080/ghi", "http://localhost:8080/jkl"}, shortURLs(w))
+	assert.Contains(t, w.Body.String(), `"title":"Docs"`)
+
+	// Постраничный обход по заголовку Link
+	var pages [][]string
+	next := "/api/user/urls?limit=2&status=active"
+	for next != "" {
+		w = get("user1", next)
+		require.Equal(t, http.StatusOK, w.Code)
+		pages = append(pages, shortURLs(w))
+		next = ""
+		if link := w.Header().Get("Link"); link != "" {
+			require.True(t, strings.HasSuffix(link, `>; rel="next"`), link)
+			next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			assert.Contains(t, next, "limit=2")
+			assert.Contains(t, next, "status=active")
+		}
+	}
+	assert.Equal(t, [][]string{
+		{"http://localhost:8080/abc", "http://localhost:8080/def"},
+		{"http://localhost:8080/ghi"},
+	}, pages)
+
+	w = get("user1", "/api/user/urls?host=EXAMPLE.COM&order=desc")
+	assert.Equal(t, []string{"http://localhost:8080/ghi", "http://localhost:8080/abc"}, shortURLs(w))
+	w = get("user1", "/api/user/urls?contains=DOCS")
+	assert.Equal(t, []string{"http://localhost:8080/abc"}, shortURLs(w))
+
+	w = get("user1", "/api/user/urls?status=deleted")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var deleted []UserURLResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &deleted))
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, "http://localhost:8080/jkl", deleted[0].ShortURL)
+		assert.True(t, deleted[0].Deleted)
+		assert.NotNil(t, deleted[0].DeletedAt)
+	}
+	assert.Len(t, shortURLs(get("user1", "/api/user/urls?status=active")), 3)
+
+	assert.Equal(t, http.StatusNoContent, get("user2", "/api/user/urls").Code)
+	assert.Equal(t, http.StatusNoContent, get("user1", "/api/user/urls?host=example.info").Code)
+
+	for _, target := range []string{
+		"/api/user/urls?limit=0",
+		"/api/user/urls?limit=abc",
+		"/api/user/urls?limit=1001",
+		"/api/user/urls?order=random",
+		"/api/user/urls?status=removed",
+		"/api/user/urls?cursor=bad",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get("user1", target).Code, target)
+	}
+}
+
+func Test_restoreUserURLs(t *testing.T) {
+	storageInstance := storage.NewStorage()
+	storageShortener := services.NewShortenerService("http://localhost:8080", storageInstance)
+	handler := RestAPI{Shortener: storageShortener}
+	ctx := context.Background()
+	assert.NoError(t, storageInstance.Create(ctx, "https://example.com/", "abc", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.Create(ctx, "https://example.org/", "def", "user1", services.LinkOptions{}))
+	assert.NoError(t, storageInstance.DeleteURLs(ctx, "user1", []string{"abc", "def"}))
+	assert.NoError(t, storageInstance.Create(ctx, "https://example.org/", "ghi", "user2", services.LinkOptions{}))
+
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", c.GetHeader("X-User"))
+	})
+	r.POST("/api/user/urls/restore", handler.RestoreUserURLs)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(`["abc","def","missing"]`))
+	request.Header.Set("X-User", "user1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []RestoreResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []RestoreResponse{
+		{ShortURL: "http://localhost:8080/abc", Status: "restored"},
+		{ShortURL: "http://localhost:8080/def", Status: "conflict", Existing: "http://localhost:8080/ghi"},
+		{ShortURL: "http://localhost:8080/missing", Status: "not_found"},
+	}, response)
+
+	originalURL, err := storageInstance.Get(ctx, "abc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/", originalURL)
+
+	request = httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(`{"abc":true}`))
+	request.Header.Set("X-User", "user1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// passwordHeader — заголовок, в котором клиент может передать пароль ссылки вместо формы.
+const passwordHeader = "X-Link-Password"
+
+// UnlockLink проверяет пароль защищённой ссылки, отправленный формой, и перенаправляет
+// на оригинальный URL со статусом 303 See Other. При неверном пароле форма показывается снова.
+func (s *RestAPI) UnlockLink(c *gin.Context) {
+	redirect, err := s.Shortener.Visit(c.Request.Context(), c.Param("id"), unlock(c, c.PostForm("password")), passthrough(c))
+	if err != nil {
+		visitError(c, err, true)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusSeeOther, redirect.Location)
+}
+
+// unlock возвращает пароль ссылки, введённый клиентом, вместе с адресом клиента. Берётся адрес
+// соединения, а не заголовки прокси: их клиент может подделать, чтобы обойти ограничение попыток.
+func unlock(c *gin.Context, password string) services.Unlock {
+	return services.Unlock{Password: password, Client: c.RemoteIP()}
+}
+
+// visitError отвечает на ошибку перехода по ссылке. Если нужен пароль или он неверен,
+// а клиент пользуется формой, вместо пустого ответа показывается форма ввода пароля
+// из шаблона password.html. Форма отправляется POST-запросом на тот же адрес.
+func visitError(c *gin.Context, err error, form bool) {
+	code := errorStatus(err)
+	if !form || !(errors.Is(err, services.ErrPasswordRequired) || errors.Is(err, services.ErrWrongPassword)) {
+		c.Status(code)
+		return
+	}
+	message := ""
+	if errors.Is(err, services.ErrWrongPassword) {
+		message = "Неверный пароль"
+	}
+	c.Header("Cache-Control", "no-store")
+	c.HTML(code, "password.html", message)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewSuffix — знак в конце идентификатора, по которому вместо перехода показывается предпросмотр ссылки.
+const previewSuffix = "+"
+
+// previewPage — данные шаблона preview.html.
+type previewPage struct {
+	ShortURL    string    // Короткая ссылка без знака предпросмотра
+	OriginalURL string    // Оригинальный URL; пустой у ссылки с паролем
+	Title       string    // Название ссылки, заданное владельцем
+	CreatedAt   time.Time // Момент создания; нулевой, если неизвестен
+	Protected   bool      // Ссылка защищена паролем
+	Continue    string    // Адрес перехода с путём и параметрами исходного запроса
+}
+
+// previewID возвращает идентификатор ссылки, если запрос просит предпросмотр:
+// к идентификатору дописан знак "+" или передан параметр preview=1.
+func previewID(c *gin.Context) (string, bool) {
+	if shortID, ok := strings.CutSuffix(c.Param("id"), previewSuffix); ok {
+		return shortID, true
+	}
+	return c.Param("id"), c.Query("preview") == "1"
+}
+
+// previewLink показывает страницу предпросмотра ссылки из шаблона preview.html: оригинальный URL,
+// название, дату создания и кнопку продолжения. Переход при этом не засчитывается.
+// Недоступная ссылка отвечает теми же статусами, что и при переходе по ней.
+func (s *RestAPI) previewLink(c *gin.Context, shortID string) {
+	preview, err := s.Shortener.Preview(c.Request.Context(), shortID)
+	if err != nil {
+		c.Status(errorStatus(err))
+		return
+	}
+
+	continueURL := s.Shortener.ShortURL(shortID) + c.Param("path")
+	query := c.Request.URL.Query()
+	query.Del("preview")
+	if len(query) > 0 {
+		continueURL += "?" + query.Encode()
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.HTML(http.StatusOK, "preview.html", previewPage{
+		ShortURL:    s.Shortener.ShortURL(shortID),
+		OriginalURL: preview.OriginalURL,
+		Title:       preview.Title,
+		CreatedAt:   preview.CreatedAt,
+		Protected:   preview.Protected,
+		Continue:    continueURL,
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/qrcode"
+	"github.com/gin-gonic/gin"
+)
+
+// Форматы изображения QR-кода.
+const (
+	qrPNG = "image/png"
+	qrSVG = "image/svg+xml"
+)
+
+// Параметры изображения QR-кода по умолчанию и их допустимые пределы.
+const (
+	qrDefaultSize = 256  // Сторона изображения в пикселях
+	qrMinSize     = 64   // Наименьшая сторона изображения
+	qrMaxSize     = 2048 // Наибольшая сторона изображения
+	qrMaxMargin   = 16   // Наибольшее свободное поле в модулях
+)
+
+// QRCode возвращает QR-код полной короткой ссылки в формате PNG или SVG.
+// Формат задаётся параметром format (png или svg) или заголовком Accept; по умолчанию — PNG,
+// а если Accept не допускает ни один из форматов, возвращается статус 406 Not Acceptable.
+// Параметры size (сторона в пикселях, от 64 до 2048, по умолчанию 256), margin (свободное поле
+// в модулях, от 0 до 16, по умолчанию 4) и level (уровень коррекции L, M, Q или H, по умолчанию M)
+// необязательны; недопустимое значение отклоняется со статусом 400 Bad Request.
+// Недоступная ссылка отвечает теми же статусами, что и переход по ней.
+func (s *RestAPI) QRCode(c *gin.Context) {
+	format := c.NegotiateFormat(qrPNG, qrSVG)
+	switch c.Query("format") {
+	case "png":
+		format = qrPNG
+	case "svg":
+		format = qrSVG
+	case "":
+		if format == "" {
+			c.String(http.StatusNotAcceptable, "поддерживаются форматы image/png и image/svg+xml")
+			return
+		}
+	default:
+		c.String(http.StatusBadRequest, "параметр format должен быть png или svg")
+		return
+	}
+	size, err := qrParam(c, "size", qrDefaultSize, qrMinSize, qrMaxSize)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	margin, err := qrParam(c, "margin", qrcode.DefaultMargin, 0, qrMaxMargin)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	level, err := qrcode.ParseLevel(c.DefaultQuery("level", "M"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	code, err := s.Shortener.QRCode(c.Request.Context(), c.Param("id"), level)
+	if err != nil {
+		c.Status(errorStatus(err))
+		return
+	}
+
+	c.Header("Content-Type", format)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Vary", "Accept")
+	c.Status(http.StatusOK)
+	if format == qrSVG {
+		err = code.WriteSVG(c.Writer, size, margin)
+	} else {
+		err = code.WritePNG(c.Writer, size, margin)
+	}
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// qrParam возвращает целочисленный параметр запроса name в пределах от low до high
+// или значение def, если параметр не задан.
+func qrParam(c *gin.Context, name string, def, low, high int) (int, error) {
+	raw, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < low || value > high {
+		return 0, fmt.Errorf("параметр %s должен быть целым числом от %d до %d", name, low, high)
+	}
+	return value, nil
+}
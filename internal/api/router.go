@@ -1,16 +1,42 @@
 package api
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
 // Публичный метод SetRoutes
+// Первые сегменты зарегистрированных маршрутов резервируются в сервисе,
+// чтобы пользовательский псевдоним не перекрыл маршрут.
 func (s *RestAPI) SetRoutes(r *gin.Engine) {
 	r.POST("/", s.ShortenURLHandler)
 	r.POST("/api/shorten", s.ShortenURLJSON)
 	r.GET("/:id", s.RedirectToOriginalURL)
+	r.GET("/:id/*path", s.RedirectToOriginalURL)
+	r.POST("/:id", s.UnlockLink)
+	r.POST("/:id/*path", s.UnlockLink)
 	r.GET("/ping", s.Ping)
+	r.GET("/api/qr/:id", s.QRCode)
 	r.POST("/api/shorten/batch", s.ShortenURLsJSON)
 	r.GET("/api/user/urls", s.UserURLsHandler)
 	r.DELETE("/api/user/urls", s.DeleteUserUrls)
+	r.POST("/api/user/urls/restore", s.RestoreUserURLs)
+	r.PATCH("/api/user/urls/:id", s.UpdateUserURL)
+	r.GET("/api/user/urls/:id/history", s.UserURLHistory)
+
+	s.Shortener.ReserveAliases(routeSegments(r)...)
+}
+
+// routeSegments возвращает постоянные первые сегменты путей всех маршрутов r, например "api" и "ping".
+func routeSegments(r *gin.Engine) []string {
+	var segments []string
+	for _, route := range r.Routes() {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route.Path, "/"), "/")
+		if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return segments
 }
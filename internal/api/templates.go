@@ -0,0 +1,37 @@
+package api
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// templatesFS — встроенные HTML-шаблоны страниц сервиса: password.html и preview.html.
+//
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+// LoadTemplates разбирает встроенные HTML-шаблоны и, если задан каталог dir, файлы *.html из него.
+// Файл каталога заменяет встроенный шаблон с тем же именем, поэтому страницы можно
+// оформить по-своему, не пересобирая сервис.
+func LoadTemplates(dir string) (*template.Template, error) {
+	tmpl, err := template.ParseFS(templatesFS, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора встроенных шаблонов: %w", err)
+	}
+	if dir == "" {
+		return tmpl, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска шаблонов в %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		return tmpl, nil
+	}
+	if tmpl, err = tmpl.ParseFiles(files...); err != nil {
+		return nil, fmt.Errorf("ошибка разбора шаблонов из %s: %w", dir, err)
+	}
+	return tmpl, nil
+}
@@ -3,21 +3,29 @@ package app
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/api"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/config"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/dump"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
 	"github.com/Renal37/musthave_shortener_tpl.git/repository"
 )
 
 // App представляет собой структуру приложения, содержащую хранилище и конфигурацию.
 type App struct {
-	storageInstance *storage.Storage // Указатель на хранилище
-	config          *config.Config   // Указатель на конфигурацию
+	storageInstance *storage.Storage           // Указатель на хранилище в памяти
+	config          *config.Config             // Указатель на конфигурацию
+	store           services.Store             // Хранилище, выбранное при запуске
+	shortener       *services.ShortenerService // Сервис сокращения ссылок
+	keys            *services.KeyPool          // Пул идентификаторов, если он включён
+	sweeper         *services.Sweeper          // Удаление истёкших ссылок, если оно включено
 }
 
 // NewApp создает новый экземпляр приложения с заданным хранилищем и конфигурацией.
@@ -28,25 +36,84 @@ func NewApp(storageInstance *storage.Storage, config *config.Config) *App {
 	}
 }
 
-// Start запускает приложение: загружает данные из файла в хранилище и запускает REST API.
+// Start запускает приложение: инициализирует логгер, выбирает хранилище по конфигурации и запускает REST API.
+// Логгер инициализируется первым, до запуска фоновых воркеров, которые в него пишут.
+// При получении сигнала завершения сначала останавливает сервер, затем закрывает хранилище;
+// по сигналу SIGHUP перечитывает список заблокированных доменов.
 func (a *App) Start(ctx context.Context) error {
-	// Инициализируем базу данных
-	db, err := repository.InitDatabase(a.config.DBPath)
+	if err := logger.Initialize(a.config.LogLevel); err != nil {
+		fmt.Printf("Ошибка инициализации логгера: %v\n", err)
+		return err
+	}
+
+	store, err := a.openStore()
+	if err != nil {
+		fmt.Printf("Ошибка при инициализации хранилища: %v\n", err)
+		return err
+	}
+	a.store = store
+
+	ids, err := services.NewRandomIDGenerator(a.config.IDAlphabet, a.config.IDLength)
+	if err != nil {
+		fmt.Printf("Ошибка в настройках идентификаторов: %v\n", err)
+		a.Stop()
+		return err
+	}
+
+	urls, err := services.NewURLNormalizer(strings.Split(a.config.URLSchemes, ","), a.config.URLMaxLength, a.config.StripTracking)
 	if err != nil {
-		fmt.Printf("Ошибка при инициализации базы данных: %v\n", err)
+		fmt.Printf("Ошибка в настройках проверки URL: %v\n", err)
+		a.Stop()
 		return err
 	}
 
-	dbDNSTurn := true
-	if a.UseDatabase() {
-		err = dump.FillFromStorage(a.storageInstance, a.config.FilePath)
+	merge, err := services.ParseQueryMerge(a.config.QueryMerge)
+	if err != nil {
+		fmt.Printf("Ошибка в настройках передачи запроса: %v\n", err)
+		a.Stop()
+		return err
+	}
+
+	redirects, err := services.NewRedirectDefaults(a.config.RedirectCode, a.config.CacheMaxAge)
+	if err != nil {
+		fmt.Printf("Ошибка в настройках перенаправления: %v\n", err)
+		a.Stop()
+		return err
+	}
+
+	shortener := services.NewShortenerService(a.config.BaseURL, a.store)
+	shortener.IDs = ids
+	shortener.URLs = urls
+	shortener.Forwarding = services.Forwarding{Query: a.config.ForwardQuery, Path: a.config.ForwardPath, Merge: merge}
+	shortener.Redirects = redirects
+	shortener.Grace = a.config.RestoreGrace
+	if keyStore, ok := a.store.(services.KeyStore); ok && a.config.KeyPoolSize > 0 {
+		a.keys = services.NewKeyPool(keyStore, ids, a.config.KeyPoolSize)
+		shortener.IDs = a.keys
+	}
+	if a.config.Blocklist != "" {
+		blocklist, err := services.LoadBlocklist(a.config.Blocklist)
 		if err != nil {
-			fmt.Printf("Ошибка при заполнении хранилища: %v\n", err)
+			fmt.Printf("Ошибка при загрузке списка блокировки: %v\n", err)
+			a.Stop()
 			return err
 		}
-		dbDNSTurn = false
+		shortener.Blocklist = blocklist
+	}
+	shortener.ReserveAliases(strings.Split(a.config.Reserved, ",")...)
+	a.shortener = shortener
+	shortener.Timeouts = services.Timeouts{
+		Read:  a.config.ReadTimeout,
+		Write: a.config.WriteTimeout,
+		Ping:  a.config.PingTimeout,
+	}
+	if a.config.SweepInterval > 0 {
+		a.sweeper = services.NewSweeper(a.store, a.config.SweepInterval, a.config.ExpiredRetention)
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Канал для завершения API
 	apiDone := make(chan error, 1)
 
@@ -55,14 +122,11 @@ func (a *App) Start(ctx context.Context) error {
 		err := api.StartRestAPI(
 			ctx,
 			a.config.ServerAddr,
-			a.config.BaseURL,
-			a.config.LogLevel,
-			db,
-			dbDNSTurn,
-			a.storageInstance,
+			shortener,
 			a.config.EnableHTTPS,
 			a.config.CertFile,
 			a.config.KeyFile,
+			a.config.Templates,
 		)
 		apiDone <- err
 	}()
@@ -70,38 +134,99 @@ func (a *App) Start(ctx context.Context) error {
 	// Канал для системных сигналов
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signalChan)
+
+	// SIGHUP перечитывает список блокировки без перезапуска
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	defer signal.Stop(reloadChan)
 
 	// Обработка завершения через контекст, системные сигналы или ошибки API
-	select {
-	case <-ctx.Done():
-		fmt.Println("Контекст завершён")
-	case sig := <-signalChan:
-		fmt.Printf("Получен сигнал: %v. Завершаем работу...\n", sig)
-	case err := <-apiDone:
-		if err != nil {
-			fmt.Printf("Ошибка при запуске REST API: %v\n", err)
-			return err
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Контекст завершён")
+		case sig := <-signalChan:
+			fmt.Printf("Получен сигнал: %v. Завершаем работу...\n", sig)
+			cancel()
+			if err := <-apiDone; err != nil {
+				fmt.Printf("Ошибка при остановке REST API: %v\n", err)
+			}
+		case err := <-apiDone:
+			if err != nil {
+				fmt.Printf("Ошибка при запуске REST API: %v\n", err)
+				return err
+			}
+		case <-reloadChan:
+			a.reloadBlocklist()
+			continue
 		}
+		break
 	}
 
 	a.Stop()
 	return nil
 }
 
+// reloadBlocklist перечитывает список блокировки, если он включён. При ошибке продолжает действовать прежний список.
+func (a *App) reloadBlocklist() {
+	if a.shortener == nil || a.shortener.Blocklist == nil {
+		fmt.Println("Список блокировки не настроен")
+		return
+	}
+	if err := a.shortener.Blocklist.Reload(); err != nil {
+		fmt.Printf("Ошибка при перезагрузке списка блокировки, действует прежний: %v\n", err)
+		return
+	}
+	fmt.Printf("Список блокировки перезагружен: %d правил\n", a.shortener.Blocklist.Len())
+}
+
+// openStore выбирает хранилище по конфигурации: Postgres, если задан DBPath,
+// файл, если задан FilePath, иначе память.
+func (a *App) openStore() (services.Store, error) {
+	if !a.UseDatabase() {
+		db, err := repository.InitDatabase(a.config.DBPath)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	if a.config.FilePath != "" {
+		fileStore, err := dump.NewFileStore(a.storageInstance, a.config.FilePath, a.config.FileSync, a.config.FileCompact, a.config.FileRecover)
+		if err != nil {
+			return nil, err
+		}
+		return fileStore, nil
+	}
+	return a.storageInstance, nil
+}
+
 // UseDatabase возвращает true, если приложение использует базу данных.
 func (a *App) UseDatabase() bool {
 	return a.config.DBPath == ""
 }
 
-// Stop останавливает приложение: сохраняет данные из хранилища в файл.
+// Stop останавливает приложение: дожидается удаления ссылок, уже поставленных в очередь,
+// останавливает пул идентификаторов и удаление истёкших ссылок и закрывает хранилище, сбрасывая данные на диск, если это требуется.
 func (a *App) Stop() {
+	if a.shortener != nil {
+		fmt.Println("Завершаем удаление ссылок...")
+		a.shortener.Close()
+	}
+	if a.keys != nil {
+		a.keys.Close()
+	}
+	if a.sweeper != nil {
+		a.sweeper.Close()
+	}
+	closer, ok := a.store.(io.Closer)
+	if !ok {
+		return
+	}
 	fmt.Println("Сохраняем данные перед завершением работы...")
-	if a.UseDatabase() {
-		err := dump.Set(a.storageInstance, a.config.FilePath)
-		if err != nil {
-			fmt.Printf("Ошибка при сохранении данных: %v\n", err)
-		} else {
-			fmt.Println("Данные успешно сохранены.")
-		}
+	if err := closer.Close(); err != nil {
+		fmt.Printf("Ошибка при сохранении данных: %v\n", err)
+	} else {
+		fmt.Println("Данные успешно сохранены.")
 	}
 }
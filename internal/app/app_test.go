@@ -2,10 +2,12 @@ package app
 
 import (
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/config"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/dump"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
-	// "os"
 	// "syscall"
 	// "time"
 	// "context"
@@ -46,6 +48,23 @@ func TestUseDatabase(t *testing.T) {
 	assert.False(t, app.UseDatabase())
 }
 
+// TestOpenStore проверяет выбор хранилища по конфигурации
+func TestOpenStore(t *testing.T) {
+	mockStorage := storage.NewStorage()
+
+	app := NewApp(mockStorage, &config.Config{})
+	store, err := app.openStore()
+	assert.NoError(t, err)
+	assert.Equal(t, mockStorage, store)
+
+	app = NewApp(mockStorage, &config.Config{FilePath: t.TempDir() + "/test_data.json"})
+	store, err = app.openStore()
+	assert.NoError(t, err)
+	assert.IsType(t, &dump.FileStore{}, store)
+	app.store = store
+	app.Stop()
+}
+
 // func TestStart(t *testing.T) {
 // 	// Создаем фиктивную конфигурацию и хранилище
 // 	mockConfig := &config.Config{
@@ -95,3 +114,22 @@ func TestStop(t *testing.T) {
 	app := NewApp(mockStorage, mockConfig)
 	app.Stop()
 }
+
+// TestReloadBlocklist проверяет перезагрузку списка блокировки
+func TestReloadBlocklist(t *testing.T) {
+	path := t.TempDir() + "/blocklist.txt"
+	assert.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0o600))
+	blocklist, err := services.LoadBlocklist(path)
+	assert.NoError(t, err)
+
+	app := NewApp(storage.NewStorage(), &config.Config{})
+	app.reloadBlocklist() // Список не настроен
+	app.shortener = services.NewShortenerService("http://localhost", app.storageInstance)
+	app.shortener.Blocklist = blocklist
+
+	assert.NoError(t, os.WriteFile(path, []byte("bad.org\n"), 0o600))
+	app.reloadBlocklist()
+	assert.True(t, blocklist.Blocked("https://bad.org/"))
+	assert.False(t, blocklist.Blocked("https://evil.com/"))
+	app.Stop()
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -16,12 +17,39 @@ type Config struct {
 	BaseURL     string `env:"BASE_URL" json:"base_url"`                   // Базовый URL
 	LogLevel    string `env:"FLAG_LOG_LEVEL" json:"-"`                    // Уровень логирования (только флаг или env)
 	FilePath    string `env:"FILE_STORAGE_PATH" json:"file_storage_path"` // Путь к файлу для хранения
+	FileSync    string `env:"FILE_SYNC_POLICY" json:"file_sync_policy"`   // Политика синхронизации журнала: always, interval или never
+	FileCompact int64  `env:"FILE_COMPACT_SIZE" json:"file_compact_size"` // Размер журнала в байтах, после которого он сжимается
+	FileRecover bool   `env:"FILE_RECOVER" json:"file_recover"`           // Пропускать повреждённые записи журнала вместо ошибки запуска
 	DBPath      string `env:"DB_PATH" json:"database_dsn"`                // Путь к базе данных
 	EnablePprof string `env:"ENABLE_PPROF" json:"-"`                      // Включить pprof (только флаг или env)
 	EnableHTTPS bool   `env:"ENABLE_HTTPS" json:"enable_https"`           // Включить HTTPS
 	CertFile    string `env:"CERT_FILE" json:"cert_file"`                 // Путь к файлу сертификата
 	KeyFile     string `env:"KEY_FILE" json:"key_file"`                   // Путь к файлу ключа
+	Templates   string `env:"TEMPLATES_DIR" json:"templates_dir"`         // Каталог HTML-шаблонов, заменяющих встроенные; пустой — только встроенные
 	ConfigPath  string `env:"CONFIG" json:"-"`                            // Путь к файлу конфигурации (только флаг или env)
+	IDLength    int    `env:"ID_LENGTH" json:"id_length"`                 // Длина короткого идентификатора
+	IDAlphabet  string `env:"ID_ALPHABET" json:"id_alphabet"`             // Алфавит короткого идентификатора; пустой — base62
+	Reserved    string `env:"RESERVED_ALIASES" json:"reserved_aliases"`   // Слова через запятую, запрещённые в качестве псевдонимов
+	KeyPoolSize int    `env:"KEY_POOL_SIZE" json:"key_pool_size"`         // Размер пула заранее созданных идентификаторов; 0 отключает пул
+
+	URLSchemes    string `env:"URL_SCHEMES" json:"url_schemes"`       // Схемы через запятую, допустимые в оригинальных URL
+	URLMaxLength  int    `env:"URL_MAX_LENGTH" json:"url_max_length"` // Наибольшая длина оригинального URL
+	StripTracking bool   `env:"STRIP_TRACKING" json:"strip_tracking"` // Удалять из оригинальных URL параметры отслеживания (utm_* и т. п.)
+	Blocklist     string `env:"BLOCKLIST_FILE" json:"blocklist_file"` // Путь к файлу списка заблокированных доменов; пустой отключает блокировку
+
+	ForwardQuery bool   `env:"FORWARD_QUERY" json:"forward_query"` // Передавать параметры запроса перехода на оригинальный URL
+	ForwardPath  bool   `env:"FORWARD_PATH" json:"forward_path"`   // Дописывать путь после идентификатора к оригинальному URL
+	QueryMerge   string `env:"QUERY_MERGE" json:"query_merge"`     // Правило для одноимённых параметров: target, request или append
+	RedirectCode int    `env:"REDIRECT_CODE" json:"redirect_code"` // Статус перенаправления по умолчанию: 301, 302, 307 или 308
+	CacheMaxAge  int    `env:"CACHE_MAX_AGE" json:"cache_max_age"` // Время кеширования перенаправления по умолчанию в секундах; 0 — без кеширования
+
+	ReadTimeout  time.Duration `env:"STORE_READ_TIMEOUT" json:"-"`  // Предельное время чтения из хранилища (только флаг или env)
+	WriteTimeout time.Duration `env:"STORE_WRITE_TIMEOUT" json:"-"` // Предельное время записи в хранилище (только флаг или env)
+	PingTimeout  time.Duration `env:"STORE_PING_TIMEOUT" json:"-"`  // Предельное время проверки хранилища (только флаг или env)
+
+	SweepInterval    time.Duration `env:"SWEEP_INTERVAL" json:"-"`    // Период удаления истёкших ссылок; 0 отключает удаление (только флаг или env)
+	ExpiredRetention time.Duration `env:"EXPIRED_RETENTION" json:"-"` // Время, в течение которого истёкшая ссылка отвечает 410 Gone (только флаг или env)
+	RestoreGrace     time.Duration `env:"RESTORE_GRACE" json:"-"`     // Время после удаления, в течение которого ссылку можно восстановить; 0 — удаление сразу окончательное (только флаг или env)
 }
 
 var once sync.Once
@@ -54,6 +82,15 @@ func mergeConfigs(base, fileConfig *Config) *Config {
 	if fileConfig.FilePath != "" {
 		base.FilePath = fileConfig.FilePath
 	}
+	if fileConfig.FileSync != "" {
+		base.FileSync = fileConfig.FileSync
+	}
+	if fileConfig.FileCompact != 0 {
+		base.FileCompact = fileConfig.FileCompact
+	}
+	if fileConfig.FileRecover {
+		base.FileRecover = fileConfig.FileRecover
+	}
 	if fileConfig.DBPath != "" {
 		base.DBPath = fileConfig.DBPath
 	}
@@ -69,6 +106,48 @@ func mergeConfigs(base, fileConfig *Config) *Config {
 	if fileConfig.KeyFile != "" {
 		base.KeyFile = fileConfig.KeyFile
 	}
+	if fileConfig.Templates != "" {
+		base.Templates = fileConfig.Templates
+	}
+	if fileConfig.IDLength != 0 {
+		base.IDLength = fileConfig.IDLength
+	}
+	if fileConfig.IDAlphabet != "" {
+		base.IDAlphabet = fileConfig.IDAlphabet
+	}
+	if fileConfig.Reserved != "" {
+		base.Reserved = fileConfig.Reserved
+	}
+	if fileConfig.KeyPoolSize != 0 {
+		base.KeyPoolSize = fileConfig.KeyPoolSize
+	}
+	if fileConfig.URLSchemes != "" {
+		base.URLSchemes = fileConfig.URLSchemes
+	}
+	if fileConfig.URLMaxLength != 0 {
+		base.URLMaxLength = fileConfig.URLMaxLength
+	}
+	if fileConfig.StripTracking {
+		base.StripTracking = fileConfig.StripTracking
+	}
+	if fileConfig.Blocklist != "" {
+		base.Blocklist = fileConfig.Blocklist
+	}
+	if fileConfig.ForwardQuery {
+		base.ForwardQuery = fileConfig.ForwardQuery
+	}
+	if fileConfig.ForwardPath {
+		base.ForwardPath = fileConfig.ForwardPath
+	}
+	if fileConfig.QueryMerge != "" {
+		base.QueryMerge = fileConfig.QueryMerge
+	}
+	if fileConfig.RedirectCode != 0 {
+		base.RedirectCode = fileConfig.RedirectCode
+	}
+	if fileConfig.CacheMaxAge != 0 {
+		base.CacheMaxAge = fileConfig.CacheMaxAge
+	}
 	return base
 }
 
@@ -79,11 +158,38 @@ func InitConfig() *Config {
 		BaseURL:     "http://localhost:8080", // Значение по умолчанию для базового URL
 		LogLevel:    "info",                  // Значение по умолчанию для уровня логирования
 		FilePath:    "short-url-db.json",     // Значение по умолчанию для пути к файлу
+		FileSync:    "interval",              // Значение по умолчанию для синхронизации журнала
+		FileCompact: 10 << 20,                // Значение по умолчанию для порога сжатия журнала (10 МиБ)
+		FileRecover: false,                   // Значение по умолчанию для восстановления журнала
 		DBPath:      "",                      // Значение по умолчанию для пути к базе данных
 		EnablePprof: "false",                 // Значение по умолчанию для pprof
 		EnableHTTPS: false,                   // Значение по умолчанию для HTTPS
 		CertFile:    "cert.pem",              // Значение по умолчанию для сертификата
 		KeyFile:     "key.pem",               // Значение по умолчанию для ключа
+		Templates:   "",                      // Значение по умолчанию для каталога шаблонов (только встроенные)
+		IDLength:    8,                       // Значение по умолчанию для длины идентификатора
+		IDAlphabet:  "",                      // Значение по умолчанию для алфавита идентификатора (base62)
+		Reserved:    "admin,static,health",   // Значение по умолчанию для зарезервированных псевдонимов
+		KeyPoolSize: 0,                       // Значение по умолчанию для размера пула идентификаторов (пул отключён)
+
+		URLSchemes:    "http,https", // Значение по умолчанию для допустимых схем URL
+		URLMaxLength:  2048,         // Значение по умолчанию для наибольшей длины URL
+		StripTracking: false,        // Значение по умолчанию для удаления параметров отслеживания
+		Blocklist:     "",           // Значение по умолчанию для списка заблокированных доменов (без блокировки)
+
+		ForwardQuery: false,    // Значение по умолчанию для передачи параметров запроса
+		ForwardPath:  false,    // Значение по умолчанию для передачи пути
+		QueryMerge:   "target", // Значение по умолчанию для объединения параметров запроса
+		RedirectCode: 307,      // Значение по умолчанию для статуса перенаправления
+		CacheMaxAge:  0,        // Значение по умолчанию для времени кеширования перенаправления
+
+		ReadTimeout:  3 * time.Second, // Значение по умолчанию для чтения из хранилища
+		WriteTimeout: 5 * time.Second, // Значение по умолчанию для записи в хранилище
+		PingTimeout:  1 * time.Second, // Значение по умолчанию для проверки хранилища
+
+		SweepInterval:    time.Minute,        // Значение по умолчанию для периода удаления истёкших ссылок
+		ExpiredRetention: 24 * time.Hour,     // Значение по умолчанию для хранения истёкших ссылок
+		RestoreGrace:     7 * 24 * time.Hour, // Значение по умолчанию для времени восстановления удалённых ссылок
 	}
 
 	// Определяем флаги командной строки
@@ -92,12 +198,35 @@ func InitConfig() *Config {
 		flag.StringVar(&config.BaseURL, "b", config.BaseURL, "base URL")
 		flag.StringVar(&config.LogLevel, "c", config.LogLevel, "log level")
 		flag.StringVar(&config.FilePath, "f", config.FilePath, "path to file for storage")
+		flag.StringVar(&config.FileSync, "file-sync", config.FileSync, "file storage fsync policy (always/interval/never)")
+		flag.Int64Var(&config.FileCompact, "file-compact-size", config.FileCompact, "file storage size in bytes that triggers compaction")
+		flag.BoolVar(&config.FileRecover, "file-recover", config.FileRecover, "skip corrupt file storage records instead of failing (true/false)")
 		flag.StringVar(&config.DBPath, "d", config.DBPath, "path to database")
 		flag.StringVar(&config.EnablePprof, "e", config.EnablePprof, "enable pprof")
 		flag.BoolVar(&config.EnableHTTPS, "s", config.EnableHTTPS, "enable https (true/false)")
 		flag.StringVar(&config.CertFile, "cert", config.CertFile, "path to the SSL certificate file")
 		flag.StringVar(&config.KeyFile, "key", config.KeyFile, "path to the SSL key file")
+		flag.StringVar(&config.Templates, "templates", config.Templates, "directory with HTML templates overriding the embedded ones")
 		flag.StringVar(&config.ConfigPath, "config", config.ConfigPath, "path to config file")
+		flag.IntVar(&config.IDLength, "id-length", config.IDLength, "short link identifier length")
+		flag.StringVar(&config.IDAlphabet, "id-alphabet", config.IDAlphabet, "short link identifier alphabet (base62 if empty)")
+		flag.StringVar(&config.Reserved, "reserved-aliases", config.Reserved, "comma-separated words that cannot be used as aliases")
+		flag.IntVar(&config.KeyPoolSize, "key-pool-size", config.KeyPoolSize, "number of pre-generated short link identifiers (0 disables the pool)")
+		flag.StringVar(&config.URLSchemes, "url-schemes", config.URLSchemes, "comma-separated URL schemes allowed for shortening")
+		flag.IntVar(&config.URLMaxLength, "url-max-length", config.URLMaxLength, "maximum original URL length")
+		flag.BoolVar(&config.StripTracking, "strip-tracking", config.StripTracking, "remove tracking query parameters such as utm_* from URLs (true/false)")
+		flag.StringVar(&config.Blocklist, "blocklist", config.Blocklist, "path to the blocked domains file, reloaded on SIGHUP")
+		flag.BoolVar(&config.ForwardQuery, "forward-query", config.ForwardQuery, "pass redirect query parameters to the original URL by default (true/false)")
+		flag.BoolVar(&config.ForwardPath, "forward-path", config.ForwardPath, "append the path after the short ID to the original URL by default (true/false)")
+		flag.StringVar(&config.QueryMerge, "query-merge", config.QueryMerge, "policy for query parameters present in both URLs (target/request/append)")
+		flag.IntVar(&config.RedirectCode, "redirect-code", config.RedirectCode, "default redirect status code (301/302/307/308)")
+		flag.IntVar(&config.CacheMaxAge, "cache-max-age", config.CacheMaxAge, "default redirect Cache-Control max-age in seconds (0 disables caching)")
+		flag.DurationVar(&config.ReadTimeout, "read-timeout", config.ReadTimeout, "storage read timeout")
+		flag.DurationVar(&config.WriteTimeout, "write-timeout", config.WriteTimeout, "storage write timeout")
+		flag.DurationVar(&config.PingTimeout, "ping-timeout", config.PingTimeout, "storage ping timeout")
+		flag.DurationVar(&config.SweepInterval, "sweep-interval", config.SweepInterval, "expired links purge interval (0 disables purging)")
+		flag.DurationVar(&config.ExpiredRetention, "expired-retention", config.ExpiredRetention, "how long expired links answer 410 Gone before being purged")
+		flag.DurationVar(&config.RestoreGrace, "restore-grace", config.RestoreGrace, "how long deleted links can be restored (0 makes deletion permanent)")
 		flag.Parse() // Парсим флаги командной строки
 	})
 
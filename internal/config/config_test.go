@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,11 +16,33 @@ func TestInitConfig_Defaults(t *testing.T) {
 	assert.Equal(t, "http://localhost:8080", config.BaseURL)
 	assert.Equal(t, "info", config.LogLevel)
 	assert.Equal(t, "short-url-db.json", config.FilePath)
+	assert.Equal(t, "interval", config.FileSync)
+	assert.Equal(t, int64(10<<20), config.FileCompact)
 	assert.Equal(t, "", config.DBPath)
 	assert.Equal(t, "false", config.EnablePprof)
 	assert.Equal(t, false, config.EnableHTTPS)
 	assert.Equal(t, "cert.pem", config.CertFile)
 	assert.Equal(t, "key.pem", config.KeyFile)
+	assert.Equal(t, "", config.Templates)
+	assert.Equal(t, 3*time.Second, config.ReadTimeout)
+	assert.Equal(t, 5*time.Second, config.WriteTimeout)
+	assert.Equal(t, time.Second, config.PingTimeout)
+	assert.Equal(t, time.Minute, config.SweepInterval)
+	assert.Equal(t, 24*time.Hour, config.ExpiredRetention)
+	assert.Equal(t, 7*24*time.Hour, config.RestoreGrace)
+	assert.Equal(t, 8, config.IDLength)
+	assert.Empty(t, config.IDAlphabet)
+	assert.Equal(t, "admin,static,health", config.Reserved)
+	assert.Equal(t, 0, config.KeyPoolSize)
+	assert.Equal(t, "http,https", config.URLSchemes)
+	assert.Equal(t, 2048, config.URLMaxLength)
+	assert.False(t, config.StripTracking)
+	assert.Empty(t, config.Blocklist)
+	assert.False(t, config.ForwardQuery)
+	assert.False(t, config.ForwardPath)
+	assert.Equal(t, "target", config.QueryMerge)
+	assert.Equal(t, 307, config.RedirectCode)
+	assert.Zero(t, config.CacheMaxAge)
 }
 
 func TestInitConfig_WithEnvVars(t *testing.T) {
@@ -86,7 +109,8 @@ func TestInitConfig_WithConfigFile(t *testing.T) {
 		"base_url": "http://192.168.1.1:8080",
 		"enable_https": true,
 		"cert_file": "custom-cert.pem",
-		"key_file": "custom-key.pem"
+		"key_file": "custom-key.pem",
+		"templates_dir": "custom-templates"
 	}`
 	_, err = tempFile.WriteString(configData)
 	assert.NoError(t, err)
@@ -103,6 +127,7 @@ func TestInitConfig_WithConfigFile(t *testing.T) {
 	assert.Equal(t, true, config.EnableHTTPS)
 	assert.Equal(t, "custom-cert.pem", config.CertFile)
 	assert.Equal(t, "custom-key.pem", config.KeyFile)
+	assert.Equal(t, "custom-templates", config.Templates)
 
 	// Удаляем переменную окружения
 	os.Unsetenv("CONFIG")
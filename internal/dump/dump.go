@@ -2,81 +2,338 @@ package dump
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
 )
 
-// Memory представляет собой структуру для хранения сервисов и файла.
-type Memory struct {
-	Storage *services.ShortenerService // Указатель на сервис сокращения URL
-	File    *os.File                   // Указатель на файл для хранения данных
+// FormatVersion — текущая версия формата файла хранилища: заголовок и записи с контрольными суммами.
+// Необязательные поля записи добавляются без смены версии: в старых записях их нет,
+// что означает значение по умолчанию.
+const FormatVersion = 2
+
+// formatName — имя формата, записываемое в заголовок файла.
+const formatName = "shortener-url-storage"
+
+// ErrCorrupt возвращается, если в файле найдена повреждённая запись.
+var ErrCorrupt = errors.New("повреждённая запись в файле хранилища")
+
+// fileHeader — первая строка файла, описывающая его формат.
+type fileHeader struct {
+	Format  string `json:"format"`  // Имя формата
+	Version int    `json:"version"` // Версия формата
 }
 
 // ShortCollector представляет собой структуру для хранения данных о сокращенных URL.
+// Запись с признаком Removed удаляет ссылку ShortURL из хранилища целиком.
 type ShortCollector struct {
-	NumberUUID  string `json:"uuid"`         // UUID
-	ShortURL    string `json:"short_url"`    // Сокращенный URL
-	OriginalURL string `json:"original_url"` // Оригинальный URL
+	NumberUUID   string     `json:"uuid"`                    // UUID
+	ShortURL     string     `json:"short_url"`               // Сокращенный URL
+	OriginalURL  string     `json:"original_url"`            // Оригинальный URL
+	UserID       string     `json:"user_id"`                 // Идентификатор владельца ссылки
+	DeletedFlag  bool       `json:"is_deleted"`              // Признак удаления ссылки
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`    // Момент удаления ссылки
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`    // Момент истечения срока действия ссылки
+	MaxClicks    int        `json:"max_clicks,omitempty"`    // Допустимое количество переходов
+	ClicksLeft   int        `json:"clicks_left,omitempty"`   // Оставшееся количество переходов
+	PasswordHash string     `json:"password_hash,omitempty"` // Солёный хеш пароля ссылки
+	ForwardQuery *bool      `json:"forward_query,omitempty"` // Передавать параметры запроса перехода
+	ForwardPath  *bool      `json:"forward_path,omitempty"`  // Дописывать путь после идентификатора
+	RedirectCode int        `json:"redirect_code,omitempty"` // HTTP-статус перенаправления
+	CacheMaxAge  *int       `json:"cache_max_age,omitempty"` // Время кеширования перенаправления в секундах
+	Title        string     `json:"title,omitempty"`         // Название ссылки
+	CreatedAt    *time.Time `json:"created_at,omitempty"`    // Момент создания ссылки
+
+	History []historyEntry `json:"history,omitempty"` // Прежние оригинальные URL ссылки
+
+	Removed  bool   `json:"removed,omitempty"` // Ссылка удалена из хранилища
+	Checksum uint32 `json:"checksum"`          // CRC32 записи, вычисленная при нулевом значении этого поля
+}
+
+// historyEntry — прежний оригинальный URL ссылки в записи файла.
+type historyEntry struct {
+	OriginalURL string    `json:"original_url"` // Оригинальный URL до изменения
+	ChangedAt   time.Time `json:"changed_at"`   // Момент изменения
+}
+
+// LoadReport описывает результат загрузки файла хранилища.
+type LoadReport struct {
+	Version      int   // Версия формата файла
+	Loaded       int   // Количество загруженных записей
+	Corrupt      []int // Номера строк с пропущенными повреждёнными записями
+	TornTail     bool  // Последняя строка записана не полностью (обрыв записи при сбое)
+	NeedsRewrite bool  // Файл нужно переписать перед дозаписью: нет заголовка, старая версия или повреждения
+}
+
+// newCollector создаёт запись файла с порядковым номером seq.
+func newCollector(seq int, record storage.URLRecord) ShortCollector {
+	event := ShortCollector{
+		NumberUUID:   strconv.Itoa(seq),
+		ShortURL:     record.ShortURL,
+		OriginalURL:  record.OriginalURL,
+		UserID:       record.UserID,
+		DeletedFlag:  record.DeletedFlag,
+		MaxClicks:    record.MaxClicks,
+		ClicksLeft:   record.ClicksLeft,
+		PasswordHash: record.PasswordHash,
+		ForwardQuery: record.ForwardQuery,
+		ForwardPath:  record.ForwardPath,
+		RedirectCode: record.RedirectCode,
+		CacheMaxAge:  record.CacheMaxAge,
+		Title:        record.Title,
+	}
+	for _, entry := range record.History {
+		event.History = append(event.History, historyEntry{OriginalURL: entry.OriginalURL, ChangedAt: entry.ChangedAt.UTC()})
+	}
+	if !record.ExpiresAt.IsZero() {
+		expiresAt := record.ExpiresAt.UTC()
+		event.ExpiresAt = &expiresAt
+	}
+	if !record.DeletedAt.IsZero() {
+		deletedAt := record.DeletedAt.UTC()
+		event.DeletedAt = &deletedAt
+	}
+	if !record.CreatedAt.IsZero() {
+		createdAt := record.CreatedAt.UTC()
+		event.CreatedAt = &createdAt
+	}
+	return event
+}
+
+// newTombstone создаёт запись файла с порядковым номером seq, удаляющую ссылку shortURL.
+func newTombstone(seq int, shortURL string) ShortCollector {
+	return ShortCollector{NumberUUID: strconv.Itoa(seq), ShortURL: shortURL, Removed: true}
+}
+
+// record возвращает ссылку, описанную записью файла.
+func (c ShortCollector) record() storage.URLRecord {
+	record := storage.URLRecord{
+		ShortURL:     c.ShortURL,
+		OriginalURL:  c.OriginalURL,
+		UserID:       c.UserID,
+		DeletedFlag:  c.DeletedFlag,
+		MaxClicks:    c.MaxClicks,
+		ClicksLeft:   c.ClicksLeft,
+		PasswordHash: c.PasswordHash,
+		ForwardQuery: c.ForwardQuery,
+		ForwardPath:  c.ForwardPath,
+		RedirectCode: c.RedirectCode,
+		CacheMaxAge:  c.CacheMaxAge,
+		Title:        c.Title,
+	}
+	for _, entry := range c.History {
+		record.History = append(record.History, services.HistoryEntry{OriginalURL: entry.OriginalURL, ChangedAt: entry.ChangedAt})
+	}
+	if c.ExpiresAt != nil {
+		record.ExpiresAt = *c.ExpiresAt
+	}
+	if c.DeletedAt != nil {
+		record.DeletedAt = *c.DeletedAt
+	}
+	if c.CreatedAt != nil {
+		record.CreatedAt = *c.CreatedAt
+	}
+	return record
+}
+
+// checksum вычисляет контрольную сумму записи без учёта поля Checksum.
+func (c ShortCollector) checksum() (uint32, error) {
+	c.Checksum = 0
+	data, err := json.Marshal(c)
+	if err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(data), nil
 }
 
 // FillFromStorage заполняет хранилище данными из указанного файла.
+// Повреждённая запись прерывает загрузку с ошибкой ErrCorrupt; для пропуска таких записей используйте Load.
 func FillFromStorage(storageInstance *storage.Storage, filePath string) error {
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666) // Открываем файл
+	_, err := Load(storageInstance, filePath, false)
+	return err
+}
+
+// Load заполняет хранилище данными из файла filePath и возвращает отчёт о загрузке.
+// В режиме восстановления recover повреждённые записи пропускаются и перечисляются в отчёте,
+// иначе первая из них прерывает загрузку с ошибкой ErrCorrupt.
+// Не дописанная при сбое последняя строка не считается повреждением и отмечается в отчёте флагом TornTail.
+func Load(storageInstance *storage.Storage, filePath string, recover bool) (LoadReport, error) {
+	report := LoadReport{Version: FormatVersion}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDONLY, 0666) // Открываем файл
 	if err != nil {
-		return err // Возвращаем ошибку, если не удалось открыть файл
+		return report, err // Возвращаем ошибку, если не удалось открыть файл
 	}
-	defer file.Close()                  // Закрываем файл по завершении
-	newDecoder := json.NewDecoder(file) // Создаем новый декодер JSON
-	maxUUID := 0                        // Переменная для отслеживания максимального UUID
+	defer file.Close() // Закрываем файл по завершении
 
-	// Читаем данные из файла
-	for {
-		var event ShortCollector
-		if err := newDecoder.Decode(&event); err != nil {
-			if err == io.EOF {
+	reader := bufio.NewReader(file)
+	firstLine := true
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return report, err
+		}
+		complete := err == nil
+		if len(bytes.TrimSpace(line)) == 0 {
+			if !complete {
 				break // Прерываем цикл, если достигнут конец файла
+			}
+			continue
+		}
+
+		if firstLine {
+			firstLine = false
+			// Файл без заголовка записан в формате первой версии
+			var header fileHeader
+			if json.Unmarshal(line, &header) != nil || header.Format != formatName {
+				report.Version = 1
+				report.NeedsRewrite = true
+			} else if header.Version > FormatVersion {
+				return report, fmt.Errorf("неподдерживаемая версия формата файла %s: %d", filePath, header.Version)
 			} else {
-				fmt.Println("error decode JSON:", err)
-				break // Прерываем цикл, если произошла ошибка
+				report.Version = header.Version
+				report.NeedsRewrite = header.Version < FormatVersion
+				if !complete {
+					report.NeedsRewrite = true
+					break
+				}
+				continue
 			}
 		}
-		maxUUID += 1                                           // Увеличиваем счетчик UUID
-		storageInstance.Set(event.OriginalURL, event.ShortURL) // Сохраняем данные в хранилище
+
+		event, ok := decodeEvent(line, report.Version)
+		switch {
+		case ok && event.Removed:
+			storageInstance.Remove(event.ShortURL)
+			if !complete {
+				report.NeedsRewrite = true
+			}
+		case ok:
+			storageInstance.SetRecord(event.record()) // Сохраняем данные в хранилище
+			report.Loaded++
+			if !complete {
+				report.NeedsRewrite = true // Перед дозаписью нужен перенос строки
+			}
+		case !complete:
+			report.TornTail = true
+			report.NeedsRewrite = true
+		case recover:
+			report.Corrupt = append(report.Corrupt, lineNumber)
+			report.NeedsRewrite = true
+		default:
+			return report, fmt.Errorf("%w: %s, строка %d", ErrCorrupt, filePath, lineNumber)
+		}
+		if !complete {
+			break
+		}
+	}
+	if firstLine {
+		report.NeedsRewrite = true // В пустой файл нужно записать заголовок
+	}
+	return report, nil
+}
+
+// decodeEvent разбирает строку файла версии version и проверяет её контрольную сумму.
+func decodeEvent(line []byte, version int) (ShortCollector, bool) {
+	var event ShortCollector
+	if err := json.Unmarshal(line, &event); err != nil {
+		return event, false
+	}
+	switch version {
+	case 1:
+		// Файл без заголовка и контрольных сумм
+		return event, true
+	default:
+		sum, err := event.checksum()
+		return event, err == nil && sum == event.Checksum
 	}
-	return nil
 }
 
-// Set сохраняет данные из хранилища в указанный файл.
+// Set атомарно сохраняет данные из хранилища в указанный файл.
+// Данные записываются во временный файл в том же каталоге, который затем заменяет filePath,
+// поэтому сбой во время записи оставляет прежнюю версию файла нетронутой.
 func Set(storageInstance *storage.Storage, filePath string) error {
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666) // Открываем файл
+	return replaceFile(filePath, func(file *os.File) error {
+		return writeSnapshot(storageInstance, file)
+	})
+}
+
+// replaceFile атомарно заменяет файл filePath: write записывает содержимое во временный файл
+// в том же каталоге, который затем переименовывается поверх filePath.
+func replaceFile(filePath string, write func(file *os.File) error) error {
+	dir, name := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := os.CreateTemp(dir, name+".tmp*") // Создаём временный файл
 	if err != nil {
-		return err // Возвращаем ошибку, если не удалось открыть файл
+		return err // Возвращаем ошибку, если не удалось создать файл
 	}
-	defer file.Close() // Закрываем файл по завершении
-	maxUUID := 0       // Переменная для отслеживания максимального UUID
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath) // После переименования удаление ничего не делает
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0666); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
 
-	// Сохраняем данные из хранилища в файл
-	for shortURL, originalURL := range storageInstance.URLs {
+// writeSnapshot записывает заголовок и согласованный снимок хранилища в файл и сбрасывает его на диск.
+func writeSnapshot(storageInstance *storage.Storage, file *os.File) error {
+	writer := bufio.NewWriter(file) // Создаем буферизованный писатель
+	if err := writeHeader(writer); err != nil {
+		return err
+	}
+	maxUUID := 0 // Переменная для отслеживания максимального UUID
+	for _, record := range storageInstance.Snapshot() {
 		maxUUID += 1 // Увеличиваем счетчик UUID
-		ShortCollector := ShortCollector{
-			strconv.Itoa(maxUUID), // Преобразуем UUID в строку
-			shortURL,
-			originalURL,
+		event := newCollector(maxUUID, record)
+		if err := writeEvent(&event, writer); err != nil { // Записываем событие в файл
+			return err
 		}
-		writer := bufio.NewWriter(file)           // Создаем буферизованный писатель
-		err = writeEvent(&ShortCollector, writer) // Записываем событие в файл
 	}
-	return err
+	return file.Sync() // Сбрасываем данные на диск
+}
+
+// writeHeader записывает заголовок файла текущей версии формата.
+func writeHeader(writer *bufio.Writer) error {
+	data, err := json.Marshal(fileHeader{Format: formatName, Version: FormatVersion})
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return writer.Flush()
 }
 
-// writeEvent записывает событие в буферизованный писатель.
+// writeEvent вычисляет контрольную сумму события и записывает его в буферизованный писатель.
 func writeEvent(ShortCollector *ShortCollector, writer *bufio.Writer) error {
+	sum, err := ShortCollector.checksum()
+	if err != nil {
+		return err // Возвращаем ошибку, если произошла ошибка кодирования
+	}
+	ShortCollector.Checksum = sum
+
 	data, err := json.Marshal(&ShortCollector) // Кодируем структуру в JSON
 	if err != nil {
 		return err // Возвращаем ошибку, если произошла ошибка кодирования
@@ -95,3 +352,13 @@ func writeEvent(ShortCollector *ShortCollector, writer *bufio.Writer) error {
 	// Записываем буфер в файл
 	return writer.Flush()
 }
+
+// syncDir синхронизирует каталог, чтобы переименование файла пережило сбой питания.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
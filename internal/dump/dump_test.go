@@ -1,14 +1,19 @@
 package dump_test
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/dump"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Определение структуры ShortCollector для тестовых данных
@@ -64,3 +69,331 @@ func TestSet_EdgeCases(t *testing.T) {
 	err = dump.Set(storageInstance, tempFile.Name())
 	assert.NoError(t, err, "Не ожидалось ошибки при записи длинного URL")
 }
+
+// Тест воспроизведения журнала после повторного открытия без сохранения при остановке
+func TestFileStore_Reopen(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	forward, maxAge := false, 3600
+	opts := services.LinkOptions{PasswordHash: "hash", ForwardQuery: &forward, RedirectCode: 301, CacheMaxAge: &maxAge, Title: "Пример"}
+	require.NoError(t, fileStore.Create(context.Background(), "http://example.com", "abc", "user1", opts))
+	require.NoError(t, fileStore.Create(context.Background(), "http://example.org", "def", "user1", services.LinkOptions{}))
+	require.NoError(t, fileStore.DeleteURLs(context.Background(), "user1", []string{"def"}))
+	require.NoError(t, fileStore.Create(context.Background(), "http://example.net", "ghi", "user1", services.LinkOptions{}))
+	require.NoError(t, fileStore.UpdateURL(context.Background(), "user1", "ghi", "http://example.net/new"))
+	require.NoError(t, fileStore.DeleteURLs(context.Background(), "user1", []string{"ghi"}))
+	restored := []services.RestoreItem{{ShortURL: "ghi"}}
+	require.NoError(t, fileStore.RestoreURLs(context.Background(), "user1", restored, time.Now().Add(-time.Hour)))
+	require.Equal(t, services.RestoreRestored, restored[0].Status)
+
+	// Журнал не закрываем: имитируем аварийное завершение процесса
+	reopened, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	defer reopened.Close()
+	originalURL, err := reopened.Get(context.Background(), "abc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", originalURL)
+	_, reopenedOpts, err := reopened.Options(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, opts, reopenedOpts)
+	created, _ := fileStore.Record("abc")
+	reopenedRecord, _ := reopened.Record("abc")
+	assert.True(t, created.CreatedAt.Equal(reopenedRecord.CreatedAt))
+	_, err = reopened.Get(context.Background(), "def", "")
+	assert.ErrorIs(t, err, services.ErrDeleted)
+	// Момент удаления переживает перезапуск: ссылку можно восстановить
+	deleted, _ := reopened.Record("def")
+	assert.WithinDuration(t, time.Now(), deleted.DeletedAt, time.Minute)
+	originalURL, err = reopened.Get(context.Background(), "ghi", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.net/new", originalURL)
+	history, err := reopened.History(context.Background(), "user1", "ghi")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "http://example.net", history[0].OriginalURL)
+	}
+
+	require.NoError(t, fileStore.Close())
+}
+
+// Тест срока действия ссылок: срок сохраняется в журнале, а удаление истёкших ссылок переживает перезапуск
+func TestFileStore_PurgeExpired(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+	expiresAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, fileStore.Create(ctx, "http://example.com", "abc", "user1", services.LinkOptions{ExpiresAt: expiresAt}))
+	require.NoError(t, fileStore.Create(ctx, "http://example.org", "def", "user1", services.LinkOptions{}))
+	require.NoError(t, fileStore.Close())
+
+	reopened, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	record, exists := reopened.Record("abc")
+	require.True(t, exists)
+	assert.True(t, expiresAt.Equal(record.ExpiresAt))
+	_, err = reopened.Get(ctx, "abc", "")
+	assert.ErrorIs(t, err, services.ErrExpired)
+
+	count, err := reopened.PurgeExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	require.NoError(t, reopened.Close())
+
+	purged, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	defer purged.Close()
+	_, err = purged.Get(ctx, "abc", "")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	assert.Equal(t, 1, purged.Len())
+}
+
+// Тест ограничения переходов: исчерпанная ссылка остаётся исчерпанной после перезапуска
+func TestFileStore_Visit(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+	ctx := context.Background()
+
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, fileStore.Create(ctx, "http://example.com", "abc", "user1", services.LinkOptions{MaxClicks: 1}))
+	_, err = fileStore.Visit(ctx, "abc")
+	require.NoError(t, err)
+	_, err = fileStore.Visit(ctx, "abc")
+	assert.ErrorIs(t, err, services.ErrExhausted)
+	require.NoError(t, fileStore.Close())
+
+	reopened, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, err = reopened.Visit(ctx, "abc")
+	assert.ErrorIs(t, err, services.ErrExhausted)
+}
+
+// Тест отката: изменение, которое не удалось записать в журнал, не остаётся в памяти
+func TestFileStore_RollbackOnLogError(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+	ctx := context.Background()
+
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, fileStore.Create(ctx, "http://example.com", "abc", "user1", services.LinkOptions{MaxClicks: 2}))
+	require.NoError(t, fileStore.Create(ctx, "http://example.org", "def", "user1", services.LinkOptions{}))
+
+	require.NoError(t, dump.CloseLog(fileStore))
+	assert.Error(t, fileStore.Create(ctx, "http://example.net", "ghi", "user1", services.LinkOptions{}))
+	_, err = fileStore.Get(ctx, "ghi", "")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+
+	require.NoError(t, dump.CloseLog(fileStore))
+	assert.Error(t, fileStore.DeleteURLs(ctx, "user1", []string{"def"}))
+	_, err = fileStore.Get(ctx, "def", "")
+	assert.NoError(t, err)
+
+	require.NoError(t, dump.CloseLog(fileStore))
+	_, err = fileStore.Visit(ctx, "abc")
+	assert.Error(t, err)
+	record, _ := fileStore.Record("abc")
+	assert.Equal(t, 2, record.ClicksLeft)
+
+	require.NoError(t, dump.CloseLog(fileStore))
+	items := []services.BatchItem{{OriginalURL: "http://example.info", ShortURL: "jkl"}}
+	assert.Error(t, fileStore.CreateBatch(ctx, "user1", items))
+	assert.Equal(t, 2, fileStore.Len())
+
+	// После ошибки журнал переписан из памяти и принимает новые записи
+	require.NoError(t, fileStore.Create(ctx, "http://example.net", "ghi", "user1", services.LinkOptions{}))
+	require.NoError(t, fileStore.Close())
+
+	reopened, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, 3, reopened.Len())
+	_, err = reopened.Get(ctx, "def", "")
+	assert.NoError(t, err)
+	_, err = reopened.Get(ctx, "jkl", "")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	record, _ = reopened.Record("abc")
+	assert.Equal(t, 2, record.ClicksLeft)
+}
+
+// Тест пакетной записи в журнал
+func TestFileStore_CreateBatch(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, fileStore.Create(context.Background(), "http://example.com", "abc", "user1", services.LinkOptions{}))
+	items := []services.BatchItem{
+		{OriginalURL: "http://example.org", ShortURL: "def"},
+		{OriginalURL: "http://example.com", ShortURL: "ghi"},
+	}
+	require.NoError(t, fileStore.CreateBatch(context.Background(), "user2", items))
+	assert.True(t, items[1].Conflict)
+	require.NoError(t, fileStore.Close())
+
+	reopened, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, 2, reopened.Len())
+	originalURL, err := reopened.Get(context.Background(), "def", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.org", originalURL)
+}
+
+// Тест сохранения пула ключей между запусками
+func TestFileStore_Keys(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+	ctx := context.Background()
+
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, fileStore.AddKeys(ctx, []string{"k1", "k2", "k3"}))
+	taken, err := fileStore.TakeKeys(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, taken, 1)
+	require.NoError(t, fileStore.Close())
+
+	reopened, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncAlways, 0, false)
+	require.NoError(t, err)
+	defer reopened.Close()
+	count, err := reopened.CountKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NotContains(t, reopened.FreeKeys(), taken[0])
+}
+
+// Тест сжатия журнала
+func TestFileStore_Compact(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncNever, 0, false)
+	require.NoError(t, err)
+	defer fileStore.Close()
+	require.NoError(t, fileStore.Create(context.Background(), "http://example.com", "abc", "user1", services.LinkOptions{}))
+	require.NoError(t, fileStore.DeleteURLs(context.Background(), "user1", []string{"abc"}))
+
+	before, err := os.Stat(filePath)
+	require.NoError(t, err)
+	require.NoError(t, fileStore.Compact())
+	after, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+
+	// Записи после сжатия продолжают дописываться в новый журнал
+	require.NoError(t, fileStore.Create(context.Background(), "http://example.org", "def", "user1", services.LinkOptions{}))
+
+	storageInstance := storage.NewStorage()
+	require.NoError(t, dump.FillFromStorage(storageInstance, filePath))
+	assert.Equal(t, 2, storageInstance.Len())
+	_, err = storageInstance.Get(context.Background(), "abc", "")
+	assert.ErrorIs(t, err, services.ErrDeleted)
+}
+
+// Тест неизвестной политики синхронизации
+func TestNewFileStore_UnknownSyncPolicy(t *testing.T) {
+	_, err := dump.NewFileStore(storage.NewStorage(), t.TempDir()+"/short-url-db.json", "sometimes", 0, false)
+	assert.Error(t, err)
+}
+
+// writeLines записывает строки в новый файл и возвращает путь к нему
+func writeLines(t *testing.T, lines ...string) string {
+	filePath := t.TempDir() + "/short-url-db.json"
+	content := ""
+	for _, line := range lines {
+		content += line
+	}
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0666))
+	return filePath
+}
+
+// Тест формата файла: заголовок с версией и контрольные суммы записей
+func TestSet_FormatAndChecksum(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+	storageInstance := storage.NewStorage()
+	require.NoError(t, storageInstance.Create(context.Background(), "http://example.com", "abc", "user1", services.LinkOptions{}))
+	require.NoError(t, dump.Set(storageInstance, filePath))
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"format":"shortener-url-storage","version":`+strconv.Itoa(dump.FormatVersion)+`}`, lines[0])
+	assert.Contains(t, lines[1], `"checksum":`)
+
+	// Временные файлы не остаются после атомарной замены
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	report, err := dump.Load(storage.NewStorage(), filePath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, dump.FormatVersion, report.Version)
+	assert.Equal(t, 1, report.Loaded)
+	assert.False(t, report.NeedsRewrite)
+}
+
+// Тест повреждённой записи: без восстановления загрузка прерывается, с восстановлением запись пропускается
+func TestLoad_CorruptRecord(t *testing.T) {
+	filePath := t.TempDir() + "/short-url-db.json"
+	storageInstance := storage.NewStorage()
+	require.NoError(t, storageInstance.Create(context.Background(), "http://example.com", "abc", "user1", services.LinkOptions{}))
+	require.NoError(t, storageInstance.Create(context.Background(), "http://example.org", "def", "user1", services.LinkOptions{}))
+	require.NoError(t, dump.Set(storageInstance, filePath))
+
+	// Портим вторую запись, не нарушая JSON: контрольная сумма перестаёт совпадать
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[2] = strings.Replace(lines[2], "http://example", "http://exampla", 1)
+	require.NoError(t, os.WriteFile(filePath, []byte(strings.Join(lines, "")), 0666))
+
+	_, err = dump.Load(storage.NewStorage(), filePath, false)
+	assert.ErrorIs(t, err, dump.ErrCorrupt)
+
+	recovered := storage.NewStorage()
+	report, err := dump.Load(recovered, filePath, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Loaded)
+	assert.Equal(t, []int{3}, report.Corrupt)
+	assert.True(t, report.NeedsRewrite)
+	assert.Equal(t, 1, recovered.Len())
+}
+
+// Тест файла первой версии без заголовка и обрыва последней записи
+func TestLoad_LegacyAndTornTail(t *testing.T) {
+	filePath := writeLines(t,
+		`{"uuid":"1","short_url":"abc","original_url":"http://example.com"}`+"\n",
+		`{"uuid":"2","short_url":"def","orig`,
+	)
+
+	storageInstance := storage.NewStorage()
+	report, err := dump.Load(storageInstance, filePath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Version)
+	assert.Equal(t, 1, report.Loaded)
+	assert.True(t, report.TornTail)
+	assert.True(t, report.NeedsRewrite)
+
+	// Открытие журнала переписывает его в текущем формате
+	fileStore, err := dump.NewFileStore(storage.NewStorage(), filePath, dump.SyncNever, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, fileStore.Create(context.Background(), "http://example.org", "ghi", "user1", services.LinkOptions{}))
+	require.NoError(t, fileStore.Close())
+
+	report, err = dump.Load(storage.NewStorage(), filePath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, dump.FormatVersion, report.Version)
+	assert.Equal(t, 2, report.Loaded)
+	assert.False(t, report.NeedsRewrite)
+}
+
+// Тест файла неизвестной будущей версии
+func TestLoad_UnsupportedVersion(t *testing.T) {
+	filePath := writeLines(t, `{"format":"shortener-url-storage","version":99}`+"\n")
+
+	_, err := dump.Load(storage.NewStorage(), filePath, true)
+	assert.Error(t, err)
+}
@@ -0,0 +1,6 @@
+package dump
+
+// CloseLog закрывает файл журнала, чтобы следующие записи в него завершались ошибкой.
+func CloseLog(f *FileStore) error {
+	return f.file.Close()
+}
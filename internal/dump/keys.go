@@ -0,0 +1,68 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"strings"
+)
+
+// keysPath возвращает путь к файлу пула ключей, хранящемуся рядом с журналом filePath.
+func keysPath(filePath string) string {
+	return filePath + ".keys"
+}
+
+// loadKeys добавляет в хранилище свободные ключи из файла пула. Отсутствующий файл означает пустой пул.
+func (f *FileStore) loadKeys() error {
+	data, err := os.ReadFile(keysPath(f.filePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return f.Storage.AddKeys(context.Background(), strings.Fields(string(data)))
+}
+
+// AddKeys добавляет ключи в пул и сохраняет свободные ключи в файл пула.
+func (f *FileStore) AddKeys(ctx context.Context, keys []string) error {
+	f.keysMu.Lock()
+	defer f.keysMu.Unlock()
+	if err := f.Storage.AddKeys(ctx, keys); err != nil {
+		return err
+	}
+	return f.saveKeysLocked()
+}
+
+// TakeKeys забирает ключи из пула и сохраняет оставшиеся свободные ключи в файл пула,
+// чтобы после перезапуска выданные ключи не выдавались повторно.
+func (f *FileStore) TakeKeys(ctx context.Context, n int) ([]string, error) {
+	f.keysMu.Lock()
+	defer f.keysMu.Unlock()
+	keys, err := f.Storage.TakeKeys(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.saveKeysLocked(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// saveKeysLocked атомарно записывает свободные ключи пула в файл, по одному на строку.
+// Вызывающая сторона должна удерживать f.keysMu.
+func (f *FileStore) saveKeysLocked() error {
+	return replaceFile(keysPath(f.filePath), func(file *os.File) error {
+		writer := bufio.NewWriter(file)
+		for _, key := range f.Storage.FreeKeys() {
+			if _, err := writer.WriteString(key + "\n"); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		return file.Sync()
+	})
+}
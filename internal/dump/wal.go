@@ -0,0 +1,447 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Политики синхронизации журнала с диском.
+const (
+	SyncAlways   = "always"   // fsync после каждой записи
+	SyncInterval = "interval" // fsync в фоне раз в syncInterval
+	SyncNever    = "never"    // сброс на диск остаётся на усмотрение ОС
+)
+
+// syncInterval — период фоновой синхронизации журнала и проверки его размера.
+const syncInterval = time.Second
+
+// FileStore представляет файловое хранилище: записи держатся в памяти,
+// а каждое изменение сразу дописывается в журнал. При открытии журнал
+// воспроизводится через Load, а в фоне он переписывается заново,
+// когда его размер превышает порог compactSize. Изменение, которое не удалось
+// записать в журнал, отменяется и в памяти, поэтому вызывающая сторона,
+// получившая ошибку, не увидит его ни до, ни после перезапуска.
+type FileStore struct {
+	*storage.Storage        // Хранилище в памяти, обслуживающее запросы
+	filePath         string // Путь к файлу журнала
+	syncPolicy       string // Политика синхронизации с диском
+	compactSize      int64  // Размер журнала, после которого он сжимается; 0 отключает сжатие
+
+	mu     sync.Mutex    // Упорядочивает изменения хранилища и записи в журнал
+	keysMu sync.Mutex    // Упорядочивает изменения пула ключей и записи в его файл
+	file   *os.File      // Файл журнала, открытый на дозапись
+	size   int64         // Текущий размер журнала
+	seq    int           // Номер последней записи журнала
+	dirty  bool          // Есть записи, ещё не синхронизированные с диском
+	done   chan struct{} // Закрывается при остановке фоновой горутины
+	wg     sync.WaitGroup
+}
+
+// NewFileStore заполняет хранилище данными из журнала filePath, открывает журнал на дозапись
+// и запускает фоновую синхронизацию и сжатие. Пустая политика синхронизации означает SyncInterval.
+// В режиме восстановления recover повреждённые записи журнала пропускаются, иначе открытие завершается ошибкой.
+// Журнал старой версии или с пропущенными записями сразу переписывается в текущем формате.
+// Свободные ключи пула коротких идентификаторов загружаются из файла рядом с журналом.
+func NewFileStore(storageInstance *storage.Storage, filePath, syncPolicy string, compactSize int64, recover bool) (*FileStore, error) {
+	switch syncPolicy {
+	case "":
+		syncPolicy = SyncInterval
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("неизвестная политика синхронизации журнала: %q", syncPolicy)
+	}
+	report, err := Load(storageInstance, filePath, recover)
+	if err != nil {
+		return nil, err
+	}
+	if len(report.Corrupt) > 0 {
+		logger.Log.Warn("Пропущены повреждённые записи журнала",
+			zap.String("path", filePath), zap.Int("count", len(report.Corrupt)), zap.Ints("lines", report.Corrupt))
+	}
+	if report.TornTail {
+		logger.Log.Warn("Отброшена не дописанная последняя запись журнала", zap.String("path", filePath))
+	}
+
+	f := &FileStore{
+		Storage:     storageInstance,
+		filePath:    filePath,
+		syncPolicy:  syncPolicy,
+		compactSize: compactSize,
+		seq:         storageInstance.Len(),
+		done:        make(chan struct{}),
+	}
+	if report.NeedsRewrite {
+		err = f.compactLocked()
+	} else {
+		err = f.openLog()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = f.loadKeys(); err != nil {
+		f.file.Close()
+		return nil, err
+	}
+
+	f.wg.Add(1)
+	go f.background()
+	return f, nil
+}
+
+// openLog открывает файл журнала на дозапись и запоминает его размер.
+func (f *FileStore) openLog() error {
+	file, err := os.OpenFile(f.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Create сохраняет ссылку в памяти и дописывает её в журнал.
+func (f *FileStore) Create(ctx context.Context, originalURL, shortURL, UserID string, opts services.LinkOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := f.beginLocked(shortURL)
+	if err := f.Storage.Create(ctx, originalURL, shortURL, UserID, opts); err != nil {
+		return err
+	}
+	record, _ := f.Storage.Record(shortURL)
+	if err := f.appendLocked(record); err != nil {
+		return f.rollbackLocked(u, err)
+	}
+	return nil
+}
+
+// CreateBatch сохраняет пакет ссылок в памяти и дописывает новые ссылки в журнал.
+// При политике SyncAlways журнал синхронизируется с диском один раз на весь пакет.
+func (f *FileStore) CreateBatch(ctx context.Context, userID string, items []services.BatchItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	shortURLs := make([]string, 0, len(items))
+	for _, item := range items {
+		shortURLs = append(shortURLs, item.ShortURL)
+	}
+	u := f.beginLocked(shortURLs...)
+	if err := f.Storage.CreateBatch(ctx, userID, items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.Conflict {
+			continue
+		}
+		record, _ := f.Storage.Record(item.ShortURL)
+		if err := f.writeLocked(record); err != nil {
+			return f.rollbackLocked(u, err)
+		}
+	}
+	if err := f.syncLocked(); err != nil {
+		return f.rollbackLocked(u, err)
+	}
+	return nil
+}
+
+// DeleteURLs помечает ссылки как удалённые и дописывает в журнал те из них, состояние которых изменилось.
+// При политике SyncAlways журнал синхронизируется с диском один раз на весь вызов.
+func (f *FileStore) DeleteURLs(ctx context.Context, userID string, shortURLs []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := f.beginLocked(shortURLs...)
+	if err := f.Storage.DeleteURLs(ctx, userID, shortURLs); err != nil {
+		return err
+	}
+	changed := false
+	for shortURL, before := range u.records {
+		after, _ := f.Storage.Record(shortURL)
+		if before.DeletedFlag == after.DeletedFlag {
+			continue
+		}
+		if err := f.writeLocked(after); err != nil {
+			return f.rollbackLocked(u, err)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if err := f.syncLocked(); err != nil {
+		return f.rollbackLocked(u, err)
+	}
+	return nil
+}
+
+// Visit засчитывает переход по ссылке. Для ссылки с ограничением переходов новый остаток
+// дописывается в журнал, чтобы исчерпанная ссылка оставалась исчерпанной после перезапуска;
+// переходы по остальным ссылкам журнал не затрагивают.
+func (f *FileStore) Visit(ctx context.Context, shortURL string) (string, error) {
+	if record, exists := f.Storage.Record(shortURL); !exists || record.MaxClicks == 0 {
+		return f.Storage.Visit(ctx, shortURL)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := f.beginLocked(shortURL)
+	originalURL, err := f.Storage.Visit(ctx, shortURL)
+	if err != nil {
+		return "", err
+	}
+	record, _ := f.Storage.Record(shortURL)
+	if err := f.appendLocked(record); err != nil {
+		return "", f.rollbackLocked(u, err)
+	}
+	return originalURL, nil
+}
+
+// UpdateURL заменяет оригинальный URL ссылки в памяти и дописывает в журнал изменённую запись вместе с историей.
+func (f *FileStore) UpdateURL(ctx context.Context, userID, shortURL, originalURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := f.beginLocked(shortURL)
+	if err := f.Storage.UpdateURL(ctx, userID, shortURL, originalURL); err != nil {
+		return err
+	}
+	after, _ := f.Storage.Record(shortURL)
+	if after.OriginalURL == u.records[shortURL].OriginalURL {
+		return nil
+	}
+	if err := f.appendLocked(after); err != nil {
+		return f.rollbackLocked(u, err)
+	}
+	return nil
+}
+
+// RestoreURLs восстанавливает удалённые ссылки в памяти и дописывает в журнал восстановленные.
+// При политике SyncAlways журнал синхронизируется с диском один раз на весь вызов.
+func (f *FileStore) RestoreURLs(ctx context.Context, userID string, items []services.RestoreItem, deletedAfter time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	shortURLs := make([]string, 0, len(items))
+	for _, item := range items {
+		shortURLs = append(shortURLs, item.ShortURL)
+	}
+	u := f.beginLocked(shortURLs...)
+	if err := f.Storage.RestoreURLs(ctx, userID, items, deletedAfter); err != nil {
+		return err
+	}
+	changed := false
+	for _, item := range items {
+		if item.Status != services.RestoreRestored {
+			continue
+		}
+		record, _ := f.Storage.Record(item.ShortURL)
+		if err := f.writeLocked(record); err != nil {
+			return f.rollbackLocked(u, err)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if err := f.syncLocked(); err != nil {
+		return f.rollbackLocked(u, err)
+	}
+	return nil
+}
+
+// PurgeExpired удаляет из памяти ссылки, истёкшие раньше before, и дописывает в журнал записи об их удалении.
+// При политике SyncAlways журнал синхронизируется с диском один раз на весь вызов.
+func (f *FileStore) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := f.beginLocked()
+	removed := f.Storage.RemoveExpired(before)
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	for _, record := range removed {
+		u.records[record.ShortURL] = record
+	}
+	for _, record := range removed {
+		f.seq++
+		event := newTombstone(f.seq, record.ShortURL)
+		if err := f.writeEventLocked(&event); err != nil {
+			return 0, f.rollbackLocked(u, err)
+		}
+	}
+	if err := f.syncLocked(); err != nil {
+		return 0, f.rollbackLocked(u, err)
+	}
+	return len(removed), nil
+}
+
+// undo описывает состояние журнала и изменяемых ссылок до изменения хранилища.
+type undo struct {
+	size    int64                        // Размер журнала до изменения
+	seq     int                          // Номер последней записи журнала до изменения
+	records map[string]storage.URLRecord // Прежние записи изменяемых ссылок
+	missing []string                     // Изменяемые ссылки, которых не было в хранилище
+}
+
+// beginLocked запоминает размер журнала и записи ссылок shortURLs перед их изменением,
+// чтобы rollbackLocked мог отменить изменение. Вызывающая сторона должна удерживать f.mu.
+func (f *FileStore) beginLocked(shortURLs ...string) undo {
+	u := undo{size: f.size, seq: f.seq, records: make(map[string]storage.URLRecord, len(shortURLs))}
+	for _, shortURL := range shortURLs {
+		if record, exists := f.Storage.Record(shortURL); exists {
+			u.records[shortURL] = record
+		} else {
+			u.missing = append(u.missing, shortURL)
+		}
+	}
+	return u
+}
+
+// rollbackLocked отменяет изменение хранилища, которое не удалось записать в журнал: возвращает ссылки
+// в состояние, запомненное beginLocked, и обрезает журнал до прежнего размера, отбрасывая
+// частично записанные строки. Если журнал обрезать не удалось, он переписывается из хранилища.
+// Возвращает исходную ошибку err. Вызывающая сторона должна удерживать f.mu.
+func (f *FileStore) rollbackLocked(u undo, err error) error {
+	for _, shortURL := range u.missing {
+		f.Storage.Remove(shortURL)
+	}
+	for _, record := range u.records {
+		f.Storage.SetRecord(record)
+	}
+	if truncErr := f.file.Truncate(u.size); truncErr != nil {
+		logger.Log.Error("Ошибка отката журнала", zap.Error(truncErr))
+		if compactErr := f.compactLocked(); compactErr != nil {
+			logger.Log.Error("Ошибка сжатия журнала", zap.Error(compactErr))
+		}
+		return err
+	}
+	f.size, f.seq = u.size, u.seq
+	return err
+}
+
+// appendLocked дописывает запись в журнал. Вызывающая сторона должна удерживать f.mu.
+// При воспроизведении журнала последняя запись с тем же коротким идентификатором
+// заменяет предыдущие, поэтому удаление записывается как обновлённая запись.
+func (f *FileStore) appendLocked(record storage.URLRecord) error {
+	if err := f.writeLocked(record); err != nil {
+		return err
+	}
+	return f.syncLocked()
+}
+
+// writeLocked дописывает запись в журнал без синхронизации с диском. Вызывающая сторона должна удерживать f.mu.
+func (f *FileStore) writeLocked(record storage.URLRecord) error {
+	f.seq++
+	event := newCollector(f.seq, record)
+	return f.writeEventLocked(&event)
+}
+
+// writeEventLocked дописывает событие в журнал без синхронизации с диском. Вызывающая сторона должна удерживать f.mu.
+func (f *FileStore) writeEventLocked(event *ShortCollector) error {
+	writer := bufio.NewWriter(countingWriter{f.file, &f.size})
+	return writeEvent(event, writer)
+}
+
+// syncLocked синхронизирует журнал с диском согласно политике или отмечает его для фоновой синхронизации.
+// Вызывающая сторона должна удерживать f.mu.
+func (f *FileStore) syncLocked() error {
+	if f.syncPolicy == SyncAlways {
+		return f.file.Sync()
+	}
+	f.dirty = true
+	return nil
+}
+
+// Compact переписывает журнал из текущего снимка хранилища, отбрасывая устаревшие записи.
+// Новый журнал записывается во временный файл, который затем атомарно заменяет старый.
+func (f *FileStore) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compactLocked()
+}
+
+// compactLocked выполняет сжатие журнала. Вызывающая сторона должна удерживать f.mu,
+// чтобы снимок хранилища включал все уже записанные в журнал изменения.
+func (f *FileStore) compactLocked() error {
+	if err := Set(f.Storage, f.filePath); err != nil {
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.dirty = false
+	f.seq = f.Storage.Len()
+	return f.openLog()
+}
+
+// background периодически синхронизирует журнал с диском и сжимает его при превышении порога.
+func (f *FileStore) background() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			if f.dirty && f.syncPolicy == SyncInterval {
+				if err := f.file.Sync(); err != nil {
+					logger.Log.Error("Ошибка синхронизации журнала", zap.Error(err))
+				} else {
+					f.dirty = false
+				}
+			}
+			if f.compactSize > 0 && f.size > f.compactSize {
+				if err := f.compactLocked(); err != nil {
+					logger.Log.Error("Ошибка сжатия журнала", zap.Error(err))
+				}
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// Close останавливает фоновую горутину, синхронизирует журнал с диском и закрывает его.
+func (f *FileStore) Close() error {
+	close(f.done)
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// countingWriter пишет в файл и учитывает количество записанных байт.
+type countingWriter struct {
+	file *os.File
+	size *int64
+}
+
+// Write записывает данные в файл и увеличивает счётчик размера.
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	*w.size += int64(n)
+	return n, err
+}
@@ -5,7 +5,8 @@ import (
 )
 
 // Log представляет собой глобальный логгер, который используется в приложении.
-var Log *zap.SugaredLogger
+// До вызова Initialize сообщения отбрасываются.
+var Log = zap.NewNop().Sugar()
 
 // Initialize инициализирует глобальный логгер с заданным уровнем логирования.
 //
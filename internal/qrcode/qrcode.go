@@ -0,0 +1,482 @@
+// Package qrcode строит QR-коды (ISO/IEC 18004) в байтовом режиме без сторонних библиотек
+// и выводит их в форматах PNG и SVG.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Level — уровень коррекции ошибок: доля символа, которую можно восстановить при повреждении.
+type Level int
+
+// Уровни коррекции ошибок в порядке возрастания надёжности.
+const (
+	Low      Level = iota // L — около 7 %
+	Medium                // M — около 15 %
+	Quartile              // Q — около 25 %
+	High                  // H — около 30 %
+)
+
+// formatBits — значения уровней коррекции в служебной информации о формате.
+var formatBits = [4]int{Low: 1, Medium: 0, Quartile: 3, High: 2}
+
+// String возвращает обозначение уровня: L, M, Q или H.
+func (l Level) String() string {
+	return string("LMQH"[l])
+}
+
+// ParseLevel разбирает обозначение уровня коррекции L, M, Q или H без учёта регистра.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return Low, nil
+	case "M":
+		return Medium, nil
+	case "Q":
+		return Quartile, nil
+	case "H":
+		return High, nil
+	default:
+		return 0, fmt.Errorf("неизвестный уровень коррекции %q: допустимы L, M, Q и H", s)
+	}
+}
+
+// ErrTooLong возвращается, если данные не помещаются в QR-код наибольшей версии.
+var ErrTooLong = errors.New("данные не помещаются в QR-код")
+
+// Code — QR-код: квадрат из тёмных и светлых модулей без свободного поля вокруг.
+type Code struct {
+	Version int    // Версия символа от 1 до 40
+	Level   Level  // Уровень коррекции ошибок
+	Size    int    // Количество модулей по стороне: 4·Version + 17
+	modules []bool // Цвет модулей построчно: true — тёмный
+}
+
+// Black сообщает, что модуль в столбце x и строке y тёмный. Модули вне символа светлые.
+func (c *Code) Black(x, y int) bool {
+	return x >= 0 && x < c.Size && y >= 0 && y < c.Size && c.modules[y*c.Size+x]
+}
+
+// Encode кодирует data в QR-код наименьшей подходящей версии с уровнем коррекции level.
+// Маска выбирается по наименьшему штрафу, как предписывает стандарт.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("неизвестный уровень коррекции %d", level)
+	}
+	version := 1
+	for ; ; version++ {
+		if version > 40 {
+			return nil, fmt.Errorf("%w: %d байт", ErrTooLong, len(data))
+		}
+		if segmentBits(data, version) <= dataCodewords(version, level)*8 {
+			break
+		}
+	}
+
+	b := newBuilder(version, level)
+	b.drawFunctionPatterns()
+	b.drawCodewords(addECC(encodeSegment(data, version, level), version, level))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		b.applyMask(mask)
+		b.drawFormatBits(mask)
+		if penalty := b.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		b.applyMask(mask) // Наложение маски обратимо: повторное снимает её
+	}
+	b.applyMask(best)
+	b.drawFormatBits(best)
+
+	return &Code{Version: version, Level: level, Size: b.size, modules: b.modules}, nil
+}
+
+// charCountBits возвращает длину поля количества байтов в байтовом режиме для версии version.
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// segmentBits возвращает длину в битах сегмента байтового режима с данными data для версии version.
+func segmentBits(data []byte, version int) int {
+	if len(data) >= 1<<charCountBits(version) {
+		return 1 << 30
+	}
+	return 4 + charCountBits(version) + len(data)*8
+}
+
+// bitBuffer — последовательность битов, дописываемых от старшего к младшему.
+type bitBuffer struct {
+	bytes []byte
+	n     int
+}
+
+// append дописывает младшие length битов значения value.
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if (value>>i)&1 != 0 {
+			b.bytes[b.n/8] |= 0x80 >> (b.n % 8)
+		}
+		b.n++
+	}
+}
+
+// encodeSegment возвращает кодовые слова данных: сегмент байтового режима,
+// терминатор и байты заполнения до ёмкости версии.
+func encodeSegment(data []byte, version int, level Level) []byte {
+	capacity := dataCodewords(version, level) * 8
+	var buf bitBuffer
+	buf.append(0x4, 4) // Байтовый режим
+	buf.append(len(data), charCountBits(version))
+	for _, b := range data {
+		buf.append(int(b), 8)
+	}
+	buf.append(0, min(4, capacity-buf.n))
+	buf.append(0, (8-buf.n%8)%8)
+	for pad := 0xEC; buf.n < capacity; pad ^= 0xEC ^ 0x11 {
+		buf.append(pad, 8)
+	}
+	return buf.bytes
+}
+
+// addECC делит данные на блоки, дополняет каждый кодовыми словами коррекции
+// и перемежает блоки в порядке размещения в символе.
+func addECC(data []byte, version int, level Level) []byte {
+	blocks := eccBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	raw := rawDataModules(version) / 8
+	shortBlocks := blocks - raw%blocks
+	shortLen := raw / blocks
+
+	// Короткие блоки дополняются пустым байтом, чтобы все блоки имели одну длину
+	divisor := rsDivisor(eccLen)
+	parts := make([][]byte, blocks)
+	for i, k := 0, 0; i < blocks; i++ {
+		dataLen := shortLen - eccLen
+		if i >= shortBlocks {
+			dataLen++
+		}
+		block := make([]byte, 0, shortLen+1)
+		block = append(block, data[k:k+dataLen]...)
+		if i < shortBlocks {
+			block = append(block, 0)
+		}
+		block = append(block, rsRemainder(data[k:k+dataLen], divisor)...)
+		k += dataLen
+		parts[i] = block
+	}
+
+	result := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for j, block := range parts {
+			if i != shortLen-eccLen || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// builder размещает модули символа.
+type builder struct {
+	version    int
+	level      Level
+	size       int
+	modules    []bool // Цвет модулей построчно
+	isFunction []bool // Модуль принадлежит служебному узору и не маскируется
+}
+
+// newBuilder создаёт пустой символ версии version.
+func newBuilder(version int, level Level) *builder {
+	size := version*4 + 17
+	return &builder{
+		version:    version,
+		level:      level,
+		size:       size,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+}
+
+// setFunction задаёт цвет служебного модуля в столбце x и строке y.
+func (b *builder) setFunction(x, y int, black bool) {
+	b.modules[y*b.size+x] = black
+	b.isFunction[y*b.size+x] = true
+}
+
+// drawFunctionPatterns рисует поисковые, синхронизирующие и выравнивающие узоры, информацию о версии
+// и резервирует место для информации о формате.
+func (b *builder) drawFunctionPatterns() {
+	for i := 0; i < b.size; i++ {
+		b.setFunction(6, i, i%2 == 0)
+		b.setFunction(i, 6, i%2 == 0)
+	}
+	b.drawFinder(3, 3)
+	b.drawFinder(b.size-4, 3)
+	b.drawFinder(3, b.size-4)
+
+	positions := alignmentPositions(b.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Выравнивающие узоры не накладываются на поисковые
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			b.drawAlignment(x, y)
+		}
+	}
+
+	b.drawFormatBits(0)
+	b.drawVersion()
+}
+
+// drawFinder рисует поисковый узор с центром (x, y) вместе с разделителем.
+func (b *builder) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= b.size || yy < 0 || yy >= b.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			b.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment рисует выравнивающий узор с центром (x, y).
+func (b *builder) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			b.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits рисует обе копии информации о формате для маски mask и тёмный модуль.
+func (b *builder) drawFormatBits(mask int) {
+	bits := formatInfo(b.level, mask)
+
+	for i := 0; i <= 5; i++ {
+		b.setFunction(8, i, bit(bits, i))
+	}
+	b.setFunction(8, 7, bit(bits, 6))
+	b.setFunction(8, 8, bit(bits, 7))
+	b.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		b.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		b.setFunction(b.size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		b.setFunction(8, b.size-15+i, bit(bits, i))
+	}
+	b.setFunction(8, b.size-8, true)
+}
+
+// drawVersion рисует обе копии информации о версии, которая есть у версий начиная с седьмой.
+func (b *builder) drawVersion() {
+	if b.version < 7 {
+		return
+	}
+	bits := versionInfo(b.version)
+	for i := 0; i < 18; i++ {
+		a, c := b.size-11+i%3, i/3
+		b.setFunction(a, c, bit(bits, i))
+		b.setFunction(c, a, bit(bits, i))
+	}
+}
+
+// formatInfo возвращает 15 битов информации о формате: уровень коррекции и маску mask,
+// защищённые кодом БЧХ (15, 5) и наложенные на маску формата.
+func formatInfo(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionInfo возвращает 18 битов информации о версии version, защищённые кодом Голея (18, 6).
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+// drawCodewords размещает кодовые слова зигзагом по парам столбцов от правого нижнего угла,
+// обходя служебные модули.
+func (b *builder) drawCodewords(data []byte) {
+	i := 0
+	for right := b.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Столбец синхронизирующего узора пропускается
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < b.size; vert++ {
+			y := vert
+			if upward {
+				y = b.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if b.isFunction[y*b.size+x] || i >= len(data)*8 {
+					continue
+				}
+				b.modules[y*b.size+x] = bit(int(data[i/8]), 7-i%8)
+				i++
+			}
+		}
+	}
+}
+
+// applyMask инвертирует модули данных, для которых выполняется условие маски mask.
+func (b *builder) applyMask(mask int) {
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !b.isFunction[y*b.size+x] {
+				b.modules[y*b.size+x] = !b.modules[y*b.size+x]
+			}
+		}
+	}
+}
+
+// Штрафы за нежелательные узоры в символе, по которым выбирается маска.
+const (
+	penaltyRun     = 3  // Ряд из пяти модулей одного цвета, и ещё по одному за каждый следующий
+	penaltyBox     = 3  // Квадрат 2×2 одного цвета
+	penaltyFinder  = 40 // Узор, похожий на поисковый
+	penaltyBalance = 10 // Каждые 5 % отклонения доли тёмных модулей от половины
+)
+
+// penalty возвращает штраф текущего расположения модулей.
+func (b *builder) penalty() int {
+	result := 0
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < b.size; a++ {
+			runBlack, runLength := false, 0
+			var history [7]int
+			for c := 0; c < b.size; c++ {
+				x, y := c, a
+				if vertical {
+					x, y = a, c
+				}
+				black := b.modules[y*b.size+x]
+				if black == runBlack {
+					runLength++
+					if runLength == 5 {
+						result += penaltyRun
+					} else if runLength > 5 {
+						result++
+					}
+					continue
+				}
+				b.addRunHistory(runLength, &history)
+				if !runBlack {
+					result += countFinderLike(&history) * penaltyFinder
+				}
+				runBlack, runLength = black, 1
+			}
+			result += b.terminateRuns(runBlack, runLength, &history) * penaltyFinder
+		}
+	}
+
+	dark := 0
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			black := b.modules[y*b.size+x]
+			if black {
+				dark++
+			}
+			if x < b.size-1 && y < b.size-1 && black == b.modules[y*b.size+x+1] &&
+				black == b.modules[(y+1)*b.size+x] && black == b.modules[(y+1)*b.size+x+1] {
+				result += penaltyBox
+			}
+		}
+	}
+	total := b.size * b.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return result + k*penaltyBalance
+}
+
+// addRunHistory запоминает длину завершённого ряда. Первый ряд строки продлевается
+// светлым свободным полем вокруг символа.
+func (b *builder) addRunHistory(runLength int, history *[7]int) {
+	if history[0] == 0 {
+		runLength += b.size
+	}
+	copy(history[1:], history[:6])
+	history[0] = runLength
+}
+
+// terminateRuns завершает строку, продлевая её светлым свободным полем,
+// и возвращает количество похожих на поисковый узоров в конце строки.
+func (b *builder) terminateRuns(runBlack bool, runLength int, history *[7]int) int {
+	if runBlack {
+		b.addRunHistory(runLength, history)
+		runLength = 0
+	}
+	runLength += b.size
+	b.addRunHistory(runLength, history)
+	return countFinderLike(history)
+}
+
+// countFinderLike возвращает, сколько раз последние ряды образуют узор 1:1:3:1:1
+// со светлым полем в четыре модуля с одной из сторон.
+func countFinderLike(history *[7]int) int {
+	n := history[1]
+	core := n > 0 && history[2] == n && history[3] == n*3 && history[4] == n && history[5] == n
+	count := 0
+	if core && history[0] >= n*4 && history[6] >= n {
+		count++
+	}
+	if core && history[6] >= n*4 && history[0] >= n {
+		count++
+	}
+	return count
+}
+
+// bit сообщает, что бит i значения x равен единице.
+func bit(x, i int) bool {
+	return (x>>i)&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,221 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Пример из руководства по QR-кодам: «HELLO WORLD» в версии 1-M
+func TestRSRemainder(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ecc := rsRemainder(data, rsDivisor(10))
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, ecc)
+}
+
+// Значения из таблиц стандарта
+func TestFormatAndVersionInfo(t *testing.T) {
+	assert.Equal(t, 0b111011111000100, formatInfo(Low, 0))
+	assert.Equal(t, 0b101010000010010, formatInfo(Medium, 0))
+	assert.Equal(t, 0b011010101011111, formatInfo(Quartile, 0))
+	assert.Equal(t, 0b001011010001001, formatInfo(High, 0))
+	assert.Equal(t, 0b100101010100000, formatInfo(Medium, 7))
+	assert.Equal(t, 0x07C94, versionInfo(7))
+	assert.Equal(t, 0x28C69, versionInfo(40))
+}
+
+func TestDataCodewords(t *testing.T) {
+	assert.Equal(t, 19, dataCodewords(1, Low))
+	assert.Equal(t, 16, dataCodewords(1, Medium))
+	assert.Equal(t, 62, dataCodewords(5, Quartile))
+	assert.Equal(t, 2956, dataCodewords(40, Low))
+	assert.Equal(t, 1276, dataCodewords(40, High))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, alignmentPositions(40))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPositions(32))
+}
+
+func TestEncode_Version(t *testing.T) {
+	tests := []struct {
+		length  int
+		level   Level
+		version int
+	}{
+		{length: 17, level: Low, version: 1},
+		{length: 18, level: Low, version: 2},
+		{length: 14, level: Medium, version: 1},
+		{length: 7, level: High, version: 1},
+		{length: 8, level: High, version: 2},
+		{length: 230, level: Low, version: 9},
+		{length: 231, level: Low, version: 10},
+		{length: 2953, level: Low, version: 40},
+	}
+	for _, tt := range tests {
+		code, err := Encode(bytes.Repeat([]byte("a"), tt.length), tt.level)
+		require.NoError(t, err)
+		assert.Equal(t, tt.version, code.Version, "%d байт, уровень %s", tt.length, tt.level)
+		assert.Equal(t, tt.version*4+17, code.Size)
+	}
+
+	_, err := Encode(bytes.Repeat([]byte("a"), 2954), Low)
+	assert.True(t, errors.Is(err, ErrTooLong))
+}
+
+// Код читается обратно: информация о формате, маска, блоки коррекции и данные
+func TestEncode_RoundTrip(t *testing.T) {
+	inputs := []string{
+		"http://localhost:8080/abc",
+		"https://example.com/" + strings.Repeat("x", 100),
+		"https://example.com/" + strings.Repeat("тест", 100),
+	}
+	for _, input := range inputs {
+		for level := Low; level <= High; level++ {
+			code, err := Encode([]byte(input), level)
+			require.NoError(t, err)
+			assert.Equal(t, input, string(decode(t, code)), "версия %d, уровень %s", code.Version, level)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"L": Low, "m": Medium, "Q": Quartile, "h": High} {
+		level, err := ParseLevel(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, level)
+	}
+	_, err := ParseLevel("X")
+	assert.Error(t, err)
+}
+
+func TestCode_Render(t *testing.T) {
+	code, err := Encode([]byte("http://localhost:8080/abc"), Medium)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, code.WritePNG(&buf, 200, DefaultMargin))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	side := (code.Size + 2*DefaultMargin) * (200 / (code.Size + 2*DefaultMargin))
+	assert.Equal(t, side, img.Bounds().Dx())
+	// Угол поискового узора тёмный, свободное поле светлое
+	scale := side / (code.Size + 2*DefaultMargin)
+	r, _, _, _ := img.At(DefaultMargin*scale, DefaultMargin*scale).RGBA()
+	assert.Zero(t, r)
+	r, _, _, _ = img.At(0, 0).RGBA()
+	assert.NotZero(t, r)
+
+	buf.Reset()
+	require.NoError(t, code.WriteSVG(&buf, 300, 2))
+	svg := buf.String()
+	assert.Contains(t, svg, `width="300" height="300"`)
+	assert.Contains(t, svg, fmt.Sprintf(`viewBox="0 0 %d %d"`, code.Size+4, code.Size+4))
+	assert.Contains(t, svg, "M2 3h1v1h-1z")
+}
+
+// decode читает данные из кода, построенного Encode, и проверяет коды коррекции.
+func decode(t *testing.T, code *Code) []byte {
+	t.Helper()
+	version, size := code.Version, code.Size
+
+	// Информация о формате из первой копии
+	var format int
+	for i := 0; i <= 5; i++ {
+		format |= boolBit(code.Black(8, i)) << i
+	}
+	format |= boolBit(code.Black(8, 7)) << 6
+	format |= boolBit(code.Black(8, 8)) << 7
+	format |= boolBit(code.Black(7, 8)) << 8
+	for i := 9; i < 15; i++ {
+		format |= boolBit(code.Black(14-i, 8)) << i
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatInfo(code.Level, m) == format {
+			mask = m
+		}
+	}
+	require.NotEqual(t, -1, mask, "информация о формате не распознана")
+
+	// Модули данных без маски в порядке размещения
+	b := newBuilder(version, code.Level)
+	b.drawFunctionPatterns()
+	copy(b.modules, code.modules)
+	b.applyMask(mask)
+	raw := make([]byte, rawDataModules(version)/8)
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if b.isFunction[y*size+x] || i >= len(raw)*8 {
+					continue
+				}
+				if b.modules[y*size+x] {
+					raw[i/8] |= 0x80 >> (i % 8)
+				}
+				i++
+			}
+		}
+	}
+
+	// Разбор перемежения и проверка блоков
+	blocks := eccBlocks[code.Level][version]
+	eccLen := eccCodewordsPerBlock[code.Level][version]
+	shortBlocks := blocks - len(raw)%blocks
+	shortLen := len(raw) / blocks
+	parts := make([][]byte, blocks)
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range parts {
+			if i != shortLen-eccLen || j >= shortBlocks {
+				parts[j] = append(parts[j], raw[k])
+				k++
+			}
+		}
+	}
+	var data []byte
+	for _, part := range parts {
+		dataLen := len(part) - eccLen
+		assert.Equal(t, part[dataLen:], rsRemainder(part[:dataLen], rsDivisor(eccLen)))
+		data = append(data, part[:dataLen]...)
+	}
+
+	// Сегмент байтового режима
+	require.Equal(t, byte(0x4), data[0]>>4)
+	var pos int
+	read := func(n int) int {
+		v := 0
+		for ; n > 0; n-- {
+			v = v<<1 | int(data[pos/8]>>(7-pos%8)&1)
+			pos++
+		}
+		return v
+	}
+	read(4)
+	length := read(charCountBits(version))
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = byte(read(8))
+	}
+	return result
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package qrcode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// DefaultMargin — ширина свободного поля вокруг символа в модулях, которую требует стандарт.
+const DefaultMargin = 4
+
+// Image возвращает двухцветное изображение кода, в котором модуль занимает scale×scale пикселей,
+// а вокруг символа оставлено свободное поле шириной margin модулей.
+func (c *Code) Image(scale, margin int) *image.Paletted {
+	side := (c.Size + 2*margin) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[((y+margin)*scale+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[(x+margin)*scale+dx] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG записывает код в w в формате PNG. Модуль занимает наибольшее целое число пикселей,
+// при котором сторона изображения не превышает size; если size меньше стороны символа, модуль занимает один пиксель.
+func (c *Code) WritePNG(w io.Writer, size, margin int) error {
+	scale := max(1, size/(c.Size+2*margin))
+	return png.Encode(w, c.Image(scale, margin))
+}
+
+// WriteSVG записывает код в w в формате SVG со стороной size пикселей. Тёмные модули
+// каждой строки объединяются в прямоугольники одного контура.
+func (c *Code) WriteSVG(w io.Writer, size, margin int) error {
+	side := c.Size + 2*margin
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#ffffff"/>
+<path fill="#000000" d="`, size, size, side, side)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.Black(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < c.Size && c.Black(x, y) {
+				x++
+			}
+			fmt.Fprintf(bw, "M%d %dh%dv1h-%dz", start+margin, y+margin, x-start, x-start)
+		}
+	}
+	bw.WriteString("\"/>\n</svg>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Ограничения длины псевдонима.
+const (
+	aliasMinLength = 3
+	aliasMaxLength = 64
+)
+
+// aliasPattern — допустимые символы псевдонима: латинские буквы, цифры, дефис и подчёркивание.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ReserveAliases запрещает использовать слова words в качестве псевдонимов без учёта регистра.
+// Вызывается при настройке сервиса, до начала обработки запросов.
+func (s *ShortenerService) ReserveAliases(words ...string) {
+	if s.reserved == nil {
+		s.reserved = make(map[string]bool, len(words))
+	}
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			s.reserved[word] = true
+		}
+	}
+}
+
+// ValidateAlias проверяет длину и символы псевдонима alias и что он не зарезервирован.
+// Если псевдоним недопустим, возвращает ошибку, оборачивающую ErrInvalidAlias.
+func (s *ShortenerService) ValidateAlias(alias string) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return fmt.Errorf("%w: длина должна быть от %d до %d символов", ErrInvalidAlias, aliasMinLength, aliasMaxLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("%w: допустимы латинские буквы, цифры, дефис и подчёркивание", ErrInvalidAlias)
+	}
+	if s.reserved[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: псевдоним %q зарезервирован", ErrInvalidAlias, alias)
+	}
+	return nil
+}
+
+// takenAlias возвращает ErrAliasTaken для первого из псевдонимов aliases, уже занятого в хранилище,
+// или nil, если все они свободны.
+func (s *ShortenerService) takenAlias(ctx context.Context, aliases []string) error {
+	for _, alias := range aliases {
+		if alias == "" {
+			continue
+		}
+		_, err := s.Storage.Get(ctx, alias, "")
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrDeleted) && !errors.Is(err, ErrExpired) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrAliasTaken, alias)
+	}
+	return nil
+}
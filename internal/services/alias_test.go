@@ -0,0 +1,72 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Тест проверки псевдонимов
+func TestShortenerService_ValidateAlias(t *testing.T) {
+	service := services.NewShortenerService("http://localhost", new(MockStore))
+	service.ReserveAliases("api", " Admin ")
+
+	assert.NoError(t, service.ValidateAlias("my-link_1"))
+	for _, alias := range []string{"ab", string(make([]byte, 65)), "with space", "кириллица", "api", "ADMIN"} {
+		assert.ErrorIs(t, service.ValidateAlias(alias), services.ErrInvalidAlias, alias)
+	}
+}
+
+// Тест сохранения ссылки под псевдонимом
+func TestShortenerService_SetLink_Alias(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	mockStore.On("Create", mock.Anything, "https://example.com/", "my-link", "user1", mock.Anything).Return(nil)
+	mockStore.On("Create", mock.Anything, "https://example.org/", "my-link", "user1", mock.Anything).Return(services.ErrShortIDExists)
+
+	shortURL, err := service.SetLink(context.Background(), "user1", "https://example.com/", "my-link", services.LinkOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost/my-link", shortURL)
+
+	_, err = service.SetLink(context.Background(), "user1", "https://example.org/", "my-link", services.LinkOptions{})
+	assert.ErrorIs(t, err, services.ErrAliasTaken)
+	assert.NotErrorIs(t, err, services.ErrShortIDExists)
+
+	_, err = service.SetLink(context.Background(), "user1", "https://example.org/", "x", services.LinkOptions{})
+	assert.ErrorIs(t, err, services.ErrInvalidAlias)
+}
+
+// Тест пакетного сохранения с занятым псевдонимом: пакет отклоняется без повторных попыток
+func TestShortenerService_SetBatch_AliasTaken(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	mockStore.On("CreateBatch", mock.Anything, "user1", mock.Anything).Return(services.ErrShortIDExists)
+	mockStore.On("Get", mock.Anything, "my-link", "").Return("https://example.net/", nil)
+
+	_, err := service.SetBatch(context.Background(), "user1", []services.BatchURL{
+		{CorrelationID: "1", OriginalURL: "https://example.com/", Alias: "my-link"},
+		{CorrelationID: "2", OriginalURL: "https://example.org/"},
+	})
+
+	assert.ErrorIs(t, err, services.ErrAliasTaken)
+	mockStore.AssertNumberOfCalls(t, "CreateBatch", 1)
+}
+
+// Тест пакета с повторяющимся псевдонимом
+func TestShortenerService_SetBatch_DuplicateAlias(t *testing.T) {
+	service := services.NewShortenerService("http://localhost", new(MockStore))
+
+	_, err := service.SetBatch(context.Background(), "user1", []services.BatchURL{
+		{CorrelationID: "1", OriginalURL: "https://example.com/", Alias: "my-link"},
+		{CorrelationID: "2", OriginalURL: "https://example.org/", Alias: "my-link"},
+	})
+
+	assert.ErrorIs(t, err, services.ErrAliasTaken)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// blockRules — разобранные правила списка блокировки.
+type blockRules struct {
+	exact    map[string]bool  // Хосты, заблокированные точно
+	suffixes []string         // Суффиксы вида ".example.com" для правил "*.example.com"
+	patterns []*regexp.Regexp // Регулярные выражения для хоста
+}
+
+// Blocklist — список заблокированных доменов, загружаемый из файла. Каждая непустая строка файла
+// задаёт одно правило: хост целиком ("example.com"), все его поддомены ("*.example.com")
+// или регулярное выражение для хоста между косыми чертами ("/^ads\d+\./"). Строки, начинающиеся с "#",
+// считаются комментариями. Список можно перечитать методом Reload, не останавливая сервис.
+type Blocklist struct {
+	path string // Путь к файлу со списком
+
+	mu    sync.RWMutex
+	rules *blockRules
+}
+
+// LoadBlocklist загружает список блокировки из файла path.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload перечитывает файл списка. Если файл не удаётся прочитать или в нём есть недопустимое правило,
+// возвращает ошибку и продолжает использовать прежний список.
+func (b *Blocklist) Reload() error {
+	file, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rules := &blockRules{exact: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		rule := strings.TrimSpace(scanner.Text())
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		if err := rules.add(rule); err != nil {
+			return fmt.Errorf("%s:%d: %w", b.path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.rules = rules
+	b.mu.Unlock()
+	return nil
+}
+
+// Len возвращает количество правил в списке.
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.rules.exact) + len(b.rules.suffixes) + len(b.rules.patterns)
+}
+
+// add разбирает одно правило списка и добавляет его к правилам.
+func (r *blockRules) add(rule string) error {
+	if len(rule) > 1 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") {
+		pattern, err := regexp.Compile(rule[1 : len(rule)-1])
+		if err != nil {
+			return fmt.Errorf("недопустимое регулярное выражение %q: %w", rule, err)
+		}
+		r.patterns = append(r.patterns, pattern)
+		return nil
+	}
+	domain, wildcard := strings.CutPrefix(rule, "*.")
+	host, err := normalizeHost(domain)
+	if err != nil {
+		return fmt.Errorf("недопустимый домен %q: %w", rule, err)
+	}
+	if wildcard {
+		r.suffixes = append(r.suffixes, "."+host)
+	} else {
+		r.exact[host] = true
+	}
+	return nil
+}
+
+// Blocked сообщает, что хост URL rawURL попадает под одно из правил списка.
+// Хост сравнивается в каноническом виде: в нижнем регистре и в punycode. Пустой список (nil) ничего не блокирует.
+func (b *Blocklist) Blocked(rawURL string) bool {
+	if b == nil {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return false
+	}
+
+	b.mu.RLock()
+	rules := b.rules
+	b.mu.RUnlock()
+	if rules.exact[host] {
+		return true
+	}
+	for _, suffix := range rules.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	for _, pattern := range rules.patterns {
+		if pattern.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBlocked возвращает ErrBlocked, если домен URL originalURL заблокирован.
+func (s *ShortenerService) checkBlocked(originalURL string) error {
+	if !s.Blocklist.Blocked(originalURL) {
+		return nil
+	}
+	host := originalURL
+	if u, err := url.Parse(originalURL); err == nil {
+		host = u.Hostname()
+	}
+	return fmt.Errorf("%w: %s", ErrBlocked, host)
+}
@@ -0,0 +1,99 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// writeBlocklist записывает файл списка блокировки во временный каталог теста.
+func writeBlocklist(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlocklist_Blocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeBlocklist(t, path, "# фишинг\nevil.com\n*.tracker.net\n\n/^ads[0-9]+\\./\nПлохой.РФ\n")
+
+	blocklist, err := services.LoadBlocklist(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, blocklist.Len())
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{url: "https://evil.com/login", blocked: true},
+		{url: "https://EVIL.com:8443/", blocked: true},
+		{url: "https://www.evil.com/", blocked: false},
+		{url: "https://a.b.tracker.net/", blocked: true},
+		{url: "https://tracker.net/", blocked: false},
+		{url: "https://ads42.example.org/", blocked: true},
+		{url: "https://ads.example.org/", blocked: false},
+		{url: "http://xn--i1adjac2b.xn--p1ai/", blocked: true},
+		{url: "https://example.com/?q=evil.com", blocked: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.blocked, blocklist.Blocked(tt.url), tt.url)
+	}
+	assert.False(t, (*services.Blocklist)(nil).Blocked("https://evil.com/"))
+}
+
+func TestBlocklist_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeBlocklist(t, path, "evil.com\n")
+	blocklist, err := services.LoadBlocklist(path)
+	assert.NoError(t, err)
+
+	writeBlocklist(t, path, "bad.org\n")
+	assert.NoError(t, blocklist.Reload())
+	assert.False(t, blocklist.Blocked("https://evil.com/"))
+	assert.True(t, blocklist.Blocked("https://bad.org/"))
+
+	// Недопустимое правило не заменяет действующий список
+	writeBlocklist(t, path, "ok.org\n/[/\n")
+	assert.ErrorContains(t, blocklist.Reload(), ":2:")
+	assert.True(t, blocklist.Blocked("https://bad.org/"))
+
+	_, err = services.LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestShortenerService_Blocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeBlocklist(t, path, "*.evil.com\n")
+	blocklist, err := services.LoadBlocklist(path)
+	assert.NoError(t, err)
+
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+	service.Blocklist = blocklist
+
+	_, err = service.Set(context.Background(), "user1", "https://login.evil.com/")
+	assert.ErrorIs(t, err, services.ErrBlocked)
+	_, err = service.SetBatch(context.Background(), "user1", []services.BatchURL{{CorrelationID: "1", OriginalURL: "https://login.evil.com/"}})
+	assert.ErrorIs(t, err, services.ErrBlocked)
+	mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Ссылка, созданная до блокировки домена, больше не перенаправляет и не расходует переходы
+	mockStore.On("Options", mock.Anything, "old").Return("https://login.evil.com/", services.LinkOptions{MaxClicks: 1}, nil)
+	_, err = service.Visit(context.Background(), "old", services.Unlock{}, services.Passthrough{})
+	assert.ErrorIs(t, err, services.ErrBlocked)
+	mockStore.AssertNotCalled(t, "Visit", mock.Anything, "old")
+
+	mockStore.On("Options", mock.Anything, "good").Return("https://example.com/", services.LinkOptions{}, nil)
+	mockStore.On("Visit", mock.Anything, "good").Return("https://example.com/", nil)
+	redirect, err := service.Visit(context.Background(), "good", services.Unlock{}, services.Passthrough{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/", redirect.Location)
+	// Проверка блокировки не требует отдельного чтения ссылки
+	mockStore.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, mock.Anything)
+}
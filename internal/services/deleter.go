@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Параметры очереди удаления.
+const (
+	deleteFlushInterval = 200 * time.Millisecond // Период сброса накопленных удалений в хранилище
+	deleteBatchSize     = 1000                   // Количество ссылок, при котором удаления сбрасываются досрочно
+	deleteQueueSize     = 128                    // Ёмкость канала запросов на удаление
+	deleteRetries       = 5                      // Количество попыток удаления пакета пользователя
+	deleteRetryDelay    = 100 * time.Millisecond // Пауза перед первой повторной попыткой, удваивается с каждой попыткой
+)
+
+// deleteRequest — запрос пользователя на удаление ссылок.
+type deleteRequest struct {
+	userID    string
+	shortURLs []string
+}
+
+// retryBatch — ссылки пользователя, удалить которые не удалось, и расписание следующей попытки.
+type retryBatch struct {
+	userID    string
+	shortURLs []string
+	attempt   int       // Количество выполненных попыток
+	next      time.Time // Момент следующей попытки
+}
+
+// deleteQueue — долгоживущий воркер удаления ссылок. Он накапливает запросы всех пользователей
+// и периодически сбрасывает их в хранилище одним вызовом DeleteURLs на пользователя.
+// Неудачные пакеты повторяются по расписанию, не задерживая сброс остальных.
+//
+// Очередь хранится только в памяти. При закрытии она дожидается удаления всех принятых ссылок,
+// но при аварийном завершении процесса принятые и ещё не сброшенные удаления теряются:
+// клиент, получивший 202 Accepted, должен повторить запрос, если ссылки остались.
+type deleteQueue struct {
+	service  *ShortenerService
+	requests chan deleteRequest
+
+	mu     sync.RWMutex // Исключает отправку запросов в закрытый канал
+	closed bool
+	done   chan struct{} // Закрывается, когда воркер удалил все принятые ссылки
+}
+
+// newDeleteQueue создаёт очередь удаления сервиса service и запускает её воркер.
+func newDeleteQueue(service *ShortenerService) *deleteQueue {
+	q := &deleteQueue{
+		service:  service,
+		requests: make(chan deleteRequest, deleteQueueSize),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// enqueue передаёт запрос на удаление воркеру. Если очередь закрыта, возвращает ErrShuttingDown.
+// Пока канал запросов заполнен, ожидает освобождения места или отмены ctx.
+func (q *deleteQueue) enqueue(ctx context.Context, request deleteRequest) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrShuttingDown
+	}
+	select {
+	case q.requests <- request:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close перестаёт принимать запросы и дожидается, пока воркер удалит все принятые ссылки.
+func (q *deleteQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.requests)
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+// run накапливает запросы и сбрасывает их по таймеру, при накоплении deleteBatchSize ссылок
+// и при закрытии канала запросов. По таймеру же повторяются пакеты, время попытки которых наступило.
+func (q *deleteQueue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(deleteFlushInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string][]string)
+	size := 0
+	var retries []retryBatch
+	for {
+		select {
+		case request, ok := <-q.requests:
+			if !ok {
+				q.drain(q.flush(pending, retries))
+				return
+			}
+			pending[request.userID] = append(pending[request.userID], request.shortURLs...)
+			size += len(request.shortURLs)
+			if size < deleteBatchSize {
+				continue
+			}
+		case now := <-ticker.C:
+			retries = q.retry(retries, now)
+			if size == 0 {
+				continue
+			}
+		}
+		retries = q.flush(pending, retries)
+		pending = make(map[string][]string)
+		size = 0
+	}
+}
+
+// flush удаляет накопленные ссылки каждого пользователя одним вызовом хранилища
+// и возвращает retries, дополненный пакетами, удалить которые не удалось.
+func (q *deleteQueue) flush(pending map[string][]string, retries []retryBatch) []retryBatch {
+	for userID, shortURLs := range pending {
+		retries = q.attempt(retryBatch{userID: userID, shortURLs: shortURLs}, retries)
+	}
+	return retries
+}
+
+// retry повторяет удаление пакетов, время попытки которых наступило к моменту now,
+// и возвращает пакеты, ожидающие следующей попытки.
+func (q *deleteQueue) retry(retries []retryBatch, now time.Time) []retryBatch {
+	var waiting []retryBatch
+	for _, batch := range retries {
+		if batch.next.After(now) {
+			waiting = append(waiting, batch)
+			continue
+		}
+		waiting = q.attempt(batch, waiting)
+	}
+	return waiting
+}
+
+// attempt выполняет очередную попытку удаления пакета batch. Неудачный пакет добавляется в retries
+// с паузой, удваивающейся с каждой попыткой; после deleteRetries попыток ошибка журналируется и пакет отбрасывается.
+func (q *deleteQueue) attempt(batch retryBatch, retries []retryBatch) []retryBatch {
+	err := q.delete(batch.userID, batch.shortURLs)
+	if err == nil {
+		return retries
+	}
+	batch.attempt++
+	if batch.attempt == deleteRetries {
+		logger.Log.Error("Не удалось удалить ссылки",
+			zap.String("userID", batch.userID), zap.Int("count", len(batch.shortURLs)), zap.Error(err))
+		return retries
+	}
+	logger.Log.Warn("Повторяем удаление ссылок", zap.Int("attempt", batch.attempt), zap.Error(err))
+	batch.next = time.Now().Add(deleteRetryDelay << (batch.attempt - 1))
+	return append(retries, batch)
+}
+
+// drain повторяет удаление оставшихся пакетов, пока они не будут удалены или не исчерпают попытки.
+// Вызывается при закрытии очереди, когда новых запросов уже нет, поэтому ожидает паузы между попытками.
+func (q *deleteQueue) drain(retries []retryBatch) {
+	for len(retries) > 0 {
+		next := retries[0].next
+		for _, batch := range retries[1:] {
+			if batch.next.Before(next) {
+				next = batch.next
+			}
+		}
+		time.Sleep(time.Until(next))
+		retries = q.retry(retries, time.Now())
+	}
+}
+
+// delete выполняет одну попытку удаления ссылок пользователя с таймаутом записи сервиса.
+func (q *deleteQueue) delete(userID string, shortURLs []string) error {
+	ctx, cancel := withTimeout(context.Background(), q.service.Timeouts.Write)
+	defer cancel()
+	return q.service.Storage.DeleteURLs(ctx, userID, shortURLs)
+}
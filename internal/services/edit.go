@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// HistoryEntry описывает прежний оригинальный URL ссылки.
+type HistoryEntry struct {
+	OriginalURL string    // Оригинальный URL до изменения
+	ChangedAt   time.Time // Момент, когда его заменили новым
+}
+
+// UpdateURL заменяет оригинальный URL ссылки shortID, принадлежащей пользователю userID, и возвращает
+// новый URL в каноническом виде. Прежний URL сохраняется в истории ссылки. Новый URL проверяется так же,
+// как при сокращении: недопустимый отклоняется ошибкой ErrInvalidURL, заблокированный — ErrBlocked,
+// уже сокращённый другой ссылкой — *ErrConflict. Чужая ссылка отклоняется ошибкой ErrNotOwner.
+func (s *ShortenerService) UpdateURL(ctx context.Context, userID, shortID, originalURL string) (string, error) {
+	originalURL, err := s.URLs.Normalize(originalURL)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkBlocked(originalURL); err != nil {
+		return "", err
+	}
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+	if err := s.Storage.UpdateURL(ctx, userID, shortID, originalURL); err != nil {
+		return "", err
+	}
+	return originalURL, nil
+}
+
+// History возвращает прежние оригинальные URL ссылки shortID пользователя userID от старых к новым.
+// Чужая ссылка отклоняется ошибкой ErrNotOwner.
+func (s *ShortenerService) History(ctx context.Context, userID, shortID string) ([]HistoryEntry, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Read)
+	defer cancel()
+	return s.Storage.History(ctx, userID, shortID)
+}
@@ -0,0 +1,48 @@
+package services_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortenerService_UpdateURL(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+	mockStore.On("UpdateURL", mock.Anything, "user1", "abc", "https://example.com/new").Return(nil)
+	mockStore.On("UpdateURL", mock.Anything, "user1", "abc", "https://example.org/").
+		Return(&services.ErrConflict{Existing: "def"})
+
+	// Новый URL приводится к каноническому виду так же, как при сокращении
+	originalURL, err := service.UpdateURL(context.Background(), "user1", "abc", "HTTPS://Example.com:443/new")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/new", originalURL)
+
+	_, err = service.UpdateURL(context.Background(), "user1", "abc", "https://example.org")
+	var conflict *services.ErrConflict
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "def", conflict.Existing)
+
+	_, err = service.UpdateURL(context.Background(), "user1", "abc", "ftp://example.com/")
+	assert.ErrorIs(t, err, services.ErrInvalidURL)
+	mockStore.AssertNumberOfCalls(t, "UpdateURL", 2)
+}
+
+func TestShortenerService_UpdateURL_Blocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeBlocklist(t, path, "evil.com\n")
+	blocklist, err := services.LoadBlocklist(path)
+	assert.NoError(t, err)
+
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+	service.Blocklist = blocklist
+
+	_, err = service.UpdateURL(context.Background(), "user1", "abc", "https://evil.com/")
+	assert.ErrorIs(t, err, services.ErrBlocked)
+	mockStore.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound возвращается хранилищем, если ссылка не существует.
+var ErrNotFound = errors.New("ссылка не найдена")
+
+// ErrDeleted возвращается хранилищем, если ссылка была удалена.
+var ErrDeleted = errors.New("ссылка удалена")
+
+// ErrExpired возвращается хранилищем, если срок действия ссылки истёк.
+var ErrExpired = errors.New("срок действия ссылки истёк")
+
+// ErrInvalidExpiry возвращается сервисом, если срок действия новой ссылки задан некорректно.
+var ErrInvalidExpiry = errors.New("некорректный срок действия ссылки")
+
+// ErrExhausted возвращается хранилищем, если исчерпано допустимое количество переходов по ссылке.
+var ErrExhausted = errors.New("переходы по ссылке исчерпаны")
+
+// ErrInvalidMaxClicks возвращается сервисом, если количество переходов новой ссылки задано некорректно.
+var ErrInvalidMaxClicks = errors.New("некорректное количество переходов")
+
+// ErrInvalidPassword возвращается сервисом, если пароль новой ссылки недопустим.
+var ErrInvalidPassword = errors.New("недопустимый пароль ссылки")
+
+// ErrInvalidRedirect возвращается сервисом, если статус перенаправления или время кеширования ссылки недопустимы.
+var ErrInvalidRedirect = errors.New("недопустимые параметры перенаправления")
+
+// ErrPasswordRequired возвращается сервисом при переходе по защищённой паролем ссылке без пароля.
+var ErrPasswordRequired = errors.New("для перехода по ссылке нужен пароль")
+
+// ErrWrongPassword возвращается сервисом, если пароль ссылки неверен.
+var ErrWrongPassword = errors.New("неверный пароль ссылки")
+
+// ErrTooManyAttempts возвращается сервисом, если для ссылки введено слишком много неверных паролей.
+var ErrTooManyAttempts = errors.New("слишком много неверных попыток ввода пароля")
+
+// ErrInvalidURL возвращается сервисом, если оригинальный URL недопустим. Ошибка дополняется причиной.
+var ErrInvalidURL = errors.New("недопустимый URL")
+
+// ErrInvalidTitle возвращается сервисом, если название новой ссылки недопустимо.
+var ErrInvalidTitle = errors.New("недопустимое название ссылки")
+
+// ErrBlocked возвращается сервисом, если домен оригинального URL заблокирован.
+var ErrBlocked = errors.New("домен заблокирован")
+
+// ErrNotOwner возвращается хранилищем, если ссылка принадлежит другому пользователю.
+var ErrNotOwner = errors.New("ссылка принадлежит другому пользователю")
+
+// ErrShortIDExists возвращается хранилищем, если короткий идентификатор уже занят другой ссылкой.
+var ErrShortIDExists = errors.New("короткий идентификатор уже занят")
+
+// ErrAliasTaken возвращается сервисом, если выбранный пользователем псевдоним уже занят.
+// В отличие от *ErrConflict, он не означает, что оригинальный URL уже был сокращён.
+var ErrAliasTaken = errors.New("псевдоним уже занят")
+
+// ErrInvalidAlias возвращается сервисом, если псевдоним недопустим или зарезервирован.
+var ErrInvalidAlias = errors.New("недопустимый псевдоним")
+
+// ErrShuttingDown возвращается сервисом, если он остановлен и больше не принимает запросы на удаление.
+var ErrShuttingDown = errors.New("сервис останавливается")
+
+// ErrConflict возвращается хранилищем, если оригинальный URL уже был сокращён.
+type ErrConflict struct {
+	Existing string // Короткий идентификатор уже существующей ссылки
+}
+
+// Error возвращает текст ошибки с идентификатором существующей ссылки.
+func (e *ErrConflict) Error() string {
+	return fmt.Sprintf("оригинальный URL уже сокращён: %s", e.Existing)
+}
+
+// ErrInvalidListQuery возвращается сервисом, если параметры списка ссылок заданы некорректно.
+var ErrInvalidListQuery = errors.New("некорректный запрос списка ссылок")
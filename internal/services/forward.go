@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// QueryMerge — правило объединения параметров запроса перехода с параметрами оригинального URL,
+// если параметр с тем же именем задан в обоих.
+type QueryMerge string
+
+// Правила объединения параметров запроса.
+const (
+	MergeTarget  QueryMerge = "target"  // Остаются значения оригинального URL, одноимённые параметры запроса отбрасываются
+	MergeRequest QueryMerge = "request" // Значения запроса заменяют одноимённые параметры оригинального URL
+	MergeAppend  QueryMerge = "append"  // Сохраняются значения обоих: сначала оригинального URL, затем запроса
+)
+
+// ParseQueryMerge проверяет имя правила объединения параметров. Пустое имя означает MergeTarget.
+func ParseQueryMerge(name string) (QueryMerge, error) {
+	switch merge := QueryMerge(strings.ToLower(strings.TrimSpace(name))); merge {
+	case "":
+		return MergeTarget, nil
+	case MergeTarget, MergeRequest, MergeAppend:
+		return merge, nil
+	default:
+		return "", fmt.Errorf("неизвестное правило объединения параметров запроса: %q", name)
+	}
+}
+
+// Forwarding задаёт, какие части запроса перехода передаются на оригинальный URL, если ссылка
+// не задаёт этого сама.
+type Forwarding struct {
+	Query bool       // Передавать параметры запроса перехода
+	Path  bool       // Дописывать путь после идентификатора к пути оригинального URL
+	Merge QueryMerge // Правило для параметров, заданных и в оригинальном URL, и в запросе; пустое — MergeTarget
+}
+
+// Passthrough — части запроса перехода, которые могут быть переданы на оригинальный URL.
+type Passthrough struct {
+	Path  string     // Путь после идентификатора ссылки, например "/extra/path"
+	Query url.Values // Параметры запроса перехода
+}
+
+// forward возвращает адрес перехода по ссылке с оригинальным URL target и параметрами opts:
+// при включённой передаче к нему дописываются путь и параметры запроса pass.
+// Параметры оригинального URL сохраняют свой порядок, параметры запроса добавляются после них.
+func (f Forwarding) forward(target string, opts LinkOptions, pass Passthrough) (string, error) {
+	forwardQuery := enabled(opts.ForwardQuery, f.Query) && len(pass.Query) > 0
+	forwardPath := enabled(opts.ForwardPath, f.Path) && strings.Trim(pass.Path, "/") != ""
+	if !forwardQuery && !forwardPath {
+		return target, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if forwardPath {
+		// Очистка пути не даёт выйти сегментами ".." за пределы пути оригинального URL
+		extra := path.Clean("/" + pass.Path)
+		if strings.HasSuffix(pass.Path, "/") {
+			extra += "/"
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + extra
+		u.RawPath = ""
+	}
+	if forwardQuery {
+		u.RawQuery = mergeQuery(u.RawQuery, pass.Query, f.Merge)
+	}
+	return u.String(), nil
+}
+
+// enabled возвращает настройку ссылки value, если она задана, иначе настройку сервиса fallback.
+func enabled(value *bool, fallback bool) bool {
+	if value != nil {
+		return *value
+	}
+	return fallback
+}
+
+// mergeQuery объединяет строку запроса оригинального URL rawQuery с параметрами запроса перехода request
+// по правилу merge.
+func mergeQuery(rawQuery string, request url.Values, merge QueryMerge) string {
+	request = cloneValues(request)
+	var kept []string
+	if rawQuery != "" {
+		for _, part := range strings.Split(rawQuery, "&") {
+			name, _, _ := strings.Cut(part, "=")
+			if name, err := url.QueryUnescape(name); err == nil {
+				switch {
+				case merge == MergeRequest && request.Has(name):
+					continue
+				case (merge == MergeTarget || merge == "") && request.Has(name):
+					request.Del(name)
+				}
+			}
+			kept = append(kept, part)
+		}
+	}
+	if extra := request.Encode(); extra != "" {
+		kept = append(kept, extra)
+	}
+	return strings.Join(kept, "&")
+}
+
+// cloneValues возвращает копию параметров запроса, которую можно изменять.
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for name, list := range values {
+		clone[name] = append([]string(nil), list...)
+	}
+	return clone
+}
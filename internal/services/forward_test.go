@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortenerService_Visit_Passthrough(t *testing.T) {
+	on, off := true, false
+	query := url.Values{"utm_source": {"x"}, "page": {"2"}}
+
+	tests := []struct {
+		name       string
+		forwarding services.Forwarding
+		opts       services.LinkOptions
+		target     string
+		pass       services.Passthrough
+		want       string
+	}{
+		{
+			name:   "disabled",
+			target: "https://example.com/a?page=1",
+			pass:   services.Passthrough{Path: "/extra", Query: query},
+			want:   "https://example.com/a?page=1",
+		},
+		{
+			name:       "keep target values",
+			forwarding: services.Forwarding{Query: true},
+			target:     "https://example.com/a?page=1&b=2",
+			pass:       services.Passthrough{Query: query},
+			want:       "https://example.com/a?page=1&b=2&utm_source=x",
+		},
+		{
+			name:       "request values win",
+			forwarding: services.Forwarding{Query: true, Merge: services.MergeRequest},
+			target:     "https://example.com/a?page=1&b=2",
+			pass:       services.Passthrough{Query: query},
+			want:       "https://example.com/a?b=2&page=2&utm_source=x",
+		},
+		{
+			name:       "append values",
+			forwarding: services.Forwarding{Query: true, Merge: services.MergeAppend},
+			target:     "https://example.com/a?page=1",
+			pass:       services.Passthrough{Query: query},
+			want:       "https://example.com/a?page=1&page=2&utm_source=x",
+		},
+		{
+			name:   "link enables query",
+			opts:   services.LinkOptions{ForwardQuery: &on},
+			target: "https://example.com/",
+			pass:   services.Passthrough{Query: url.Values{"q": {"a b"}}},
+			want:   "https://example.com/?q=a+b",
+		},
+		{
+			name:       "link disables query",
+			forwarding: services.Forwarding{Query: true},
+			opts:       services.LinkOptions{ForwardQuery: &off},
+			target:     "https://example.com/",
+			pass:       services.Passthrough{Query: query},
+			want:       "https://example.com/",
+		},
+		{
+			name:       "path",
+			forwarding: services.Forwarding{Path: true},
+			target:     "https://example.com/docs/?v=1",
+			pass:       services.Passthrough{Path: "/guide/intro"},
+			want:       "https://example.com/docs/guide/intro?v=1",
+		},
+		{
+			name:       "path stays inside target",
+			forwarding: services.Forwarding{Path: true},
+			target:     "https://example.com/docs",
+			pass:       services.Passthrough{Path: "/../../admin/"},
+			want:       "https://example.com/docs/admin/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			service := services.NewShortenerService("http://localhost", mockStore)
+			service.Forwarding = tt.forwarding
+			mockStore.On("Options", mock.Anything, "abc").Return(tt.target, tt.opts, nil)
+			mockStore.On("Visit", mock.Anything, "abc").Return(tt.target, nil)
+
+			got, err := service.Visit(context.Background(), "abc", services.Unlock{}, tt.pass)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Location)
+		})
+	}
+}
+
+func TestParseQueryMerge(t *testing.T) {
+	merge, err := services.ParseQueryMerge("")
+	assert.NoError(t, err)
+	assert.Equal(t, services.MergeTarget, merge)
+	merge, err = services.ParseQueryMerge(" Request ")
+	assert.NoError(t, err)
+	assert.Equal(t, services.MergeRequest, merge)
+	_, err = services.ParseQueryMerge("override")
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Base62Alphabet — алфавит коротких идентификаторов по умолчанию: цифры и латинские буквы обоих регистров.
+const Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// DefaultIDLength — длина короткого идентификатора по умолчанию.
+const DefaultIDLength = 8
+
+// IDGenerator создаёт короткие идентификаторы ссылок.
+type IDGenerator interface {
+	NewID() (string, error) // Возвращает новый случайный идентификатор
+}
+
+// RandomIDGenerator создаёт идентификаторы заданной длины из символов алфавита,
+// выбираемых криптографически стойким генератором случайных чисел.
+type RandomIDGenerator struct {
+	alphabet []rune // Допустимые символы идентификатора
+	length   int    // Длина идентификатора
+}
+
+// NewRandomIDGenerator создаёт генератор идентификаторов длины length из символов alphabet.
+// Пустой алфавит означает Base62Alphabet, нулевая длина — DefaultIDLength.
+// Алфавит должен содержать не меньше двух различных символов.
+func NewRandomIDGenerator(alphabet string, length int) (*RandomIDGenerator, error) {
+	if alphabet == "" {
+		alphabet = Base62Alphabet
+	}
+	if length == 0 {
+		length = DefaultIDLength
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("длина идентификатора должна быть положительной: %d", length)
+	}
+	symbols := []rune(alphabet)
+	seen := make(map[rune]bool, len(symbols))
+	for _, r := range symbols {
+		if seen[r] {
+			return nil, fmt.Errorf("символ %q повторяется в алфавите идентификаторов", r)
+		}
+		seen[r] = true
+	}
+	if len(symbols) < 2 {
+		return nil, errors.New("алфавит идентификаторов должен содержать не меньше двух символов")
+	}
+	return &RandomIDGenerator{alphabet: symbols, length: length}, nil
+}
+
+// NewID возвращает новый идентификатор. Символы выбираются равновероятно.
+func (g *RandomIDGenerator) NewID() (string, error) {
+	size := big.NewInt(int64(len(g.alphabet)))
+	id := make([]rune, g.length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("не удалось сгенерировать идентификатор: %w", err)
+		}
+		id[i] = g.alphabet[n.Int64()]
+	}
+	return string(id), nil
+}
@@ -0,0 +1,49 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Тест генерации идентификаторов из алфавита base62 по умолчанию
+func TestRandomIDGenerator_Default(t *testing.T) {
+	generator, err := services.NewRandomIDGenerator("", 0)
+	require.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := generator.NewID()
+		require.NoError(t, err)
+		assert.Len(t, id, services.DefaultIDLength)
+		for _, r := range id {
+			assert.True(t, strings.ContainsRune(services.Base62Alphabet, r))
+		}
+		seen[id] = true
+	}
+	assert.Len(t, seen, 1000)
+}
+
+// Тест генерации идентификаторов из собственного алфавита
+func TestRandomIDGenerator_CustomAlphabet(t *testing.T) {
+	generator, err := services.NewRandomIDGenerator("абв", 5)
+	require.NoError(t, err)
+
+	id, err := generator.NewID()
+	require.NoError(t, err)
+	assert.Equal(t, 5, len([]rune(id)))
+	assert.Empty(t, strings.Trim(id, "абв"))
+}
+
+// Тест проверки настроек генератора
+func TestNewRandomIDGenerator_Invalid(t *testing.T) {
+	_, err := services.NewRandomIDGenerator("a", 8)
+	assert.Error(t, err)
+	_, err = services.NewRandomIDGenerator("abca", 8)
+	assert.Error(t, err)
+	_, err = services.NewRandomIDGenerator("", -1)
+	assert.Error(t, err)
+}
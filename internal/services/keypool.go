@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Параметры пула ключей.
+const (
+	keyPoolInterval = time.Second     // Период проверки заполненности пула
+	keyPoolTimeout  = 5 * time.Second // Предельное время одного пополнения пула
+	keyPoolWait     = time.Second     // Сколько NewID ждёт пополнения пустого буфера
+	keyPoolAbandon  = 24 * time.Hour  // Через сколько выданный, но не занятый ссылкой ключ считается потерянным
+)
+
+// KeyStore хранит пул заранее выделенных свободных коротких идентификаторов.
+// Выданный ключ больше не выдаётся повторно, в том числе другим экземплярам сервиса,
+// работающим с тем же хранилищем. Отметка о выдаче нужна, пока ключ может быть занят ссылкой:
+// PruneKeys удаляет её, когда ключ уже занят или выдан так давно, что считается потерянным.
+type KeyStore interface {
+	AddKeys(ctx context.Context, keys []string) error                  // Добавляет ключи, пропуская уже выданные и занятые ссылками
+	TakeKeys(ctx context.Context, n int) ([]string, error)             // Атомарно забирает из пула до n ключей
+	CountKeys(ctx context.Context) (int, error)                        // Возвращает количество свободных ключей в пуле
+	PruneKeys(ctx context.Context, takenBefore time.Time) (int, error) // Удаляет выданные ключи, занятые ссылками или выданные раньше takenBefore
+}
+
+// KeyPool выдаёт короткие идентификаторы из пула, хранящегося в KeyStore.
+// Фоновая горутина пополняет пул в хранилище новыми ключами генератора, когда свободных ключей
+// становится меньше половины size, и заранее забирает четверть size в локальный буфер,
+// чтобы NewID не обращался к хранилищу. Буфер пополняется, когда опустел наполовину;
+// если он всё же пуст, NewID ждёт пополнения и возвращает ключ генератора, только если
+// хранилище не ответило за keyPoolWait: такой ключ может оказаться занятым, и сервис повторит попытку.
+type KeyPool struct {
+	store KeyStore    // Хранилище пула
+	ids   IDGenerator // Источник новых ключей
+	size  int         // Желаемое количество свободных ключей в хранилище
+
+	local chan string   // Ключи, забранные из хранилища этим экземпляром
+	wake  chan struct{} // Просит фоновую горутину пополнить буфер досрочно
+	done  chan struct{} // Закрывается при остановке пула
+	idle  chan struct{} // Закрывается, когда фоновая горутина завершилась
+}
+
+// NewKeyPool создаёт пул из size ключей в хранилище store, пополняемый генератором ids,
+// и запускает его фоновое пополнение. Пул останавливается методом Close.
+func NewKeyPool(store KeyStore, ids IDGenerator, size int) *KeyPool {
+	buffer := size / 4
+	if buffer < 1 {
+		buffer = 1
+	}
+	p := &KeyPool{
+		store: store,
+		ids:   ids,
+		size:  size,
+		local: make(chan string, buffer),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+		idle:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// NewID возвращает ключ из локального буфера пула. Если буфер пуст, ждёт его пополнения
+// не дольше keyPoolWait, а затем возвращает ключ генератора.
+func (p *KeyPool) NewID() (string, error) {
+	select {
+	case key := <-p.local:
+		if len(p.local) < cap(p.local)/2 {
+			p.refill()
+		}
+		return key, nil
+	default:
+	}
+
+	p.refill()
+	timer := time.NewTimer(keyPoolWait)
+	defer timer.Stop()
+	select {
+	case key := <-p.local:
+		return key, nil
+	case <-p.done:
+	case <-timer.C:
+		logger.Log.Warn("Пул ключей не пополнился вовремя, идентификатор выдан генератором")
+	}
+	return p.ids.NewID()
+}
+
+// refill будит фоновую горутину, не дожидаясь её реакции.
+func (p *KeyPool) refill() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close останавливает фоновое пополнение пула. Ключи, оставшиеся в локальном буфере, не возвращаются в пул.
+func (p *KeyPool) Close() {
+	close(p.done)
+	<-p.idle
+}
+
+// run пополняет пул сразу после запуска, затем периодически и по запросу NewID.
+func (p *KeyPool) run() {
+	defer close(p.idle)
+	ticker := time.NewTicker(keyPoolInterval)
+	defer ticker.Stop()
+
+	for {
+		p.fill()
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+// fill пополняет пул в хранилище и локальный буфер. Ошибки журналируются: до следующей
+// попытки NewID продолжает выдавать ключи генератора.
+func (p *KeyPool) fill() {
+	ctx, cancel := context.WithTimeout(context.Background(), keyPoolTimeout)
+	defer cancel()
+
+	if err := p.fillStore(ctx); err != nil {
+		logger.Log.Error("Не удалось пополнить пул ключей", zap.Error(err))
+		return
+	}
+	if err := p.fillLocal(ctx); err != nil {
+		logger.Log.Error("Не удалось получить ключи из пула", zap.Error(err))
+	}
+}
+
+// fillStore добавляет в хранилище новые ключи, если свободных меньше половины size.
+// Перед пополнением из хранилища удаляются выданные ключи, уже занятые ссылками или потерянные,
+// например, из-за неудачного сохранения ссылки, чтобы отметки о выдаче не накапливались.
+func (p *KeyPool) fillStore(ctx context.Context) error {
+	count, err := p.store.CountKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if count >= p.size/2 {
+		return nil
+	}
+	if _, err = p.store.PruneKeys(ctx, time.Now().Add(-keyPoolAbandon)); err != nil {
+		return err
+	}
+	keys := make([]string, 0, p.size-count)
+	for len(keys) < p.size-count {
+		key, err := p.ids.NewID()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	return p.store.AddKeys(ctx, keys)
+}
+
+// fillLocal забирает ключи из хранилища в локальный буфер, если он заполнен меньше чем наполовину.
+// В буфер пишет только фоновая горутина, поэтому забранные ключи всегда в нём помещаются.
+func (p *KeyPool) fillLocal(ctx context.Context) error {
+	free := cap(p.local) - len(p.local)
+	if free <= cap(p.local)/2 {
+		return nil
+	}
+	keys, err := p.store.TakeKeys(ctx, free)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		p.local <- key
+	}
+	return nil
+}
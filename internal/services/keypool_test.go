@@ -0,0 +1,90 @@
+package services_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingKeyStore запоминает все ключи, выданные хранилищем пула.
+type recordingKeyStore struct {
+	*storage.Storage
+	mu    sync.Mutex
+	taken map[string]bool
+}
+
+func (r *recordingKeyStore) TakeKeys(ctx context.Context, n int) ([]string, error) {
+	keys, err := r.Storage.TakeKeys(ctx, n)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		r.taken[key] = true
+	}
+	return keys, err
+}
+
+// Тест выдачи ключей двумя пулами с общим хранилищем: все ключи берутся из пула и не повторяются
+func TestKeyPool_UniqueAcrossInstances(t *testing.T) {
+	store := &recordingKeyStore{Storage: storage.NewStorage(), taken: make(map[string]bool)}
+	generator, err := services.NewRandomIDGenerator("", 0)
+	require.NoError(t, err)
+
+	first := services.NewKeyPool(store, generator, 100)
+	defer first.Close()
+	second := services.NewKeyPool(store, generator, 100)
+	defer second.Close()
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+		wg   sync.WaitGroup
+	)
+	for _, pool := range []*services.KeyPool{first, second} {
+		wg.Add(1)
+		go func(pool *services.KeyPool) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key, err := pool.NewID()
+				assert.NoError(t, err)
+				mu.Lock()
+				assert.False(t, seen[key], key)
+				seen[key] = true
+				mu.Unlock()
+			}
+		}(pool)
+	}
+	wg.Wait()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for key := range seen {
+		assert.True(t, store.taken[key], "ключ %s выдан не из пула", key)
+	}
+}
+
+// Тест сохранения ссылки с ключом из пула
+func TestKeyPool_Set(t *testing.T) {
+	store := storage.NewStorage()
+	generator, err := services.NewRandomIDGenerator("", 0)
+	require.NoError(t, err)
+	pool := services.NewKeyPool(store, generator, 10)
+	defer pool.Close()
+
+	assert.Eventually(t, func() bool {
+		count, err := store.CountKeys(context.Background())
+		return err == nil && count > 0
+	}, time.Second, 10*time.Millisecond)
+	free := store.FreeKeys()
+
+	service := services.NewShortenerService("http://localhost", store)
+	service.IDs = pool
+	shortURL, err := service.Set(context.Background(), "user1", "https://example.com")
+	require.NoError(t, err)
+	assert.NotContains(t, free, shortURL[len("http://localhost/"):])
+}
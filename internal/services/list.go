@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxListLimit — наибольший размер страницы списка ссылок пользователя.
+const MaxListLimit = 1000
+
+// ListStatus — отбор ссылок списка по признаку удаления.
+type ListStatus string
+
+// Значения отбора по признаку удаления.
+const (
+	ListActive  ListStatus = "active"  // Только неудалённые ссылки
+	ListDeleted ListStatus = "deleted" // Только удалённые ссылки
+	ListAll     ListStatus = "all"     // Все ссылки
+)
+
+// ListQuery — запрос страницы списка ссылок пользователя.
+type ListQuery struct {
+	Limit    int        // Размер страницы; 0 — весь список одной страницей
+	Cursor   string     // Курсор из предыдущей страницы; пустой — первая страница
+	Desc     bool       // Сначала новые ссылки
+	Contains string     // Подстрока оригинального URL без учёта регистра
+	Host     string     // Хост оригинального URL без учёта регистра
+	Status   ListStatus // Отбор по признаку удаления; пустой — ListAll
+}
+
+// ListCursor — позиция в списке ссылок: момент создания и идентификатор последней выданной ссылки.
+type ListCursor struct {
+	CreatedAt time.Time
+	ShortID   string
+}
+
+// ListFilter — условия выборки ссылок пользователя для хранилища. Хранилище возвращает не больше
+// Limit ссылок, упорядоченных по моменту создания, а при равенстве — по идентификатору.
+type ListFilter struct {
+	Limit    int         // Наибольшее количество ссылок; 0 — без ограничения
+	After    *ListCursor // Выдавать ссылки после этой позиции в порядке сортировки; nil — с начала
+	Desc     bool        // Порядок по убыванию
+	Contains string      // Подстрока оригинального URL в нижнем регистре; пустая — без отбора
+	Host     string      // Хост оригинального URL в нижнем регистре; пустой — без отбора
+	Status   ListStatus  // Отбор по признаку удаления
+}
+
+// LinkInfo описывает ссылку пользователя в списке.
+type LinkInfo struct {
+	ShortID     string
+	OriginalURL string
+	Title       string    // Название ссылки, заданное владельцем
+	CreatedAt   time.Time // Момент создания; нулевой, если хранилище его не знает
+	ExpiresAt   time.Time // Момент истечения срока действия; нулевой — бессрочная ссылка
+	Deleted     bool
+	DeletedAt   time.Time // Момент удаления; нулевой у неудалённых ссылок
+}
+
+// ListPage — страница списка ссылок пользователя.
+type ListPage struct {
+	Links      []LinkInfo
+	NextCursor string // Курсор следующей страницы; пустой, если страница последняя
+}
+
+// ListURLs возвращает страницу ссылок пользователя userID, отобранных и упорядоченных по запросу query.
+// Страницы выбираются по курсору, поэтому ссылки, созданные или удалённые между запросами,
+// не сдвигают уже выданные. Пустой запрос, как и до появления страниц, возвращает все ссылки
+// пользователя по возрастанию момента создания. Некорректный запрос сообщается ошибкой ErrInvalidListQuery.
+func (s *ShortenerService) ListURLs(ctx context.Context, userID string, query ListQuery) (ListPage, error) {
+	filter, err := listFilter(query)
+	if err != nil {
+		return ListPage{}, err
+	}
+	limit := filter.Limit
+	if limit > 0 {
+		filter.Limit++ // Лишняя ссылка показывает, что страница не последняя
+	}
+
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Read)
+	defer cancel()
+	links, err := s.Storage.ListURLs(ctx, userID, filter)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	page := ListPage{Links: links}
+	if limit > 0 && len(links) > limit {
+		page.Links = links[:limit]
+		last := page.Links[limit-1]
+		page.NextCursor = encodeCursor(ListCursor{CreatedAt: last.CreatedAt, ShortID: last.ShortID})
+	}
+	return page, nil
+}
+
+// listFilter проверяет запрос списка и возвращает условия выборки для хранилища.
+func listFilter(query ListQuery) (ListFilter, error) {
+	filter := ListFilter{
+		Limit:    query.Limit,
+		Desc:     query.Desc,
+		Contains: strings.ToLower(query.Contains),
+		Host:     strings.Trim(strings.ToLower(query.Host), "[]"),
+		Status:   query.Status,
+	}
+	if filter.Limit < 0 || filter.Limit > MaxListLimit {
+		return ListFilter{}, fmt.Errorf("%w: limit должен быть от 1 до %d", ErrInvalidListQuery, MaxListLimit)
+	}
+	switch filter.Status {
+	case "":
+		filter.Status = ListAll
+	case ListActive, ListDeleted, ListAll:
+	default:
+		return ListFilter{}, fmt.Errorf("%w: status должен быть active, deleted или all", ErrInvalidListQuery)
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return ListFilter{}, err
+		}
+		filter.After = &cursor
+	}
+	return filter, nil
+}
+
+// encodeCursor кодирует позицию в списке в непрозрачную для клиента строку.
+func encodeCursor(cursor ListCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + " " + cursor.ShortID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor разбирает курсор, созданный encodeCursor.
+func decodeCursor(s string) (ListCursor, error) {
+	invalid := fmt.Errorf("%w: некорректный курсор", ErrInvalidListQuery)
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ListCursor{}, invalid
+	}
+	created, shortID, found := strings.Cut(string(raw), " ")
+	createdAt, err := time.Parse(time.RFC3339Nano, created)
+	if !found || err != nil || shortID == "" {
+		return ListCursor{}, invalid
+	}
+	return ListCursor{CreatedAt: createdAt, ShortID: shortID}, nil
+}
+
+// Follows сообщает, что ссылка link стоит в списке после позиции cursor
+// при порядке по возрастанию или, если desc, по убыванию.
+func (cursor ListCursor) Follows(link LinkInfo, desc bool) bool {
+	if !link.CreatedAt.Equal(cursor.CreatedAt) {
+		return link.CreatedAt.After(cursor.CreatedAt) != desc
+	}
+	if desc {
+		return link.ShortID < cursor.ShortID
+	}
+	return link.ShortID > cursor.ShortID
+}
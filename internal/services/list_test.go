@@ -0,0 +1,88 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortenerService_ListURLs(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	created := time.Date(2024, 5, 6, 7, 8, 9, 123, time.UTC)
+	links := []services.LinkInfo{
+		{ShortID: "a", OriginalURL: "https://example.com/a", CreatedAt: created},
+		{ShortID: "b", OriginalURL: "https://example.com/b", CreatedAt: created},
+		{ShortID: "c", OriginalURL: "https://example.com/c", CreatedAt: created.Add(time.Second)},
+	}
+	// Хранилище получает на одну ссылку больше размера страницы и нормализованные отборы
+	mockStore.On("ListURLs", mock.Anything, "user1", services.ListFilter{
+		Limit: 3, Desc: true, Contains: "example", Host: "::1", Status: services.ListActive,
+	}).Return(links, nil).Once()
+
+	page, err := service.ListURLs(context.Background(), "user1", services.ListQuery{
+		Limit: 2, Desc: true, Contains: "EXAMPLE", Host: "[::1]", Status: services.ListActive,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, links[:2], page.Links)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Курсор указывает на последнюю выданную ссылку
+	mockStore.On("ListURLs", mock.Anything, "user1", services.ListFilter{
+		Limit: 3, After: &services.ListCursor{CreatedAt: created, ShortID: "b"}, Status: services.ListAll,
+	}).Return(links[2:], nil).Once()
+
+	page, err = service.ListURLs(context.Background(), "user1", services.ListQuery{
+		Limit: 2, Cursor: page.NextCursor, Status: services.ListAll,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, links[2:], page.Links)
+	assert.Empty(t, page.NextCursor)
+
+	// Пустой запрос возвращает все ссылки по возрастанию одной страницей
+	mockStore.On("ListURLs", mock.Anything, "user2", services.ListFilter{
+		Status: services.ListAll,
+	}).Return(links, nil).Once()
+
+	page, err = service.ListURLs(context.Background(), "user2", services.ListQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, links, page.Links)
+	assert.Empty(t, page.NextCursor)
+	mockStore.AssertExpectations(t)
+}
+
+func TestShortenerService_ListURLs_Invalid(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	for _, query := range []services.ListQuery{
+		{Limit: -1},
+		{Limit: services.MaxListLimit + 1},
+		{Status: "removed"},
+		{Cursor: "not a cursor"},
+		{Cursor: "YWJj"},
+	} {
+		_, err := service.ListURLs(context.Background(), "user1", query)
+		assert.True(t, errors.Is(err, services.ErrInvalidListQuery), "%+v: %v", query, err)
+	}
+	mockStore.AssertNotCalled(t, "ListURLs", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestListCursor_Follows(t *testing.T) {
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	cursor := services.ListCursor{CreatedAt: created, ShortID: "b"}
+
+	assert.True(t, cursor.Follows(services.LinkInfo{ShortID: "a", CreatedAt: created.Add(time.Second)}, false))
+	assert.True(t, cursor.Follows(services.LinkInfo{ShortID: "c", CreatedAt: created}, false))
+	assert.False(t, cursor.Follows(services.LinkInfo{ShortID: "b", CreatedAt: created}, false))
+	assert.False(t, cursor.Follows(services.LinkInfo{ShortID: "b", CreatedAt: created}, true))
+	assert.True(t, cursor.Follows(services.LinkInfo{ShortID: "a", CreatedAt: created}, true))
+	assert.True(t, cursor.Follows(services.LinkInfo{ShortID: "z", CreatedAt: created.Add(-time.Second)}, true))
+}
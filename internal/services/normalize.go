@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultMaxURLLength — наибольшая длина оригинального URL по умолчанию.
+const DefaultMaxURLLength = 2048
+
+// defaultPorts — порты схем по умолчанию, которые удаляются из канонического URL.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// trackingParams — параметры запроса, которые только отслеживают переходы и не влияют на содержимое страницы.
+// Параметры, оканчивающиеся на "_", задают префикс.
+var trackingParams = []string{"utm_", "fbclid", "gclid", "yclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_openstat"}
+
+// URLNormalizer проверяет оригинальные URL и приводит их к каноническому виду, чтобы
+// одинаковые адреса, записанные по-разному, получали одну короткую ссылку.
+type URLNormalizer struct {
+	schemes       map[string]bool // Допустимые схемы в нижнем регистре
+	maxLength     int             // Наибольшая длина URL до и после приведения
+	stripTracking bool            // Удалять параметры отслеживания
+}
+
+// NewURLNormalizer создаёт нормализатор, допускающий схемы schemes и URL не длиннее maxLength.
+// Пустой список схем означает http и https, нулевая длина — DefaultMaxURLLength.
+// Если stripTracking установлен, из запроса удаляются параметры отслеживания, например utm_source.
+func NewURLNormalizer(schemes []string, maxLength int, stripTracking bool) (*URLNormalizer, error) {
+	if maxLength == 0 {
+		maxLength = DefaultMaxURLLength
+	}
+	if maxLength < 0 {
+		return nil, fmt.Errorf("наибольшая длина URL должна быть положительной: %d", maxLength)
+	}
+	n := &URLNormalizer{schemes: make(map[string]bool), maxLength: maxLength, stripTracking: stripTracking}
+	for _, scheme := range schemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme != "" {
+			n.schemes[scheme] = true
+		}
+	}
+	if len(n.schemes) == 0 {
+		n.schemes["http"], n.schemes["https"] = true, true
+	}
+	return n, nil
+}
+
+// Normalize проверяет URL raw и возвращает его канонический вид: схема и хост в нижнем регистре,
+// интернационализированный домен в punycode, без порта схемы по умолчанию, с путём "/" вместо пустого
+// и, если включено, без параметров отслеживания. Недопустимый URL отклоняется ошибкой,
+// оборачивающей ErrInvalidURL, с указанием причины.
+func (n *URLNormalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: пустой URL", ErrInvalidURL)
+	}
+	if len(raw) > n.maxLength {
+		return "", fmt.Errorf("%w: длина больше %d символов", ErrInvalidURL, n.maxLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidURL, strings.TrimPrefix(err.Error(), "parse "))
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !n.schemes[u.Scheme] {
+		if u.Scheme == "" {
+			return "", fmt.Errorf("%w: не указана схема", ErrInvalidURL)
+		}
+		return "", fmt.Errorf("%w: схема %q не поддерживается", ErrInvalidURL, u.Scheme)
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", fmt.Errorf("%w: не указан хост", ErrInvalidURL)
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("%w: недопустимый хост %q", ErrInvalidURL, u.Hostname())
+	}
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]" // IPv6
+	default:
+		u.Host = host
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if n.stripTracking && u.RawQuery != "" {
+		u.RawQuery = stripTrackingParams(u.RawQuery)
+	}
+
+	normalized := u.String()
+	if len(normalized) > n.maxLength {
+		return "", fmt.Errorf("%w: длина больше %d символов", ErrInvalidURL, n.maxLength)
+	}
+	return normalized, nil
+}
+
+// hostProfile приводит доменные имена к punycode в нижнем регистре. В отличие от idna.Lookup
+// допускает подчёркивания в именах, которые встречаются в реальных адресах, но проверяет длину меток.
+var hostProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false), idna.VerifyDNSLength(true))
+
+// normalizeHost возвращает канонический вид хоста без квадратных скобок: IP-адрес в стандартной
+// записи или доменное имя в punycode.
+func normalizeHost(hostname string) (string, error) {
+	if ip := net.ParseIP(hostname); ip != nil {
+		return ip.String(), nil
+	}
+	if strings.ContainsAny(hostname, " \t\r\n/\\?#@:") {
+		return "", fmt.Errorf("недопустимые символы в хосте %q", hostname)
+	}
+	return hostProfile.ToASCII(hostname)
+}
+
+// stripTrackingParams удаляет из строки запроса параметры отслеживания, сохраняя порядок остальных.
+func stripTrackingParams(rawQuery string) string {
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		name, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(name); err == nil && isTrackingParam(name) {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, "&")
+}
+
+// isTrackingParam сообщает, что параметр запроса name служит только для отслеживания переходов.
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range trackingParams {
+		if name == param || strings.HasSuffix(param, "_") && strings.HasPrefix(name, param) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestURLNormalizer_Normalize(t *testing.T) {
+	normalizer, err := services.NewURLNormalizer(nil, 0, true)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "canonical", raw: "https://example.com/path?q=1", want: "https://example.com/path?q=1"},
+		{name: "case", raw: "HTTP://Example.COM/Path", want: "http://example.com/Path"},
+		{name: "spaces", raw: "  https://example.com/  ", want: "https://example.com/"},
+		{name: "empty path", raw: "https://example.com", want: "https://example.com/"},
+		{name: "default port", raw: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "default https port", raw: "https://example.com:443", want: "https://example.com/"},
+		{name: "other port", raw: "http://example.com:8080/", want: "http://example.com:8080/"},
+		{name: "idn", raw: "http://пример.рф/", want: "http://xn--e1afmkfd.xn--p1ai/"},
+		{name: "ipv4", raw: "http://127.0.0.1:80/", want: "http://127.0.0.1/"},
+		{name: "ipv6", raw: "http://[::1]:8080/", want: "http://[::1]:8080/"},
+		{name: "tracking", raw: "https://example.com/?utm_source=x&id=7&fbclid=y", want: "https://example.com/?id=7"},
+		{name: "fragment", raw: "https://example.com/#top", want: "https://example.com/#top"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizer.Normalize(tt.raw)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestURLNormalizer_Normalize_Invalid(t *testing.T) {
+	normalizer, err := services.NewURLNormalizer([]string{"https"}, 64, false)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		raw    string
+		reason string
+	}{
+		{name: "empty", raw: " ", reason: "пустой URL"},
+		{name: "no scheme", raw: "example.com", reason: "не указана схема"},
+		{name: "scheme", raw: "http://example.com/", reason: `схема "http" не поддерживается`},
+		{name: "javascript", raw: "javascript:alert(1)", reason: `схема "javascript" не поддерживается`},
+		{name: "no host", raw: "https:///path", reason: "не указан хост"},
+		{name: "bad host", raw: "https://x..y/", reason: "недопустимый хост"},
+		{name: "too long", raw: "https://example.com/" + strings.Repeat("a", 64), reason: "длина больше 64 символов"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := normalizer.Normalize(tt.raw)
+			assert.ErrorIs(t, err, services.ErrInvalidURL)
+			assert.ErrorContains(t, err, tt.reason)
+		})
+	}
+}
+
+func TestShortenerService_SetBatch_Canonical(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+	defer service.Close()
+
+	mockStore.On("CreateBatch", mock.Anything, "user1", mock.MatchedBy(func(items []services.BatchItem) bool {
+		return len(items) == 1 && items[0].OriginalURL == "http://example.com/"
+	})).Return(nil)
+
+	results, err := service.SetBatch(context.Background(), "user1", []services.BatchURL{
+		{CorrelationID: "1", OriginalURL: "HTTP://Example.com:80"},
+		{CorrelationID: "2", OriginalURL: "http://example.com/"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, results[0].ShortURL, results[1].ShortURL)
+
+	_, err = service.SetBatch(context.Background(), "user1", []services.BatchURL{{CorrelationID: "1", OriginalURL: "ftp://example.com/"}})
+	assert.ErrorIs(t, err, services.ErrInvalidURL)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Ограничение неверных попыток ввода пароля ссылки.
+const (
+	passwordAttempts = 5                // Допустимое количество неверных паролей за окно
+	passwordWindow   = 15 * time.Minute // Окно подсчёта неверных паролей
+)
+
+// Unlock — пароль защищённой ссылки, введённый клиентом. Неверные попытки ограничиваются
+// для каждой пары ссылки и адреса клиента, поэтому подбор пароля с одного адреса
+// не блокирует ссылку для остальных посетителей.
+type Unlock struct {
+	Password string // Введённый пароль; пустой, если клиент его не указал
+	Client   string // Адрес клиента
+}
+
+// hashPassword возвращает bcrypt-хеш пароля со случайной солью.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", fmt.Errorf("%w: %w", ErrInvalidPassword, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword проверяет пароль ссылки shortID, введённый клиентом, не засчитывая переход.
+// Если ссылка не защищена паролем, возвращает nil. Если пароль не указан, возвращает
+// ErrPasswordRequired, если неверен — ErrWrongPassword. После passwordAttempts неверных
+// попыток клиента за passwordWindow его проверки ссылки отклоняются ошибкой ErrTooManyAttempts до конца окна.
+func (s *ShortenerService) CheckPassword(ctx context.Context, shortID string, unlock Unlock) error {
+	_, opts, err := s.linkOptions(ctx, shortID)
+	if err != nil {
+		return err
+	}
+	return s.checkPassword(shortID, opts.PasswordHash, unlock)
+}
+
+// checkPassword сверяет пароль, введённый клиентом, с сохранённым хешем hash ссылки shortID.
+func (s *ShortenerService) checkPassword(shortID, hash string, unlock Unlock) error {
+	if hash == "" {
+		return nil
+	}
+	if unlock.Password == "" {
+		return ErrPasswordRequired
+	}
+	key := attemptKey{shortID: shortID, client: unlock.Client}
+	if !s.passwords.attempt(key, time.Now()) {
+		return ErrTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(unlock.Password)) != nil {
+		return ErrWrongPassword
+	}
+	s.passwords.reset(key)
+	return nil
+}
+
+// attemptKey — ссылка и адрес клиента, для которых считаются попытки ввода пароля.
+type attemptKey struct {
+	shortID string
+	client  string
+}
+
+// attemptWindow — попытки ввода пароля ссылки одним клиентом в текущем окне.
+type attemptWindow struct {
+	count int       // Количество попыток
+	since time.Time // Начало окна
+}
+
+// passwordLimiter ограничивает количество неверных попыток ввода пароля для каждой пары ссылки и клиента.
+type passwordLimiter struct {
+	mu      sync.Mutex
+	windows map[attemptKey]*attemptWindow // Попытки по ссылке и клиенту
+	pruned  time.Time                     // Момент последнего удаления закончившихся окон
+}
+
+// newPasswordLimiter создаёт пустой ограничитель попыток.
+func newPasswordLimiter() *passwordLimiter {
+	return &passwordLimiter{windows: make(map[attemptKey]*attemptWindow)}
+}
+
+// attempt учитывает попытку ввода пароля по ключу key в момент now и сообщает, разрешена ли она.
+// Попытка учитывается до проверки пароля, поэтому одновременные запросы не превышают лимит;
+// после верного пароля попытки сбрасываются методом reset. Закончившееся окно ключа начинается заново,
+// а окна остальных ключей удаляются не чаще раза за passwordWindow, чтобы ограничитель не рос бесконечно.
+func (l *passwordLimiter) attempt(key attemptKey, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.pruned) >= passwordWindow {
+		l.pruneLocked(now)
+	}
+	f, exists := l.windows[key]
+	if !exists || now.Sub(f.since) >= passwordWindow {
+		f = &attemptWindow{since: now}
+		l.windows[key] = f
+	}
+	if f.count >= passwordAttempts {
+		return false
+	}
+	f.count++
+	return true
+}
+
+// pruneLocked удаляет окна, закончившиеся к моменту now. Вызывающая сторона должна удерживать l.mu.
+func (l *passwordLimiter) pruneLocked(now time.Time) {
+	for key, f := range l.windows {
+		if now.Sub(f.since) >= passwordWindow {
+			delete(l.windows, key)
+		}
+	}
+	l.pruned = now
+}
+
+// reset забывает попытки по ключу key после ввода верного пароля.
+func (l *passwordLimiter) reset(key attemptKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.windows, key)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxTitleLength — наибольшая длина названия ссылки в символах.
+const MaxTitleLength = 200
+
+// LinkPreview описывает ссылку для страницы предпросмотра.
+type LinkPreview struct {
+	OriginalURL string    // Оригинальный URL; пустой у ссылки с паролем
+	Title       string    // Название ссылки, заданное владельцем
+	CreatedAt   time.Time // Момент создания; нулевой, если хранилище его не знает
+	Protected   bool      // Ссылка защищена паролем
+}
+
+// Preview возвращает сведения о ссылке shortID, не засчитывая переход по ней.
+// Недоступная ссылка сообщается теми же ошибками, что и при переходе, ссылка на заблокированный
+// домен — ErrBlocked. Оригинальный URL ссылки с паролем не раскрывается.
+func (s *ShortenerService) Preview(ctx context.Context, shortID string) (LinkPreview, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Read)
+	defer cancel()
+	preview, err := s.Storage.Preview(ctx, shortID)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	if err := s.checkBlocked(preview.OriginalURL); err != nil {
+		return LinkPreview{}, err
+	}
+	if preview.Protected {
+		preview.OriginalURL = ""
+	}
+	return preview, nil
+}
+
+// checkTitle проверяет название ссылки и возвращает его без пробелов по краям.
+func checkTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	switch {
+	case !utf8.ValidString(title):
+		return "", fmt.Errorf("%w: некорректная кодировка", ErrInvalidTitle)
+	case utf8.RuneCountInString(title) > MaxTitleLength:
+		return "", fmt.Errorf("%w: длиннее %d символов", ErrInvalidTitle, MaxTitleLength)
+	case strings.IndexFunc(title, unicode.IsControl) >= 0:
+		return "", fmt.Errorf("%w: управляющие символы не допускаются", ErrInvalidTitle)
+	}
+	return title, nil
+}
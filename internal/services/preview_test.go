@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortenerService_Preview(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	mockStore.On("Preview", mock.Anything, "abc").
+		Return(services.LinkPreview{OriginalURL: "https://example.com/", Title: "Пример", CreatedAt: createdAt}, nil)
+	mockStore.On("Preview", mock.Anything, "locked").
+		Return(services.LinkPreview{OriginalURL: "https://example.org/secret", Protected: true}, nil)
+	mockStore.On("Preview", mock.Anything, "gone").Return(services.LinkPreview{}, services.ErrDeleted)
+
+	preview, err := service.Preview(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, services.LinkPreview{OriginalURL: "https://example.com/", Title: "Пример", CreatedAt: createdAt}, preview)
+
+	// Адрес ссылки с паролем не раскрывается
+	preview, err = service.Preview(context.Background(), "locked")
+	assert.NoError(t, err)
+	assert.True(t, preview.Protected)
+	assert.Empty(t, preview.OriginalURL)
+
+	_, err = service.Preview(context.Background(), "gone")
+	assert.ErrorIs(t, err, services.ErrDeleted)
+}
+
+func TestShortenerService_SetLink_Title(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	mockStore.On("Create", mock.Anything, "https://example.com/", mock.Anything, "user1",
+		mock.MatchedBy(func(opts services.LinkOptions) bool { return opts.Title == "Пример" })).Return(nil)
+
+	_, err := service.SetLink(context.Background(), "user1", "https://example.com/", "", services.LinkOptions{Title: "  Пример "})
+	assert.NoError(t, err)
+
+	for _, title := range []string{strings.Repeat("я", services.MaxTitleLength+1), "строка\nперевод", "\xff"} {
+		_, err = service.SetLink(context.Background(), "user1", "https://example.com/", "", services.LinkOptions{Title: title})
+		assert.ErrorIs(t, err, services.ErrInvalidTitle)
+	}
+	mockStore.AssertNumberOfCalls(t, "Create", 1)
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/qrcode"
+)
+
+// QRCode возвращает QR-код полной короткой ссылки shortID с уровнем коррекции level.
+// Переход по ссылке не засчитывается. Недоступная ссылка сообщается теми же ошибками,
+// что и при переходе по ней, ссылка на заблокированный домен — ErrBlocked.
+func (s *ShortenerService) QRCode(ctx context.Context, shortID string, level qrcode.Level) (*qrcode.Code, error) {
+	if _, err := s.Preview(ctx, shortID); err != nil {
+		return nil, err
+	}
+	return qrcode.Encode([]byte(s.ShortURL(shortID)), level)
+}
@@ -0,0 +1,27 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/qrcode"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortenerService_QRCode(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	mockStore.On("Preview", mock.Anything, "abc").Return(services.LinkPreview{OriginalURL: "https://example.com/"}, nil)
+	mockStore.On("Preview", mock.Anything, "gone").Return(services.LinkPreview{}, services.ErrExpired)
+
+	code, err := service.QRCode(context.Background(), "abc", qrcode.High)
+	assert.NoError(t, err)
+	assert.Equal(t, qrcode.High, code.Level)
+	assert.Equal(t, 3, code.Version) // 20 байт с уровнем H помещаются только в версию 3
+	_, err = service.QRCode(context.Background(), "gone", qrcode.Medium)
+	assert.ErrorIs(t, err, services.ErrExpired)
+	mockStore.AssertNotCalled(t, "Visit", mock.Anything, mock.Anything)
+}
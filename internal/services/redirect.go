@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultRedirectCode — HTTP-статус перенаправления по умолчанию.
+const DefaultRedirectCode = http.StatusTemporaryRedirect
+
+// RedirectDefaults задаёт статус перенаправления и время его кеширования для ссылок,
+// которые не задают их сами.
+type RedirectDefaults struct {
+	Code   int // HTTP-статус перенаправления: 301, 302, 307 или 308
+	MaxAge int // Время кеширования перенаправления в секундах; 0 — без кеширования
+}
+
+// NewRedirectDefaults проверяет статус перенаправления code и время кеширования maxAge по умолчанию.
+// Нулевой статус означает DefaultRedirectCode.
+func NewRedirectDefaults(code, maxAge int) (RedirectDefaults, error) {
+	if code == 0 {
+		code = DefaultRedirectCode
+	}
+	if err := checkRedirect(code, &maxAge); err != nil {
+		return RedirectDefaults{}, err
+	}
+	return RedirectDefaults{Code: code, MaxAge: maxAge}, nil
+}
+
+// Redirect описывает ответ на переход по короткой ссылке.
+type Redirect struct {
+	Location string // Адрес перехода
+	Code     int    // HTTP-статус перенаправления
+	MaxAge   int    // Время, в течение которого перенаправление можно кешировать, в секундах
+	NoStore  bool   // Перенаправление нельзя сохранять в кеше: каждый переход проверяется сервисом
+}
+
+// checkRedirect проверяет статус перенаправления code и время кеширования maxAge ссылки.
+// Нулевой статус и незаданное время означают настройки сервиса.
+func checkRedirect(code int, maxAge *int) error {
+	switch code {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("%w: статус %d не поддерживается, допустимы 301, 302, 307 и 308", ErrInvalidRedirect, code)
+	}
+	if maxAge != nil && *maxAge < 0 {
+		return fmt.Errorf("%w: время кеширования не может быть отрицательным", ErrInvalidRedirect)
+	}
+	return nil
+}
+
+// redirect возвращает перенаправление на адрес location по ссылке с параметрами opts в момент now.
+// Ссылки с паролем или ограничением переходов не кешируются, иначе браузер или CDN обходили бы
+// проверку пароля и подсчёт переходов; кеширование ссылки со сроком действия не продлевает его.
+func (d RedirectDefaults) redirect(location string, opts LinkOptions, now time.Time) Redirect {
+	r := Redirect{Location: location, Code: d.Code, MaxAge: d.MaxAge}
+	if opts.RedirectCode != 0 {
+		r.Code = opts.RedirectCode
+	}
+	if r.Code == 0 {
+		r.Code = DefaultRedirectCode
+	}
+	if opts.CacheMaxAge != nil {
+		r.MaxAge = *opts.CacheMaxAge
+	}
+	if opts.PasswordHash != "" || opts.MaxClicks > 0 {
+		r.MaxAge, r.NoStore = 0, true
+	}
+	if !opts.ExpiresAt.IsZero() {
+		if left := int(opts.ExpiresAt.Sub(now) / time.Second); left < r.MaxAge {
+			r.MaxAge = max(left, 0)
+		}
+	}
+	return r
+}
@@ -0,0 +1,64 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortenerService_Visit_Redirect(t *testing.T) {
+	day, zero := 86400, 0
+	defaults, err := services.NewRedirectDefaults(0, 60)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		opts services.LinkOptions
+		want services.Redirect
+	}{
+		{name: "defaults", want: services.Redirect{Code: 307, MaxAge: 60}},
+		{name: "permanent", opts: services.LinkOptions{RedirectCode: 301, CacheMaxAge: &day}, want: services.Redirect{Code: 301, MaxAge: day}},
+		{name: "no cache", opts: services.LinkOptions{RedirectCode: 302, CacheMaxAge: &zero}, want: services.Redirect{Code: 302}},
+		{name: "limited", opts: services.LinkOptions{MaxClicks: 3, CacheMaxAge: &day}, want: services.Redirect{Code: 307, NoStore: true}},
+		{
+			name: "expiring",
+			opts: services.LinkOptions{RedirectCode: 308, CacheMaxAge: &day, ExpiresAt: time.Now().Add(time.Hour)},
+			want: services.Redirect{Code: 308, MaxAge: 3599},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(MockStore)
+			service := services.NewShortenerService("http://localhost", mockStore)
+			service.Redirects = defaults
+			mockStore.On("Options", mock.Anything, "abc").Return("https://example.com/", tt.opts, nil)
+			mockStore.On("Visit", mock.Anything, "abc").Return("https://example.com/", nil)
+
+			redirect, err := service.Visit(context.Background(), "abc", services.Unlock{}, services.Passthrough{})
+			assert.NoError(t, err)
+			tt.want.Location = "https://example.com/"
+			if tt.name == "expiring" {
+				assert.InDelta(t, tt.want.MaxAge, redirect.MaxAge, 2)
+				redirect.MaxAge = tt.want.MaxAge
+			}
+			assert.Equal(t, tt.want, redirect)
+		})
+	}
+}
+
+func TestNewRedirectDefaults(t *testing.T) {
+	_, err := services.NewRedirectDefaults(303, 0)
+	assert.ErrorIs(t, err, services.ErrInvalidRedirect)
+	_, err = services.NewRedirectDefaults(301, -1)
+	assert.ErrorIs(t, err, services.ErrInvalidRedirect)
+
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+	_, err = service.SetLink(context.Background(), "user1", "https://example.com/", "", services.LinkOptions{RedirectCode: 200})
+	assert.ErrorIs(t, err, services.ErrInvalidRedirect)
+	mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultRestoreGrace — время после удаления, в течение которого ссылку можно восстановить по умолчанию.
+const DefaultRestoreGrace = 7 * 24 * time.Hour
+
+// RestoreStatus — результат восстановления одной ссылки.
+type RestoreStatus string
+
+// Результаты восстановления ссылки.
+const (
+	RestoreRestored   RestoreStatus = "restored"      // Ссылка восстановлена
+	RestoreNotFound   RestoreStatus = "not_found"     // Ссылка не существует
+	RestoreNotOwner   RestoreStatus = "not_owner"     // Ссылка принадлежит другому пользователю
+	RestoreNotDeleted RestoreStatus = "not_deleted"   // Ссылка не удалена
+	RestoreExpired    RestoreStatus = "grace_expired" // Время восстановления истекло, удаление окончательное
+	RestoreConflict   RestoreStatus = "conflict"      // Оригинальный URL после удаления сокращён другой ссылкой
+)
+
+// RestoreItem описывает восстановление одной ссылки. Хранилище заполняет Status
+// и для конфликта — Existing, идентификатор ссылки, которой теперь принадлежит оригинальный URL.
+type RestoreItem struct {
+	ShortURL string        // Короткий идентификатор
+	Status   RestoreStatus // Результат восстановления
+	Existing string        // Идентификатор ссылки с тем же оригинальным URL при конфликте
+}
+
+// RestoreURLs восстанавливает удалённые ссылки shortURLs пользователя userID и возвращает
+// результат для каждой из них в том же порядке. Ссылка восстанавливается, если она удалена
+// не раньше чем Grace назад и её оригинальный URL не сокращён заново; после этого удаление окончательное.
+// Ссылки, ещё ожидающие в очереди удаления, могут быть удалены уже после восстановления.
+func (s *ShortenerService) RestoreURLs(ctx context.Context, userID string, shortURLs []string) ([]RestoreItem, error) {
+	items := make([]RestoreItem, len(shortURLs))
+	for i, shortURL := range shortURLs {
+		items[i].ShortURL = shortURL
+	}
+	if len(items) == 0 {
+		return items, nil
+	}
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+	if err := s.Storage.RestoreURLs(ctx, userID, items, time.Now().Add(-s.Grace)); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,41 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortenerService_RestoreURLs(t *testing.T) {
+	mockStore := new(MockStore)
+	service := services.NewShortenerService("http://localhost", mockStore)
+	service.Grace = time.Hour
+
+	mockStore.On("RestoreURLs", mock.Anything, "user1", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			items := args.Get(2).([]services.RestoreItem)
+			items[0].Status = services.RestoreRestored
+			items[1].Status, items[1].Existing = services.RestoreConflict, "xyz"
+
+			// Восстанавливаются только ссылки, удалённые в пределах Grace
+			deletedAfter := args.Get(3).(time.Time)
+			assert.WithinDuration(t, time.Now().Add(-time.Hour), deletedAfter, time.Minute)
+		}).
+		Return(nil)
+
+	items, err := service.RestoreURLs(context.Background(), "user1", []string{"abc", "def"})
+	assert.NoError(t, err)
+	assert.Equal(t, []services.RestoreItem{
+		{ShortURL: "abc", Status: services.RestoreRestored},
+		{ShortURL: "def", Status: services.RestoreConflict, Existing: "xyz"},
+	}, items)
+
+	items, err = service.RestoreURLs(context.Background(), "user1", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+	mockStore.AssertNumberOfCalls(t, "RestoreURLs", 1)
+}
@@ -1,130 +1,398 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
-	"github.com/google/uuid"
-	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
-	"go.uber.org/zap"
+	"time"
 )
 
-// Store определяет интерфейс взаимодействия с хранилищем URL.
+// Store определяет единый интерфейс хранилища URL, которому удовлетворяют память, файл и Postgres.
+// Отмена контекста прерывает операцию. Недоступная ссылка сообщается ошибками ErrNotFound, ErrDeleted,
+// ErrExpired и ErrExhausted, уже сокращённый оригинальный URL — *ErrConflict, чужая ссылка — ErrNotOwner.
 type Store interface {
-	PingStore() error                                                          // Проверяет соединение с хранилищем
-	Create(originalURL, shortURL, UserID string) error                         // Создаёт новую запись URL
-	Get(shortID string, originalURL string) (string, error)                    // Извлекает оригинальный URL по сокращенному
-	GetFull(userID string, BaseURL string) ([]map[string]string, error)        // Извлекает все URL пользователя
-	DeleteURLs(userID string, shortURL string, updateChan chan<- string) error // Удаляет URL
+	PingStore(ctx context.Context) error                                                               // Проверяет соединение с хранилищем
+	Create(ctx context.Context, originalURL, shortURL, UserID string, opts LinkOptions) error          // Создаёт новую запись URL
+	CreateBatch(ctx context.Context, userID string, items []BatchItem) error                           // Атомарно создаёт пакет записей URL
+	Get(ctx context.Context, shortID string, originalURL string) (string, error)                       // Извлекает оригинальный URL по сокращенному
+	Visit(ctx context.Context, shortID string) (string, error)                                         // Засчитывает переход и возвращает оригинальный URL
+	Options(ctx context.Context, shortID string) (string, LinkOptions, error)                          // Возвращает оригинальный URL и сохранённые параметры ссылки
+	ListURLs(ctx context.Context, userID string, filter ListFilter) ([]LinkInfo, error)                // Возвращает страницу URL пользователя
+	DeleteURLs(ctx context.Context, userID string, shortURLs []string) error                           // Удаляет URL пользователя, освобождая их оригинальные URL
+	UpdateURL(ctx context.Context, userID, shortID, originalURL string) error                          // Заменяет оригинальный URL, сохраняя прежний в истории
+	History(ctx context.Context, userID, shortID string) ([]HistoryEntry, error)                       // Возвращает прежние оригинальные URL ссылки
+	RestoreURLs(ctx context.Context, userID string, items []RestoreItem, deletedAfter time.Time) error // Восстанавливает URL пользователя, удалённые позже deletedAfter
+	Preview(ctx context.Context, shortID string) (LinkPreview, error)                                  // Возвращает сведения о ссылке без перехода
+	PurgeExpired(ctx context.Context, before time.Time) (int, error)                                   // Удаляет ссылки, истёкшие раньше before
 }
 
-// Repository определяет интерфейс для работы с кэшем.
-type Repository interface {
-	Set(shortID string, originalURL string) // Сохраняет URL в кэш
-	Get(shortID string) (string, bool)      // Извлекает URL из кэша
+// LinkOptions описывает необязательные параметры короткой ссылки.
+// Пароль передаётся сервису в открытом виде в поле Password, а хранилище получает только его хеш.
+type LinkOptions struct {
+	ExpiresAt    time.Time // Момент истечения срока действия; нулевое значение — бессрочная ссылка
+	MaxClicks    int       // Допустимое количество переходов; 0 — без ограничения
+	Password     string    // Пароль ссылки в открытом виде; хранилищу не передаётся
+	PasswordHash string    // Солёный хеш пароля ссылки; пустой — ссылка без пароля
+	ForwardQuery *bool     // Передавать параметры запроса перехода; nil — по настройке сервиса
+	ForwardPath  *bool     // Дописывать путь после идентификатора; nil — по настройке сервиса
+	RedirectCode int       // HTTP-статус перенаправления; 0 — по настройке сервиса
+	CacheMaxAge  *int      // Время кеширования перенаправления в секундах; nil — по настройке сервиса
+	Title        string    // Название ссылки, заданное владельцем и показываемое на странице предпросмотра
+}
+
+// Expired сообщает, истёк ли к моменту now срок действия ссылки с параметрами o.
+func (o LinkOptions) Expired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
+
+// Shared сообщает, что у ссылки нет собственных параметров. Только такая ссылка занимает свой
+// оригинальный URL и выдаётся каждому, кто сокращает его без параметров: ссылку с паролем,
+// сроком действия или другими настройками получает лишь её создатель.
+func (o LinkOptions) Shared() bool {
+	return o.ExpiresAt.IsZero() && o.MaxClicks == 0 && o.Password == "" && o.PasswordHash == "" &&
+		o.ForwardQuery == nil && o.ForwardPath == nil && o.RedirectCode == 0 && o.CacheMaxAge == nil && o.Title == ""
+}
+
+// BatchItem описывает одну ссылку пакетного сохранения. Оригинальные URL в пакете не повторяются.
+// Если ссылка без параметров, а её оригинальный URL уже занят такой же ссылкой, хранилище
+// заменяет ShortURL идентификатором существующей ссылки и устанавливает Conflict.
+type BatchItem struct {
+	OriginalURL string      // Оригинальный URL
+	ShortURL    string      // Короткий идентификатор
+	Options     LinkOptions // Параметры новой ссылки
+	Conflict    bool        // Оригинальный URL уже был сокращён ранее
+}
+
+// BatchURL описывает оригинальный URL пакетного запроса вместе с идентификатором корреляции.
+type BatchURL struct {
+	CorrelationID string      // Идентификатор корреляции, заданный клиентом
+	OriginalURL   string      // Оригинальный URL
+	Alias         string      // Псевдоним, выбранный пользователем; пустой — идентификатор генерируется
+	Options       LinkOptions // Параметры ссылки
+}
+
+// BatchResult описывает результат сокращения одного URL пакетного запроса.
+type BatchResult struct {
+	CorrelationID string // Идентификатор корреляции из запроса
+	ShortURL      string // Полная короткая ссылка
+	Conflict      bool   // Оригинальный URL уже был сокращён ранее
+}
+
+// Timeouts задаёт предельное время операций с хранилищем. Нулевое значение снимает ограничение.
+type Timeouts struct {
+	Read  time.Duration // Чтение ссылок
+	Write time.Duration // Создание и удаление ссылок
+	Ping  time.Duration // Проверка соединения
 }
 
 // ShortenerService предоставляет функционал для создания и управления короткими ссылками.
 type ShortenerService struct {
-	BaseURL   string     // Базовый URL для генерации коротких ссылок
-	Storage   Repository // Кэш-хранилище ссылок
-	db        Store      // Хранилище данных (БД)
-	dbDNSTurn bool       // Флаг использования БД для хранения ссылок
+	BaseURL    string           // Базовый URL для генерации коротких ссылок
+	Storage    Store            // Хранилище ссылок, выбранное при запуске приложения
+	Timeouts   Timeouts         // Предельное время операций с хранилищем
+	IDs        IDGenerator      // Генератор коротких идентификаторов
+	URLs       *URLNormalizer   // Проверка и приведение оригинальных URL к каноническому виду
+	Blocklist  *Blocklist       // Заблокированные домены; nil отключает блокировку
+	Forwarding Forwarding       // Передача пути и параметров запроса перехода по умолчанию
+	Redirects  RedirectDefaults // Статус перенаправления и время кеширования по умолчанию
+	Grace      time.Duration    // Время после удаления, в течение которого ссылку можно восстановить
+
+	reserved  map[string]bool  // Слова, запрещённые в качестве псевдонимов, в нижнем регистре
+	deletes   *deleteQueue     // Очередь фонового удаления ссылок
+	passwords *passwordLimiter // Ограничение неверных попыток ввода пароля
 }
 
-// NewShortenerService создаёт и возвращает новый экземпляр сервиса сокращения ссылок.
-func NewShortenerService(BaseURL string, storage Repository, db Store, dbDNSTurn bool) *ShortenerService {
-	return &ShortenerService{
+// NewShortenerService создаёт и возвращает новый экземпляр сервиса сокращения ссылок
+// с генератором идентификаторов base62 длины DefaultIDLength, нормализатором URL со схемами http и https,
+// перенаправлением со статусом DefaultRedirectCode без кеширования, восстановлением удалённых ссылок
+// в течение DefaultRestoreGrace и запускает его воркер удаления. Воркер останавливается методом Close.
+func NewShortenerService(BaseURL string, storage Store) *ShortenerService {
+	s := &ShortenerService{
 		BaseURL:   BaseURL,
 		Storage:   storage,
-		db:        db,
-		dbDNSTurn: dbDNSTurn,
+		IDs:       &RandomIDGenerator{alphabet: []rune(Base62Alphabet), length: DefaultIDLength},
+		URLs:      &URLNormalizer{schemes: map[string]bool{"http": true, "https": true}, maxLength: DefaultMaxURLLength},
+		Redirects: RedirectDefaults{Code: DefaultRedirectCode},
+		Grace:     DefaultRestoreGrace,
+		passwords: newPasswordLimiter(),
 	}
+	s.deletes = newDeleteQueue(s)
+	return s
 }
 
-// GetExistURL проверяет наличие ошибки уникальности и возвращает существующую короткую ссылку, если таковая уже имеется.
-func (s *ShortenerService) GetExistURL(originalURL string, err error) (string, error) {
-	var pgErr *pgconn.PgError
-	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-		shortID, err := s.GetRep("", originalURL)
-		shortURL := fmt.Sprintf("%s/%s", s.BaseURL, shortID)
-		return shortURL, err
+// GetExistURL возвращает существующую короткую ссылку, если err сообщает о конфликте ErrConflict.
+func (s *ShortenerService) GetExistURL(err error) (string, bool) {
+	var conflict *ErrConflict
+	if !errors.As(err, &conflict) {
+		return "", false
 	}
-	return "", err
+	return s.ShortURL(conflict.Existing), true
 }
 
+// ShortURL возвращает полную короткую ссылку для идентификатора shortID.
+func (s *ShortenerService) ShortURL(shortID string) string {
+	return fmt.Sprintf("%s/%s", s.BaseURL, shortID)
+}
+
+// idAttempts — количество попыток сохранить ссылку, если сгенерированный идентификатор уже занят.
+const idAttempts = 5
+
 // Set генерирует короткую ссылку для заданного originalURL и сохраняет её в хранилище.
-func (s *ShortenerService) Set(userID, originalURL string) (string, error) {
-	shortID := randSeq()
-	if s.dbDNSTurn {
-		if err := s.CreateRep(originalURL, shortID, userID); err != nil {
+// Если сгенерированный идентификатор уже занят, повторяет попытку с новым идентификатором.
+func (s *ShortenerService) Set(ctx context.Context, userID, originalURL string) (string, error) {
+	return s.SetLink(ctx, userID, originalURL, "", LinkOptions{})
+}
+
+// SetLink сохраняет originalURL с параметрами opts под псевдонимом alias или, если он пуст,
+// под сгенерированным идентификатором; занятый сгенерированный идентификатор заменяется новым.
+// Если псевдоним уже занят, возвращает ErrAliasTaken; если оригинальный URL уже сокращён ссылкой
+// без параметров, а opts тоже их не задают, — *ErrConflict (см. LinkOptions.Shared);
+// если срок действия уже истёк — ErrInvalidExpiry; если URL недопустим — ErrInvalidURL;
+// если его домен заблокирован — ErrBlocked.
+// Сохраняется канонический вид URL, поэтому одинаковые адреса, записанные по-разному, считаются одним.
+func (s *ShortenerService) SetLink(ctx context.Context, userID, originalURL, alias string, opts LinkOptions) (string, error) {
+	originalURL, err := s.URLs.Normalize(originalURL)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkBlocked(originalURL); err != nil {
+		return "", err
+	}
+	opts, err = s.prepareOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	if alias != "" {
+		if err := s.ValidateAlias(alias); err != nil {
+			return "", err
+		}
+		err := s.CreateRep(ctx, originalURL, alias, userID, opts)
+		if errors.Is(err, ErrShortIDExists) {
+			return "", fmt.Errorf("%w: %s", ErrAliasTaken, alias)
+		}
+		if err != nil {
+			return "", err
+		}
+		return s.ShortURL(alias), nil
+	}
+
+	for attempt := 0; attempt < idAttempts; attempt++ {
+		shortID, err := s.IDs.NewID()
+		if err != nil {
 			return "", err
 		}
-	} else {
-		s.Storage.Set(shortID, originalURL)
+		err = s.CreateRep(ctx, originalURL, shortID, userID, opts)
+		if errors.Is(err, ErrShortIDExists) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return s.ShortURL(shortID), nil
 	}
-	shortURL := fmt.Sprintf("%s/%s", s.BaseURL, shortID)
-	return shortURL, nil
+	return "", fmt.Errorf("не удалось подобрать свободный идентификатор за %d попыток: %w", idAttempts, ErrShortIDExists)
 }
 
-// randSeq генерирует уникальный идентификатор (UUID) для короткой ссылки.
-func randSeq() string {
-	return uuid.New().String()
+// prepareOptions проверяет параметры новой ссылки и заменяет пароль его хешем.
+func (s *ShortenerService) prepareOptions(opts LinkOptions) (LinkOptions, error) {
+	if opts.Expired(time.Now()) {
+		return opts, fmt.Errorf("%w: %s", ErrInvalidExpiry, opts.ExpiresAt.Format(time.RFC3339))
+	}
+	if opts.MaxClicks < 0 {
+		return opts, fmt.Errorf("%w: %d", ErrInvalidMaxClicks, opts.MaxClicks)
+	}
+	if err := checkRedirect(opts.RedirectCode, opts.CacheMaxAge); err != nil {
+		return opts, err
+	}
+	title, err := checkTitle(opts.Title)
+	if err != nil {
+		return opts, err
+	}
+	opts.Title = title
+	if opts.Password != "" {
+		hash, err := hashPassword(opts.Password)
+		if err != nil {
+			return opts, err
+		}
+		opts.Password, opts.PasswordHash = "", hash
+	}
+	return opts, nil
 }
 
-// Get возвращает оригинальный URL, используя короткий идентификатор, проверяя сначала БД, затем кэш.
-func (s *ShortenerService) Get(shortID string) (string, error) {
-	if s.dbDNSTurn {
-		return s.GetRep(shortID, "")
+// SetBatch сокращает пакет URL за одно обращение к хранилищу и возвращает результаты
+// в порядке запроса. Повторяющиеся в пакете URL получают одну и ту же короткую ссылку
+// с псевдонимом первого из них. При ошибке хранилища не сохраняется ни одна ссылка пакета;
+// если один из сгенерированных идентификаторов уже занят, пакет сохраняется заново с новыми идентификаторами.
+// Недопустимый псевдоним отклоняет пакет ошибкой ErrInvalidAlias, занятый — ErrAliasTaken,
+// недопустимый URL — ErrInvalidURL, URL заблокированного домена — ErrBlocked. URL сравниваются в каноническом виде.
+func (s *ShortenerService) SetBatch(ctx context.Context, userID string, urls []BatchURL) ([]BatchResult, error) {
+	items := make([]BatchItem, 0, len(urls))
+	aliases := make([]string, 0, len(urls))
+	canonical := make([]string, len(urls))
+	positions := make(map[string]int, len(urls))
+	seenAliases := make(map[string]bool)
+	for i, u := range urls {
+		normalized, err := s.URLs.Normalize(u.OriginalURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkBlocked(normalized); err != nil {
+			return nil, err
+		}
+		canonical[i] = normalized
+		if _, exists := positions[normalized]; exists {
+			continue
+		}
+		opts, err := s.prepareOptions(u.Options)
+		if err != nil {
+			return nil, err
+		}
+		if u.Alias != "" {
+			if err := s.ValidateAlias(u.Alias); err != nil {
+				return nil, err
+			}
+			if seenAliases[u.Alias] {
+				return nil, fmt.Errorf("%w: %s", ErrAliasTaken, u.Alias)
+			}
+			seenAliases[u.Alias] = true
+		}
+		positions[normalized] = len(items)
+		items = append(items, BatchItem{OriginalURL: normalized, Options: opts})
+		aliases = append(aliases, u.Alias)
+	}
+
+	if len(items) > 0 {
+		if err := s.createBatch(ctx, userID, items, aliases); err != nil {
+			return nil, err
+		}
 	}
-	originalURL, exists := s.Storage.Get(shortID)
-	if !exists {
-		return "", errors.New("не удалось получить оригинальную ссылку")
+
+	results := make([]BatchResult, 0, len(urls))
+	for i, u := range urls {
+		item := items[positions[canonical[i]]]
+		results = append(results, BatchResult{
+			CorrelationID: u.CorrelationID,
+			ShortURL:      s.ShortURL(item.ShortURL),
+			Conflict:      item.Conflict,
+		})
 	}
-	return originalURL, nil
+	return results, nil
 }
 
-// Ping проверяет доступность соединения с базой данных.
-func (s *ShortenerService) Ping() error {
-	return s.db.PingStore()
+// createBatch назначает ссылкам пакета псевдонимы aliases или новые идентификаторы и сохраняет пакет,
+// повторяя попытку, пока хранилище сообщает о занятом сгенерированном идентификаторе.
+func (s *ShortenerService) createBatch(ctx context.Context, userID string, items []BatchItem, aliases []string) error {
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+
+	for attempt := 0; attempt < idAttempts; attempt++ {
+		for i := range items {
+			shortID := aliases[i]
+			if shortID == "" {
+				var err error
+				if shortID, err = s.IDs.NewID(); err != nil {
+					return err
+				}
+			}
+			items[i].ShortURL = shortID
+			items[i].Conflict = false
+		}
+		err := s.Storage.CreateBatch(ctx, userID, items)
+		if !errors.Is(err, ErrShortIDExists) {
+			return err
+		}
+		// Повтор с новыми идентификаторами бесполезен, если занят псевдоним
+		if err = s.takenAlias(ctx, aliases); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("не удалось подобрать свободные идентификаторы за %d попыток: %w", idAttempts, ErrShortIDExists)
 }
 
-// CreateRep сохраняет запись URL в базе данных.
-func (s *ShortenerService) CreateRep(originalURL, shortURL, UserID string) error {
-	return s.db.Create(originalURL, shortURL, UserID)
+// Get возвращает оригинальный URL по короткому идентификатору.
+func (s *ShortenerService) Get(ctx context.Context, shortID string) (string, error) {
+	return s.GetRep(ctx, shortID, "")
 }
 
-// GetRep извлекает запись из базы данных по короткому или оригинальному URL.
-func (s *ShortenerService) GetRep(shortURL, originalURL string) (string, error) {
-	return s.db.Get(shortURL, originalURL)
+// Visit засчитывает переход по короткой ссылке и возвращает перенаправление на адрес перехода:
+// оригинальный URL, к которому по настройкам ссылки и сервиса дописываются путь и параметры запроса pass.
+// Статус перенаправления и время его кеширования берутся из ссылки или настроек сервиса.
+// Пароль защищённой ссылки из unlock проверяется до того, как переход будет засчитан.
+// Если переходы по ссылке исчерпаны, возвращает ErrExhausted. Если домен оригинального URL
+// заблокирован после создания ссылки, возвращает ErrBlocked, не засчитывая переход.
+func (s *ShortenerService) Visit(ctx context.Context, shortID string, unlock Unlock, pass Passthrough) (Redirect, error) {
+	target, opts, err := s.linkOptions(ctx, shortID)
+	if err != nil {
+		return Redirect{}, err
+	}
+	if err := s.checkBlocked(target); err != nil {
+		return Redirect{}, err
+	}
+	if err := s.checkPassword(shortID, opts.PasswordHash, unlock); err != nil {
+		return Redirect{}, err
+	}
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+	originalURL, err := s.Storage.Visit(ctx, shortID)
+	if err != nil {
+		return Redirect{}, err
+	}
+	location, err := s.Forwarding.forward(originalURL, opts, pass)
+	if err != nil {
+		return Redirect{}, err
+	}
+	return s.Redirects.redirect(location, opts, time.Now()), nil
 }
 
-// GetFullRep извлекает все URL пользователя по userID.
-func (s *ShortenerService) GetFullRep(userID string) ([]map[string]string, error) {
-	return s.db.GetFull(userID, s.BaseURL)
+// linkOptions читает оригинальный URL и сохранённые параметры ссылки shortID.
+func (s *ShortenerService) linkOptions(ctx context.Context, shortID string) (string, LinkOptions, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Read)
+	defer cancel()
+	return s.Storage.Options(ctx, shortID)
 }
 
-// DeleteURLsRep удаляет несколько URL для пользователя, используя централизованный воркер.
-func (s *ShortenerService) DeleteURLsRep(userID string, shortURLs []string) error {
-	updateChan := make(chan string, len(shortURLs))
-	workerChan := make(chan string, len(shortURLs))
+// Ping проверяет доступность хранилища.
+func (s *ShortenerService) Ping(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Ping)
+	defer cancel()
+	return s.Storage.PingStore(ctx)
+}
 
-	go func() {
-		for shortURL := range workerChan {
-			if err := s.db.DeleteURLs(userID, shortURL, updateChan); err != nil {
-				logger.Log.Error("Не удалось удалить ссылку", zap.Error(err))
-			}
-		}
-		close(updateChan)
-	}()
+// CreateRep сохраняет запись URL с параметрами opts в хранилище.
+func (s *ShortenerService) CreateRep(ctx context.Context, originalURL, shortURL, UserID string, opts LinkOptions) error {
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+	return s.Storage.Create(ctx, originalURL, shortURL, UserID, opts)
+}
 
-	go func() {
-		for _, shortURL := range shortURLs {
-			workerChan <- shortURL
-		}
-		close(workerChan)
-	}()
+// GetRep извлекает запись из хранилища по короткому или оригинальному URL.
+func (s *ShortenerService) GetRep(ctx context.Context, shortURL, originalURL string) (string, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeouts.Read)
+	defer cancel()
+	return s.Storage.Get(ctx, shortURL, originalURL)
+}
+
+// withTimeout ограничивает время операции таймаутом timeout, если он задан.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// DeleteURLsRep ставит ссылки пользователя в очередь удаления и возвращается, не дожидаясь удаления.
+// Ссылки удаляются воркером сервиса в фоне, поэтому отмена ctx после постановки в очередь удаление не прерывает.
+// Очередь не переживает аварийного завершения процесса: гарантируется только удаление при остановке через Close.
+// Если сервис остановлен, возвращает ErrShuttingDown.
+func (s *ShortenerService) DeleteURLsRep(ctx context.Context, userID string, shortURLs []string) error {
+	if len(shortURLs) == 0 {
+		return nil
+	}
+	return s.deletes.enqueue(ctx, deleteRequest{userID: userID, shortURLs: shortURLs})
+}
 
-	return nil
+// Close останавливает сервис: перестаёт принимать запросы на удаление
+// и дожидается удаления всех ссылок, уже поставленных в очередь.
+func (s *ShortenerService) Close() {
+	s.deletes.close()
 }
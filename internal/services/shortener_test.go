@@ -1,14 +1,23 @@
 package services_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
 	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
-	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // MockStore - мок для интерфейса Store
@@ -16,172 +25,522 @@ type MockStore struct {
 	mock.Mock
 }
 
-func (m *MockStore) PingStore() error {
-	args := m.Called()
+func (m *MockStore) PingStore(ctx context.Context) error {
+	args := m.Called(ctx)
 	return args.Error(0)
 }
 
-func (m *MockStore) Create(originalURL, shortURL, UserID string) error {
-	args := m.Called(originalURL, shortURL, UserID)
+func (m *MockStore) Create(ctx context.Context, originalURL, shortURL, UserID string, opts services.LinkOptions) error {
+	args := m.Called(ctx, originalURL, shortURL, UserID, opts)
 	return args.Error(0)
 }
 
-func (m *MockStore) Get(shortID, originalURL string) (string, error) {
-	args := m.Called(shortID, originalURL)
+func (m *MockStore) CreateBatch(ctx context.Context, userID string, items []services.BatchItem) error {
+	args := m.Called(ctx, userID, items)
+	return args.Error(0)
+}
+
+func (m *MockStore) Get(ctx context.Context, shortID, originalURL string) (string, error) {
+	args := m.Called(ctx, shortID, originalURL)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockStore) GetFull(userID, BaseURL string) ([]map[string]string, error) {
-	args := m.Called(userID, BaseURL)
-	return args.Get(0).([]map[string]string), args.Error(1)
+func (m *MockStore) Visit(ctx context.Context, shortID string) (string, error) {
+	args := m.Called(ctx, shortID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStore) Options(ctx context.Context, shortID string) (string, services.LinkOptions, error) {
+	args := m.Called(ctx, shortID)
+	return args.String(0), args.Get(1).(services.LinkOptions), args.Error(2)
+}
+
+func (m *MockStore) ListURLs(ctx context.Context, userID string, filter services.ListFilter) ([]services.LinkInfo, error) {
+	args := m.Called(ctx, userID, filter)
+	links, _ := args.Get(0).([]services.LinkInfo)
+	return links, args.Error(1)
 }
 
-func (m *MockStore) DeleteURLs(userID, shortURL string, updateChan chan<- string) error {
-	args := m.Called(userID, shortURL, updateChan)
+func (m *MockStore) DeleteURLs(ctx context.Context, userID string, shortURLs []string) error {
+	args := m.Called(ctx, userID, shortURLs)
 	return args.Error(0)
 }
 
-// MockRepository - мок для интерфейса Repository
-type MockRepository struct {
-	mock.Mock
+func (m *MockStore) UpdateURL(ctx context.Context, userID, shortID, originalURL string) error {
+	args := m.Called(ctx, userID, shortID, originalURL)
+	return args.Error(0)
+}
+
+func (m *MockStore) History(ctx context.Context, userID, shortID string) ([]services.HistoryEntry, error) {
+	args := m.Called(ctx, userID, shortID)
+	history, _ := args.Get(0).([]services.HistoryEntry)
+	return history, args.Error(1)
+}
+
+func (m *MockStore) RestoreURLs(ctx context.Context, userID string, items []services.RestoreItem, deletedAfter time.Time) error {
+	args := m.Called(ctx, userID, items, deletedAfter)
+	return args.Error(0)
 }
 
-func (m *MockRepository) Set(shortID string, originalURL string) {
-	m.Called(shortID, originalURL)
+func (m *MockStore) Preview(ctx context.Context, shortID string) (services.LinkPreview, error) {
+	args := m.Called(ctx, shortID)
+	return args.Get(0).(services.LinkPreview), args.Error(1)
 }
 
-func (m *MockRepository) Get(shortID string) (string, bool) {
-	args := m.Called(shortID)
-	return args.String(0), args.Bool(1)
+func (m *MockStore) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
 }
 
 // Тест для метода Set (позитивный сценарий)
 func TestShortenerService_Set(t *testing.T) {
-	mockRepo := new(MockRepository)
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, true)
+	service := services.NewShortenerService("http://localhost", mockStore)
 
-	mockStore.On("Create", "https://example.com", mock.Anything, "user1").Return(nil)
+	mockStore.On("Create", mock.Anything, "https://example.com/", mock.Anything, "user1", mock.Anything).Return(nil)
 
-	shortURL, err := service.Set("user1", "https://example.com")
+	shortURL, err := service.Set(context.Background(), "user1", "https://example.com/")
 
 	assert.NoError(t, err)
 	assert.Contains(t, shortURL, "http://localhost/")
-	mockStore.AssertCalled(t, "Create", "https://example.com", mock.Anything, "user1")
+	mockStore.AssertCalled(t, "Create", mock.Anything, "https://example.com/", mock.Anything, "user1", mock.Anything)
 }
 
 // Тест для метода Set с ошибкой
 func TestShortenerService_Set_Error(t *testing.T) {
-	mockRepo := new(MockRepository)
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, true)
+	service := services.NewShortenerService("http://localhost", mockStore)
 
-	mockStore.On("Create", "https://example.com", mock.Anything, "user1").Return(errors.New("database error"))
+	mockStore.On("Create", mock.Anything, "https://example.com/", mock.Anything, "user1", mock.Anything).Return(errors.New("database error"))
 
-	shortURL, err := service.Set("user1", "https://example.com")
+	shortURL, err := service.Set(context.Background(), "user1", "https://example.com/")
 
 	assert.Error(t, err)
 	assert.Empty(t, shortURL)
-	mockStore.AssertCalled(t, "Create", "https://example.com", mock.Anything, "user1")
+	mockStore.AssertCalled(t, "Create", mock.Anything, "https://example.com/", mock.Anything, "user1", mock.Anything)
 }
 
-// Тест для метода Get через кэш
-func TestShortenerService_Get_FromCache(t *testing.T) {
-	mockRepo := new(MockRepository)
+// Тест для метода Get
+func TestShortenerService_Get(t *testing.T) {
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, false)
+	service := services.NewShortenerService("http://localhost", mockStore)
 
-	mockRepo.On("Get", "short123").Return("https://example.com", true)
+	mockStore.On("Get", mock.Anything, "short123", "").Return("https://example.com/", nil)
 
-	originalURL, err := service.Get("short123")
+	originalURL, err := service.Get(context.Background(), "short123")
 
 	assert.NoError(t, err)
-	assert.Equal(t, "https://example.com", originalURL)
-	mockRepo.AssertCalled(t, "Get", "short123")
+	assert.Equal(t, "https://example.com/", originalURL)
+	mockStore.AssertCalled(t, "Get", mock.Anything, "short123", "")
 }
 
-// Тест для метода Get через кэш, если ссылка отсутствует
-func TestShortenerService_Get_FromCache_NotFound(t *testing.T) {
-	mockRepo := new(MockRepository)
+// Тест для метода Get, если ссылка отсутствует
+func TestShortenerService_Get_NotFound(t *testing.T) {
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, false)
+	service := services.NewShortenerService("http://localhost", mockStore)
 
-	mockRepo.On("Get", "short123").Return("", false)
+	mockStore.On("Get", mock.Anything, "short123", "").Return("", errors.New("not found"))
 
-	originalURL, err := service.Get("short123")
+	originalURL, err := service.Get(context.Background(), "short123")
 
 	assert.Error(t, err)
 	assert.Empty(t, originalURL)
-	mockRepo.AssertCalled(t, "Get", "short123")
+	mockStore.AssertCalled(t, "Get", mock.Anything, "short123", "")
+}
+
+// Тест ограничения времени чтения
+func TestShortenerService_Get_ReadTimeout(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+	service.Timeouts = services.Timeouts{Read: time.Minute}
+
+	withDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return ok
+	})
+	mockStore.On("Get", withDeadline, "short123", "").Return("https://example.com/", nil)
+
+	_, err := service.Get(context.Background(), "short123")
+
+	assert.NoError(t, err)
+	mockStore.AssertExpectations(t)
+}
+
+// Тест отмены контекста запроса
+func TestShortenerService_Get_Canceled(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceled := mock.MatchedBy(func(ctx context.Context) bool {
+		return ctx.Err() != nil
+	})
+	mockStore.On("Get", canceled, "short123", "").Return("", context.Canceled)
+
+	_, err := service.Get(ctx, "short123")
+
+	assert.ErrorIs(t, err, context.Canceled)
+	mockStore.AssertExpectations(t)
 }
 
 // Тест для метода Ping
 func TestShortenerService_Ping(t *testing.T) {
-	mockRepo := new(MockRepository)
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, true)
+	service := services.NewShortenerService("http://localhost", mockStore)
 
-	mockStore.On("PingStore").Return(nil)
+	mockStore.On("PingStore", mock.Anything).Return(nil)
 
-	err := service.Ping()
+	err := service.Ping(context.Background())
 
 	assert.NoError(t, err)
-	mockStore.AssertCalled(t, "PingStore")
+	mockStore.AssertCalled(t, "PingStore", mock.Anything)
 }
 
 // Тест для метода CreateRep
 func TestShortenerService_CreateRep(t *testing.T) {
-	mockRepo := new(MockRepository)
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, true)
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	mockStore.On("Create", mock.Anything, "https://example.com/", "short123", "user1", mock.Anything).Return(nil)
+
+	err := service.CreateRep(context.Background(), "https://example.com/", "short123", "user1", services.LinkOptions{})
+
+	assert.NoError(t, err)
+	mockStore.AssertCalled(t, "Create", mock.Anything, "https://example.com/", "short123", "user1", mock.Anything)
+}
+
+// Тест для метода GetExistURL
+func TestShortenerService_GetExistURL(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	shortURL, exists := service.GetExistURL(fmt.Errorf("create: %w", &services.ErrConflict{Existing: "short123"}))
+	assert.True(t, exists)
+	assert.Equal(t, "http://localhost/short123", shortURL)
+
+	_, exists = service.GetExistURL(errors.New("database error"))
+	assert.False(t, exists)
+}
+
+// Тест для метода SetBatch: повторяющиеся URL сохраняются один раз, конфликт передаётся в результат
+func TestShortenerService_SetBatch(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
 
-	mockStore.On("Create", "https://example.com", "short123", "user1").Return(nil)
+	mockStore.On("CreateBatch", mock.Anything, "user1", mock.Anything).Run(func(args mock.Arguments) {
+		items := args.Get(2).([]services.BatchItem)
+		assert.Len(t, items, 2)
+		items[1].ShortURL = "existing"
+		items[1].Conflict = true
+	}).Return(nil)
 
-	err := service.CreateRep("https://example.com", "short123", "user1")
+	results, err := service.SetBatch(context.Background(), "user1", []services.BatchURL{
+		{CorrelationID: "1", OriginalURL: "https://example.com/"},
+		{CorrelationID: "2", OriginalURL: "https://example.org/"},
+		{CorrelationID: "3", OriginalURL: "https://example.com/"},
+	})
 
 	assert.NoError(t, err)
-	mockStore.AssertCalled(t, "Create", "https://example.com", "short123", "user1")
+	assert.Len(t, results, 3)
+	assert.Equal(t, "1", results[0].CorrelationID)
+	assert.False(t, results[0].Conflict)
+	assert.Equal(t, results[0].ShortURL, results[2].ShortURL)
+	assert.Equal(t, "3", results[2].CorrelationID)
+	assert.Equal(t, services.BatchResult{CorrelationID: "2", ShortURL: "http://localhost/existing", Conflict: true}, results[1])
+}
+
+// Тест для метода SetBatch с ошибкой хранилища
+func TestShortenerService_SetBatch_Error(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	mockStore.On("CreateBatch", mock.Anything, "user1", mock.Anything).Return(errors.New("database error"))
+
+	results, err := service.SetBatch(context.Background(), "user1", []services.BatchURL{
+		{CorrelationID: "1", OriginalURL: "https://example.com/"},
+	})
+
+	assert.Error(t, err)
+	assert.Nil(t, results)
+}
+
+// Тест очереди удаления: запросы пользователей накапливаются и удаляются при остановке сервиса
+func TestShortenerService_DeleteURLsRep_Drain(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	var (
+		mu      sync.Mutex
+		deleted = make(map[string][]string)
+	)
+	mockStore.On("DeleteURLs", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		userID := args.String(1)
+		deleted[userID] = append(deleted[userID], args.Get(2).([]string)...)
+	}).Return(nil)
+
+	assert.NoError(t, service.DeleteURLsRep(context.Background(), "user1", []string{"a", "b"}))
+	assert.NoError(t, service.DeleteURLsRep(context.Background(), "user2", []string{"c"}))
+	assert.NoError(t, service.DeleteURLsRep(context.Background(), "user1", []string{"d"}))
+	service.Close()
+
+	assert.ElementsMatch(t, []string{"a", "b", "d"}, deleted["user1"])
+	assert.Equal(t, []string{"c"}, deleted["user2"])
+
+	err := service.DeleteURLsRep(context.Background(), "user1", []string{"e"})
+	assert.ErrorIs(t, err, services.ErrShuttingDown)
 }
 
-// Тест для метода GetFullRep
-func TestShortenerService_GetFullRep(t *testing.T) {
-	mockRepo := new(MockRepository)
+// Тест повторной попытки удаления после ошибки хранилища
+func TestShortenerService_DeleteURLsRep_Retry(t *testing.T) {
+	logger.Log = zap.NewNop().Sugar()
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, true)
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	mockStore.On("DeleteURLs", mock.Anything, "user1", []string{"a"}).Return(errors.New("connection reset")).Once()
+	mockStore.On("DeleteURLs", mock.Anything, "user1", []string{"a"}).Return(nil).Once()
+
+	assert.NoError(t, service.DeleteURLsRep(context.Background(), "user1", []string{"a"}))
+	service.Close()
+
+	mockStore.AssertNumberOfCalls(t, "DeleteURLs", 2)
+}
+
+// Тест расписания повторов: пакет, удаление которого не удаётся, не задерживает удаление других пакетов
+func TestShortenerService_DeleteURLsRep_RetryDoesNotBlock(t *testing.T) {
+	logger.Log = zap.NewNop().Sugar()
+	mockStore := new(MockStore)
 
-	expectedResult := []map[string]string{
-		{"short_url": "http://localhost/short123", "original_url": "https://example.com"},
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mockStore.On("DeleteURLs", mock.Anything, "user1", mock.Anything).Return(errors.New("connection reset"))
+	mockStore.On("DeleteURLs", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, args.Get(2).([]string)...)
+	}).Return(nil)
+	isDeleted := func(shortURL string) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return slices.Contains(deleted, shortURL)
+		}
 	}
 
-	mockStore.On("GetFull", "user1", "http://localhost").Return(expectedResult, nil)
+	assert.NoError(t, service.DeleteURLsRep(context.Background(), "user1", []string{"a"}))
+	assert.NoError(t, service.DeleteURLsRep(context.Background(), "user2", []string{"b"}))
+	assert.Eventually(t, isDeleted("b"), time.Second, 10*time.Millisecond)
+	assert.NoError(t, service.DeleteURLsRep(context.Background(), "user3", []string{"c"}))
+	assert.Eventually(t, isDeleted("c"), time.Second, 10*time.Millisecond)
+	service.Close()
+
+	// Неудачный пакет повторяется до исчерпания попыток, в том числе при остановке
+	mockStore.AssertNumberOfCalls(t, "DeleteURLs", 7)
+}
+
+// sequenceIDs выдаёт идентификаторы по порядку
+type sequenceIDs struct {
+	ids []string
+}
+
+func (g *sequenceIDs) NewID() (string, error) {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+// Тест повторной попытки Set, если идентификатор уже занят
+func TestShortenerService_Set_Collision(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+	service.IDs = &sequenceIDs{ids: []string{"taken", "free"}}
 
-	result, err := service.GetFullRep("user1")
+	mockStore.On("Create", mock.Anything, "https://example.com/", "taken", "user1", mock.Anything).Return(services.ErrShortIDExists)
+	mockStore.On("Create", mock.Anything, "https://example.com/", "free", "user1", mock.Anything).Return(nil)
+
+	shortURL, err := service.Set(context.Background(), "user1", "https://example.com/")
 
 	assert.NoError(t, err)
-	assert.Equal(t, expectedResult, result)
-	mockStore.AssertCalled(t, "GetFull", "user1", "http://localhost")
+	assert.Equal(t, "http://localhost/free", shortURL)
+	mockStore.AssertNumberOfCalls(t, "Create", 2)
 }
 
-// Тест для метода GetExistURL
-func TestShortenerService_GetExistURL(t *testing.T) {
-	mockRepo := new(MockRepository)
+// Тест исчерпания попыток подобрать свободный идентификатор
+func TestShortenerService_Set_CollisionExhausted(t *testing.T) {
 	mockStore := new(MockStore)
 
-	service := services.NewShortenerService("http://localhost", mockRepo, mockStore, true)
+	service := services.NewShortenerService("http://localhost", mockStore)
 
-	mockStore.On("Get", "", "https://example.com").Return("short123", nil)
+	mockStore.On("Create", mock.Anything, "https://example.com/", mock.Anything, "user1", mock.Anything).Return(services.ErrShortIDExists)
 
-	pgErr := &pgconn.PgError{Code: pgerrcode.UniqueViolation}
-	shortURL, err := service.GetExistURL("https://example.com", pgErr)
+	_, err := service.Set(context.Background(), "user1", "https://example.com/")
 
+	assert.ErrorIs(t, err, services.ErrShortIDExists)
+	mockStore.AssertNumberOfCalls(t, "Create", 5)
+}
+
+// Тест срока действия: истёкший срок отклоняется без обращения к хранилищу
+func TestShortenerService_SetLink_Expiry(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	expiresAt := time.Now().Add(time.Hour)
+	mockStore.On("Create", mock.Anything, "https://example.com/", mock.Anything, "user1", services.LinkOptions{ExpiresAt: expiresAt}).Return(nil)
+
+	_, err := service.SetLink(context.Background(), "user1", "https://example.com/", "", services.LinkOptions{ExpiresAt: expiresAt})
 	assert.NoError(t, err)
-	assert.Equal(t, "http://localhost/short123", shortURL)
-	mockStore.AssertCalled(t, "Get", "", "https://example.com")
+
+	_, err = service.SetLink(context.Background(), "user1", "https://example.org/", "", services.LinkOptions{ExpiresAt: time.Now().Add(-time.Second)})
+	assert.ErrorIs(t, err, services.ErrInvalidExpiry)
+	mockStore.AssertNumberOfCalls(t, "Create", 1)
+}
+
+// Тест удаления истёкших ссылок: удаляются только ссылки, истёкшие раньше срока хранения
+func TestSweeper_Sweep(t *testing.T) {
+	mockStore := new(MockStore)
+	mockStore.On("PurgeExpired", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) >= time.Hour
+	})).Return(2, nil)
+
+	sweeper := services.NewSweeper(mockStore, time.Hour, time.Hour)
+	sweeper.Sweep()
+	sweeper.Close()
+
+	mockStore.AssertNumberOfCalls(t, "PurgeExpired", 1)
+}
+
+// Тест ссылки с паролем: хранилище получает только хеш, переход засчитывается после проверки пароля,
+// а неверные попытки ограничены
+func TestShortenerService_Visit_Password(t *testing.T) {
+	mockStore := new(MockStore)
+
+	service := services.NewShortenerService("http://localhost", mockStore)
+
+	var hash string
+	mockStore.On("Create", mock.Anything, "https://example.com/", "secret", "user1", mock.Anything).
+		Run(func(args mock.Arguments) {
+			opts := args.Get(4).(services.LinkOptions)
+			assert.Empty(t, opts.Password)
+			assert.NotEqual(t, "p4ssw0rd", opts.PasswordHash)
+			hash = opts.PasswordHash
+		}).Return(nil)
+	_, err := service.SetLink(context.Background(), "user1", "https://example.com/", "secret", services.LinkOptions{Password: "p4ssw0rd"})
+	assert.NoError(t, err)
+
+	mockStore.On("Options", mock.Anything, "secret").Return("https://example.com/", services.LinkOptions{PasswordHash: hash}, nil)
+	mockStore.On("Visit", mock.Anything, "secret").Return("https://example.com/", nil)
+
+	_, err = service.Visit(context.Background(), "secret", services.Unlock{Client: "192.0.2.1"}, services.Passthrough{})
+	assert.ErrorIs(t, err, services.ErrPasswordRequired)
+	redirect, err := service.Visit(context.Background(), "secret", services.Unlock{Password: "p4ssw0rd", Client: "192.0.2.1"}, services.Passthrough{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/", redirect.Location)
+	assert.True(t, redirect.NoStore)
+
+	for i := 0; i < 5; i++ {
+		_, err = service.Visit(context.Background(), "secret", services.Unlock{Password: "wrong", Client: "192.0.2.1"}, services.Passthrough{})
+		assert.ErrorIs(t, err, services.ErrWrongPassword)
+	}
+	_, err = service.Visit(context.Background(), "secret", services.Unlock{Password: "p4ssw0rd", Client: "192.0.2.1"}, services.Passthrough{})
+	assert.ErrorIs(t, err, services.ErrTooManyAttempts)
+	// Подбор пароля с одного адреса не блокирует ссылку для других посетителей
+	_, err = service.Visit(context.Background(), "secret", services.Unlock{Password: "p4ssw0rd", Client: "198.51.100.7"}, services.Passthrough{})
+	assert.NoError(t, err)
+	mockStore.AssertNumberOfCalls(t, "Visit", 2)
+
+	// Слишком длинный пароль отклоняется с ошибкой bcrypt
+	_, err = service.SetLink(context.Background(), "user1", "https://example.org/", "long", services.LinkOptions{Password: strings.Repeat("x", 73)})
+	assert.ErrorIs(t, err, services.ErrInvalidPassword)
+	assert.ErrorIs(t, err, bcrypt.ErrPasswordTooLong)
+}
+
+// Тест ссылок с паролем и без него на один URL: ни одна не выдаётся вместо другой
+func TestShortenerService_SetLink_PasswordNotShared(t *testing.T) {
+	service := services.NewShortenerService("http://localhost", storage.NewStorage())
+	ctx := context.Background()
+
+	protected, err := service.SetLink(ctx, "user1", "https://example.com/", "", services.LinkOptions{Password: "p4ssw0rd"})
+	require.NoError(t, err)
+	public, err := service.Set(ctx, "user2", "https://example.com/")
+	require.NoError(t, err)
+	assert.NotEqual(t, protected, public)
+	_, err = service.Visit(ctx, strings.TrimPrefix(public, "http://localhost/"), services.Unlock{}, services.Passthrough{})
+	assert.NoError(t, err)
+
+	// Пароль новой ссылки не теряется, даже если URL уже сокращён без пароля
+	again, err := service.SetLink(ctx, "user3", "https://example.com/", "", services.LinkOptions{Password: "s3cret"})
+	require.NoError(t, err)
+	assert.NotEqual(t, public, again)
+	_, err = service.Visit(ctx, strings.TrimPrefix(again, "http://localhost/"), services.Unlock{}, services.Passthrough{})
+	assert.ErrorIs(t, err, services.ErrPasswordRequired)
+
+	// Повторное сокращение без пароля по-прежнему возвращает общую ссылку
+	_, err = service.Set(ctx, "user4", "https://example.com/")
+	existing, conflict := service.GetExistURL(err)
+	assert.True(t, conflict)
+	assert.Equal(t, public, existing)
+}
+
+// Тест повторного сокращения URL, переходы по ссылке на который исчерпаны: создаётся новая ссылка
+func TestShortenerService_SetLink_AfterExhausted(t *testing.T) {
+	service := services.NewShortenerService("http://localhost", storage.NewStorage())
+	ctx := context.Background()
+
+	limited, err := service.SetLink(ctx, "user1", "https://example.com/", "", services.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	shortID := strings.TrimPrefix(limited, "http://localhost/")
+	_, err = service.Visit(ctx, shortID, services.Unlock{}, services.Passthrough{})
+	require.NoError(t, err)
+	_, err = service.Visit(ctx, shortID, services.Unlock{}, services.Passthrough{})
+	require.ErrorIs(t, err, services.ErrExhausted)
+
+	for _, opts := range []services.LinkOptions{{MaxClicks: 1}, {}} {
+		again, err := service.SetLink(ctx, "user1", "https://example.com/", "", opts)
+		require.NoError(t, err)
+		assert.NotEqual(t, limited, again)
+		_, err = service.Visit(ctx, strings.TrimPrefix(again, "http://localhost/"), services.Unlock{}, services.Passthrough{})
+		assert.NoError(t, err)
+	}
+}
+
+// Тест повторного сокращения URL, срок действия ссылки на который истёк: создаётся новая ссылка,
+// не дожидаясь удаления истёкшей
+func TestShortenerService_SetLink_AfterExpired(t *testing.T) {
+	store := storage.NewStorage()
+	service := services.NewShortenerService("http://localhost", store)
+	ctx := context.Background()
+
+	expired := services.LinkOptions{ExpiresAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, store.Create(ctx, "https://example.com/", "old", "user1", expired))
+	_, err := service.Visit(ctx, "old", services.Unlock{}, services.Passthrough{})
+	require.ErrorIs(t, err, services.ErrExpired)
+
+	for _, opts := range []services.LinkOptions{{ExpiresAt: time.Now().Add(time.Hour)}, {}} {
+		again, err := service.SetLink(ctx, "user1", "https://example.com/", "", opts)
+		require.NoError(t, err)
+		assert.NotEqual(t, "http://localhost/old", again)
+		_, err = service.Visit(ctx, strings.TrimPrefix(again, "http://localhost/"), services.Unlock{}, services.Passthrough{})
+		assert.NoError(t, err)
+	}
 }
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/logger"
+	"go.uber.org/zap"
+)
+
+// sweepTimeout — предельное время одного удаления истёкших ссылок.
+const sweepTimeout = 30 * time.Second
+
+// Sweeper периодически удаляет из хранилища ссылки с истёкшим сроком действия.
+// Ссылка удаляется только через retention после истечения срока: до этого переход по ней
+// отвечает 410 Gone, как и для удалённой ссылки, а после — 404 Not Found.
+type Sweeper struct {
+	store     Store         // Хранилище ссылок
+	interval  time.Duration // Период удаления
+	retention time.Duration // Время, в течение которого истёкшая ссылка остаётся в хранилище
+
+	done chan struct{} // Закрывается при остановке
+	idle chan struct{} // Закрывается, когда фоновая горутина завершилась
+}
+
+// NewSweeper запускает удаление истёкших ссылок хранилища store с периодом interval.
+// Останавливается методом Close.
+func NewSweeper(store Store, interval, retention time.Duration) *Sweeper {
+	s := &Sweeper{
+		store:     store,
+		interval:  interval,
+		retention: retention,
+		done:      make(chan struct{}),
+		idle:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Close останавливает удаление и дожидается завершения текущего прохода.
+func (s *Sweeper) Close() {
+	close(s.done)
+	<-s.idle
+}
+
+// run удаляет истёкшие ссылки по таймеру до остановки.
+func (s *Sweeper) run() {
+	defer close(s.idle)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+// Sweep однократно удаляет ссылки, истёкшие раньше чем retention назад. Ошибки журналируются.
+func (s *Sweeper) Sweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), sweepTimeout)
+	defer cancel()
+
+	count, err := s.store.PurgeExpired(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		logger.Log.Error("Не удалось удалить истёкшие ссылки", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		logger.Log.Info("Удалены истёкшие ссылки", zap.Int("count", count))
+	}
+}
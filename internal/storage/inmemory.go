@@ -1,24 +1,668 @@
 package storage
 
-// Storage представляет собой хранилище URL-адресов с ключами и значениями.
+import (
+	"context"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+)
+
+// shardCount — количество сегментов хранилища. Каждый сегмент защищён собственной блокировкой,
+// поэтому запросы к разным сегментам не мешают друг другу.
+const shardCount = 32
+
+// URLRecord описывает сохранённую ссылку вместе с её владельцем, признаком и моментом удаления, сроком действия,
+// ограничением переходов, паролем, передачей запроса перехода, политикой перенаправления, названием,
+// моментом создания и историей оригинальных URL.
+type URLRecord struct {
+	ShortURL     string    // Короткий идентификатор
+	OriginalURL  string    // Оригинальный URL
+	UserID       string    // Идентификатор пользователя, создавшего ссылку
+	DeletedFlag  bool      // Признак мягкого удаления
+	DeletedAt    time.Time // Момент удаления; нулевой у ссылок, удалённых до появления восстановления
+	ExpiresAt    time.Time // Момент истечения срока действия; нулевое значение — бессрочная ссылка
+	MaxClicks    int       // Допустимое количество переходов; 0 — без ограничения
+	ClicksLeft   int       // Оставшееся количество переходов, если оно ограничено
+	PasswordHash string    // Солёный хеш пароля; пустой — ссылка без пароля
+	ForwardQuery *bool     // Передавать параметры запроса перехода; nil — по настройке сервиса
+	ForwardPath  *bool     // Дописывать путь после идентификатора; nil — по настройке сервиса
+	RedirectCode int       // HTTP-статус перенаправления; 0 — по настройке сервиса
+	CacheMaxAge  *int      // Время кеширования перенаправления в секундах; nil — по настройке сервиса
+	Title        string    // Название ссылки, заданное владельцем
+	CreatedAt    time.Time // Момент создания; нулевой у ссылок, сохранённых до его учёта
+
+	History []services.HistoryEntry // Прежние оригинальные URL от старых к новым
+}
+
+// newRecord создаёт запись новой ссылки с параметрами opts, созданной в текущий момент.
+func newRecord(shortURL, originalURL, userID string, opts services.LinkOptions) URLRecord {
+	return URLRecord{
+		ShortURL:     shortURL,
+		OriginalURL:  originalURL,
+		UserID:       userID,
+		ExpiresAt:    opts.ExpiresAt,
+		MaxClicks:    opts.MaxClicks,
+		ClicksLeft:   opts.MaxClicks,
+		PasswordHash: opts.PasswordHash,
+		ForwardQuery: opts.ForwardQuery,
+		ForwardPath:  opts.ForwardPath,
+		RedirectCode: opts.RedirectCode,
+		CacheMaxAge:  opts.CacheMaxAge,
+		Title:        opts.Title,
+		CreatedAt:    time.Now().UTC(),
+	}
+}
+
+// Options возвращает сохранённые параметры ссылки.
+func (r URLRecord) Options() services.LinkOptions {
+	return services.LinkOptions{
+		ExpiresAt:    r.ExpiresAt,
+		MaxClicks:    r.MaxClicks,
+		PasswordHash: r.PasswordHash,
+		ForwardQuery: r.ForwardQuery,
+		ForwardPath:  r.ForwardPath,
+		RedirectCode: r.RedirectCode,
+		CacheMaxAge:  r.CacheMaxAge,
+		Title:        r.Title,
+	}
+}
+
+// Info возвращает описание ссылки для списка ссылок пользователя.
+func (r URLRecord) Info() services.LinkInfo {
+	return services.LinkInfo{
+		ShortID:     r.ShortURL,
+		OriginalURL: r.OriginalURL,
+		Title:       r.Title,
+		CreatedAt:   r.CreatedAt,
+		ExpiresAt:   r.ExpiresAt,
+		Deleted:     r.DeletedFlag,
+		DeletedAt:   r.DeletedAt,
+	}
+}
+
+// Shared сообщает, что ссылка не удалена и не имеет собственных параметров,
+// поэтому занимает свой оригинальный URL (см. services.LinkOptions.Shared).
+func (r URLRecord) Shared() bool {
+	return !r.DeletedFlag && r.Options().Shared()
+}
+
+// Expired сообщает, истёк ли к моменту now срок действия ссылки.
+func (r URLRecord) Expired(now time.Time) bool {
+	return services.LinkOptions{ExpiresAt: r.ExpiresAt}.Expired(now)
+}
+
+// shard — сегмент хранилища. Запись попадает в сегмент по хешу своего ключа:
+// ссылки — по короткому идентификатору, индекс оригинальных URL — по оригинальному URL,
+// списки пользователя — по userID.
+type shard struct {
+	mu        sync.RWMutex
+	urls      map[string]URLRecord // Записи по короткому идентификатору
+	originals map[string]string    // Короткий идентификатор по оригинальному URL
+	users     map[string][]string  // Короткие идентификаторы пользователя в порядке создания
+}
+
+// Storage представляет собой потокобезопасное хранилище URL-адресов в памяти,
+// разбитое на сегменты с раздельными блокировками.
+// Реализует интерфейс services.Store для работы без базы данных; операции выполняются
+// без ожидания, поэтому контекст в них не используется.
 type Storage struct {
-	URLs map[string]string // Карта для хранения URL-адресов, где ключом является строка, а значением — соответствующий URL.
+	shards [shardCount]*shard
+	keys   keyPool // Пул свободных коротких идентификаторов
 }
 
-// NewStorage создаёт и возвращает новый экземпляр хранилища с инициализированной картой URL-адресов.
+// NewStorage создаёт и возвращает новый экземпляр хранилища с инициализированными сегментами.
 func NewStorage() *Storage {
-	return &Storage{
-		URLs: make(map[string]string),
+	s := &Storage{
+		keys: keyPool{free: make(map[string]bool), issued: make(map[string]time.Time)},
 	}
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			urls:      make(map[string]URLRecord),
+			originals: make(map[string]string),
+			users:     make(map[string][]string),
+		}
+	}
+	return s
 }
 
-// Set добавляет значение value в хранилище по заданному ключу key.
+// shardIndex возвращает номер сегмента для ключа key.
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % shardCount)
+}
+
+// shardFor возвращает сегмент для ключа key.
+func (s *Storage) shardFor(key string) *shard {
+	return s.shards[shardIndex(key)]
+}
+
+// lockShards захватывает на запись сегменты всех ключей keys в порядке возрастания номеров,
+// что исключает взаимоблокировки, и возвращает функцию для их освобождения.
+func (s *Storage) lockShards(keys ...string) func() {
+	indexes := make([]int, 0, len(keys))
+	seen := make(map[int]bool, len(keys))
+	for _, key := range keys {
+		i := shardIndex(key)
+		if !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		s.shards[i].mu.Lock()
+	}
+	return func() {
+		for j := len(indexes) - 1; j >= 0; j-- {
+			s.shards[indexes[j]].mu.Unlock()
+		}
+	}
+}
+
+// Set добавляет ссылку value без владельца по заданному ключу key.
 func (s *Storage) Set(key string, value string) {
-	s.URLs[key] = value
+	s.SetRecord(URLRecord{ShortURL: key, OriginalURL: value})
+}
+
+// SetRecord сохраняет запись целиком, заменяя существующую с тем же коротким идентификатором.
+// Используется при загрузке данных, поэтому захватывает все сегменты: заменяемая запись
+// может ссылаться на оригинальный URL и пользователя из любого сегмента.
+func (s *Storage) SetRecord(record URLRecord) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	sh := s.shardFor(record.ShortURL)
+	if old, exists := sh.urls[record.ShortURL]; exists {
+		originals := s.shardFor(old.OriginalURL).originals
+		if originals[old.OriginalURL] == old.ShortURL {
+			delete(originals, old.OriginalURL)
+		}
+		if old.UserID == record.UserID {
+			// Ссылка уже есть в списке пользователя, повторно её не добавляем
+			sh.urls[record.ShortURL] = record
+			s.indexLocked(record)
+			return
+		}
+	}
+	s.setLocked(record)
 }
 
-// Get возвращает значение, связанное с заданным ключом key, и флаг наличия этого ключа в хранилище.
-func (s *Storage) Get(key string) (string, bool) {
-	value, exists := s.URLs[key]
-	return value, exists
+// setLocked сохраняет новую запись. Сегменты короткого идентификатора, оригинального URL
+// и пользователя записи должны быть захвачены вызывающей стороной.
+func (s *Storage) setLocked(record URLRecord) {
+	if record.UserID != "" {
+		users := s.shardFor(record.UserID).users
+		users[record.UserID] = append(users[record.UserID], record.ShortURL)
+	}
+	s.shardFor(record.ShortURL).urls[record.ShortURL] = record
+	s.indexLocked(record)
+}
+
+// indexLocked добавляет оригинальный URL записи в индекс. Свой оригинальный URL занимает
+// только неудалённая ссылка без параметров, остальные в индекс не попадают.
+// Сегмент оригинального URL должен быть захвачен вызывающей стороной.
+func (s *Storage) indexLocked(record URLRecord) {
+	if record.Shared() {
+		s.shardFor(record.OriginalURL).originals[record.OriginalURL] = record.ShortURL
+	}
+}
+
+// lockAll захватывает на запись все сегменты хранилища.
+func (s *Storage) lockAll() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+	}
+}
+
+// unlockAll освобождает все сегменты, захваченные lockAll.
+func (s *Storage) unlockAll() {
+	for _, sh := range s.shards {
+		sh.mu.Unlock()
+	}
+}
+
+// Snapshot возвращает согласованный снимок всех записей хранилища.
+// На время копирования захватываются все сегменты, поэтому снимок не содержит частично применённых изменений.
+func (s *Storage) Snapshot() []URLRecord {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+	}
+	defer func() {
+		for _, sh := range s.shards {
+			sh.mu.RUnlock()
+		}
+	}()
+
+	size := 0
+	for _, sh := range s.shards {
+		size += len(sh.urls)
+	}
+	records := make([]URLRecord, 0, size)
+	for _, sh := range s.shards {
+		for _, record := range sh.urls {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Len возвращает количество записей в хранилище.
+func (s *Storage) Len() int {
+	size := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		size += len(sh.urls)
+		sh.mu.RUnlock()
+	}
+	return size
+}
+
+// PingStore всегда успешен: хранилище в памяти доступно, пока работает процесс.
+func (s *Storage) PingStore(ctx context.Context) error {
+	return nil
+}
+
+// Create сохраняет оригинальный URL под коротким идентификатором shortURL и связывает его с UserID.
+// Если ссылка без параметров, а оригинальный URL уже сокращён такой же ссылкой, возвращает
+// *services.ErrConflict с идентификатором существующей ссылки, если занят короткий идентификатор —
+// services.ErrShortIDExists, чтобы сервис повторил попытку с новым.
+func (s *Storage) Create(ctx context.Context, originalURL, shortURL, UserID string, opts services.LinkOptions) error {
+	unlock := s.lockShards(shortURL, originalURL, UserID)
+	defer unlock()
+
+	if existing, exists := s.shardFor(originalURL).originals[originalURL]; exists && opts.Shared() {
+		return &services.ErrConflict{Existing: existing}
+	}
+	if _, exists := s.shardFor(shortURL).urls[shortURL]; exists {
+		return services.ErrShortIDExists
+	}
+	s.setLocked(newRecord(shortURL, originalURL, UserID, opts))
+	return nil
+}
+
+// CreateBatch сохраняет пакет ссылок пользователя userID атомарно.
+// Для ссылок без параметров, оригинальные URL которых уже заняты, подставляет идентификатор
+// существующей ссылки и отмечает конфликт.
+// Если короткий идентификатор одной из новых ссылок занят, возвращает services.ErrShortIDExists и не сохраняет ничего.
+func (s *Storage) CreateBatch(ctx context.Context, userID string, items []services.BatchItem) error {
+	s.lockAll()
+	defer s.unlockAll()
+
+	for i := range items {
+		existing, exists := s.shardFor(items[i].OriginalURL).originals[items[i].OriginalURL]
+		if exists && items[i].Options.Shared() {
+			items[i].ShortURL = existing
+			items[i].Conflict = true
+			continue
+		}
+		if _, exists := s.shardFor(items[i].ShortURL).urls[items[i].ShortURL]; exists {
+			return services.ErrShortIDExists
+		}
+	}
+	for _, item := range items {
+		if !item.Conflict {
+			s.setLocked(newRecord(item.ShortURL, item.OriginalURL, userID, item.Options))
+		}
+	}
+	return nil
+}
+
+// UpdateURL заменяет оригинальный URL ссылки shortURL пользователя userID на originalURL
+// и добавляет прежний в историю ссылки. Если ссылка без параметров, а новый URL уже занят другой
+// такой ссылкой, возвращает *services.ErrConflict; чужая ссылка отклоняется ошибкой services.ErrNotOwner.
+func (s *Storage) UpdateURL(ctx context.Context, userID, shortURL, originalURL string) error {
+	record, exists, unlock := s.lockRecord(shortURL, originalURL)
+	defer unlock()
+	if !exists {
+		return services.ErrNotFound
+	}
+	return s.updateLocked(record, userID, originalURL, time.Now())
+}
+
+// lockRecord захватывает сегменты ссылки shortURL, её оригинального URL и ключей keys
+// и возвращает запись ссылки. Сегмент оригинального URL известен только после чтения записи,
+// поэтому после захвата сегментов проверяется, что оригинальный URL не изменился, иначе попытка повторяется.
+// Сегменты освобождаются возвращённой функцией, в том числе если ссылка не найдена.
+func (s *Storage) lockRecord(shortURL string, keys ...string) (URLRecord, bool, func()) {
+	for {
+		record, exists := s.Record(shortURL)
+		unlock := s.lockShards(append([]string{shortURL, record.OriginalURL}, keys...)...)
+		current, found := s.shardFor(shortURL).urls[shortURL]
+		if current.OriginalURL == record.OriginalURL && found == exists {
+			return current, found, unlock
+		}
+		unlock()
+	}
+}
+
+// updateLocked заменяет оригинальный URL записи record. Сегменты короткого идентификатора,
+// прежнего и нового оригинальных URL должны быть захвачены вызывающей стороной.
+func (s *Storage) updateLocked(record URLRecord, userID, originalURL string, now time.Time) error {
+	switch {
+	case record.UserID != userID:
+		return services.ErrNotOwner
+	case record.DeletedFlag:
+		return services.ErrDeleted
+	case record.Expired(now):
+		return services.ErrExpired
+	case record.OriginalURL == originalURL:
+		return nil
+	}
+	originals := s.shardFor(originalURL).originals
+	if record.Shared() {
+		if existing, exists := originals[originalURL]; exists {
+			return &services.ErrConflict{Existing: existing}
+		}
+		if old := s.shardFor(record.OriginalURL).originals; old[record.OriginalURL] == record.ShortURL {
+			delete(old, record.OriginalURL)
+		}
+		originals[originalURL] = record.ShortURL
+	}
+
+	// Полное выражение среза копирует историю, не затрагивая копии записи, уже отданные читателям
+	entry := services.HistoryEntry{OriginalURL: record.OriginalURL, ChangedAt: now.UTC()}
+	record.History = append(record.History[:len(record.History):len(record.History)], entry)
+	record.OriginalURL = originalURL
+	s.shardFor(record.ShortURL).urls[record.ShortURL] = record
+	return nil
+}
+
+// History возвращает прежние оригинальные URL ссылки shortURL пользователя userID от старых к новым.
+func (s *Storage) History(ctx context.Context, userID, shortURL string) ([]services.HistoryEntry, error) {
+	record, exists := s.Record(shortURL)
+	switch {
+	case !exists:
+		return nil, services.ErrNotFound
+	case record.UserID != userID:
+		return nil, services.ErrNotOwner
+	}
+	return append([]services.HistoryEntry(nil), record.History...), nil
+}
+
+// Record возвращает копию записи по короткому идентификатору и флаг её наличия.
+func (s *Storage) Record(shortURL string) (URLRecord, bool) {
+	sh := s.shardFor(shortURL)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	record, exists := sh.urls[shortURL]
+	return record, exists
+}
+
+// Get возвращает оригинальный URL по короткому идентификатору или, если shortURL пуст,
+// короткий идентификатор по оригинальному URL.
+// Если ссылка не найдена, возвращает services.ErrNotFound, если удалена — services.ErrDeleted,
+// если истёк её срок действия — services.ErrExpired.
+func (s *Storage) Get(ctx context.Context, shortURL string, originalURL string) (string, error) {
+	if shortURL == "" {
+		sh := s.shardFor(originalURL)
+		sh.mu.RLock()
+		shortID, exists := sh.originals[originalURL]
+		sh.mu.RUnlock()
+		if !exists {
+			return "", services.ErrNotFound
+		}
+		shortURL = shortID
+	}
+	record, exists := s.Record(shortURL)
+	if !exists {
+		return "", services.ErrNotFound
+	}
+	if record.DeletedFlag {
+		return "", services.ErrDeleted
+	}
+	if record.Expired(time.Now()) {
+		return "", services.ErrExpired
+	}
+	if originalURL != "" {
+		return record.ShortURL, nil
+	}
+	return record.OriginalURL, nil
+}
+
+// Visit засчитывает переход по ссылке shortURL и возвращает оригинальный URL.
+// Ссылки без ограничения переходов обслуживаются под блокировкой на чтение. Остаток переходов
+// ограниченной ссылки уменьшается сравнением с обменом под блокировкой сегмента на запись:
+// запись заменяется, только если остаток не изменился с момента чтения, поэтому
+// одновременные переходы не превышают лимит. Исчерпанная ссылка сообщается ошибкой services.ErrExhausted.
+func (s *Storage) Visit(ctx context.Context, shortURL string) (string, error) {
+	for {
+		record, err := s.visitable(shortURL)
+		if err != nil {
+			return "", err
+		}
+		if record.MaxClicks == 0 {
+			return record.OriginalURL, nil
+		}
+		if record.ClicksLeft <= 0 {
+			return "", services.ErrExhausted
+		}
+		if s.compareAndSwapClicks(shortURL, record.ClicksLeft, record.ClicksLeft-1) {
+			return record.OriginalURL, nil
+		}
+	}
+}
+
+// Options возвращает оригинальный URL и сохранённые параметры ссылки shortURL, по которой можно перейти.
+func (s *Storage) Options(ctx context.Context, shortURL string) (string, services.LinkOptions, error) {
+	record, err := s.visitable(shortURL)
+	if err != nil {
+		return "", services.LinkOptions{}, err
+	}
+	return record.OriginalURL, record.Options(), nil
+}
+
+// Preview возвращает сведения о ссылке shortURL, не засчитывая переход.
+// Недоступная для перехода ссылка сообщается теми же ошибками, что и в Visit.
+func (s *Storage) Preview(ctx context.Context, shortURL string) (services.LinkPreview, error) {
+	record, err := s.visitable(shortURL)
+	if err != nil {
+		return services.LinkPreview{}, err
+	}
+	if record.MaxClicks > 0 && record.ClicksLeft <= 0 {
+		return services.LinkPreview{}, services.ErrExhausted
+	}
+	return services.LinkPreview{
+		OriginalURL: record.OriginalURL,
+		Title:       record.Title,
+		CreatedAt:   record.CreatedAt,
+		Protected:   record.PasswordHash != "",
+	}, nil
+}
+
+// visitable возвращает запись ссылки shortURL, если по ней можно перейти.
+func (s *Storage) visitable(shortURL string) (URLRecord, error) {
+	record, exists := s.Record(shortURL)
+	switch {
+	case !exists:
+		return record, services.ErrNotFound
+	case record.DeletedFlag:
+		return record, services.ErrDeleted
+	case record.Expired(time.Now()):
+		return record, services.ErrExpired
+	}
+	return record, nil
+}
+
+// compareAndSwapClicks устанавливает остаток переходов ссылки shortURL равным new,
+// если он по-прежнему равен old, и сообщает, удалась ли замена.
+func (s *Storage) compareAndSwapClicks(shortURL string, old, new int) bool {
+	sh := s.shardFor(shortURL)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	record, exists := sh.urls[shortURL]
+	if !exists || record.DeletedFlag || record.ClicksLeft != old {
+		return false
+	}
+	record.ClicksLeft = new
+	sh.urls[shortURL] = record
+	return true
+}
+
+// ListURLs возвращает ссылки пользователя userID, отобранные по условиям filter,
+// в порядке создания, а при равенстве моментов создания — по идентификатору.
+func (s *Storage) ListURLs(ctx context.Context, userID string, filter services.ListFilter) ([]services.LinkInfo, error) {
+	sh := s.shardFor(userID)
+	sh.mu.RLock()
+	shortIDs := append([]string(nil), sh.users[userID]...)
+	sh.mu.RUnlock()
+
+	links := make([]services.LinkInfo, 0, len(shortIDs))
+	for _, shortID := range shortIDs {
+		record, exists := s.Record(shortID)
+		if !exists || record.UserID != userID {
+			continue // Ссылка была перезаписана другим владельцем
+		}
+		link := record.Info()
+		if matches(link, filter) && (filter.After == nil || filter.After.Follows(link, filter.Desc)) {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.Before(links[j].CreatedAt) != filter.Desc
+		}
+		return (links[i].ShortID < links[j].ShortID) != filter.Desc
+	})
+	if filter.Limit > 0 && len(links) > filter.Limit {
+		links = links[:filter.Limit]
+	}
+	return links, nil
+}
+
+// matches сообщает, что ссылка link удовлетворяет отбору filter по удалению, подстроке и хосту.
+func matches(link services.LinkInfo, filter services.ListFilter) bool {
+	switch {
+	case filter.Status == services.ListActive && link.Deleted,
+		filter.Status == services.ListDeleted && !link.Deleted:
+		return false
+	case filter.Contains != "" && !strings.Contains(strings.ToLower(link.OriginalURL), filter.Contains):
+		return false
+	case filter.Host != "":
+		parsed, err := url.Parse(link.OriginalURL)
+		return err == nil && strings.ToLower(parsed.Hostname()) == filter.Host
+	}
+	return true
+}
+
+// DeleteURLs помечает как удалённые ссылки shortURLs, принадлежащие userID, запоминает момент удаления
+// и освобождает их оригинальные URL. Чужие, несуществующие и уже удалённые ссылки пропускаются.
+func (s *Storage) DeleteURLs(ctx context.Context, userID string, shortURLs []string) error {
+	now := time.Now()
+	for _, shortURL := range shortURLs {
+		record, exists, unlock := s.lockRecord(shortURL)
+		if exists && record.UserID == userID && !record.DeletedFlag {
+			if originals := s.shardFor(record.OriginalURL).originals; originals[record.OriginalURL] == shortURL {
+				delete(originals, record.OriginalURL)
+			}
+			record.DeletedFlag = true
+			record.DeletedAt = now
+			s.shardFor(shortURL).urls[shortURL] = record
+		}
+		unlock()
+	}
+	return nil
+}
+
+// RestoreURLs восстанавливает удалённые ссылки пользователя userID и заполняет результат каждой из них.
+// Восстанавливаются ссылки, удалённые позже deletedAfter, если их оригинальный URL не занят другой ссылкой.
+func (s *Storage) RestoreURLs(ctx context.Context, userID string, items []services.RestoreItem, deletedAfter time.Time) error {
+	for i := range items {
+		record, exists, unlock := s.lockRecord(items[i].ShortURL)
+		items[i].Status = services.RestoreNotFound
+		if exists {
+			items[i].Status, items[i].Existing = s.restoreLocked(record, userID, deletedAfter)
+		}
+		unlock()
+	}
+	return nil
+}
+
+// restoreLocked восстанавливает удалённую ссылку record и возвращает результат. Сегменты короткого
+// идентификатора и оригинального URL должны быть захвачены вызывающей стороной.
+func (s *Storage) restoreLocked(record URLRecord, userID string, deletedAfter time.Time) (services.RestoreStatus, string) {
+	originals := s.shardFor(record.OriginalURL).originals
+	switch {
+	case record.UserID != userID:
+		return services.RestoreNotOwner, ""
+	case !record.DeletedFlag:
+		return services.RestoreNotDeleted, ""
+	case !record.DeletedAt.After(deletedAfter):
+		return services.RestoreExpired, ""
+	}
+	record.DeletedFlag = false
+	record.DeletedAt = time.Time{}
+	if existing, exists := originals[record.OriginalURL]; exists && record.Shared() {
+		return services.RestoreConflict, existing
+	}
+	s.shardFor(record.ShortURL).urls[record.ShortURL] = record
+	s.indexLocked(record)
+	return services.RestoreRestored, ""
+}
+
+// PurgeExpired удаляет из хранилища ссылки, срок действия которых истёк раньше before,
+// и возвращает их количество.
+func (s *Storage) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	return len(s.RemoveExpired(before)), nil
+}
+
+// RemoveExpired удаляет из хранилища ссылки, срок действия которых истёк раньше before,
+// и возвращает удалённые записи.
+func (s *Storage) RemoveExpired(before time.Time) []URLRecord {
+	s.lockAll()
+	defer s.unlockAll()
+
+	var removed []URLRecord
+	for _, sh := range s.shards {
+		for _, record := range sh.urls {
+			if !record.ExpiresAt.IsZero() && record.ExpiresAt.Before(before) {
+				removed = append(removed, record)
+			}
+		}
+	}
+	for _, record := range removed {
+		s.removeLocked(record.ShortURL)
+	}
+	return removed
+}
+
+// Remove удаляет ссылку shortURL из хранилища целиком, вместе с записями индексов.
+func (s *Storage) Remove(shortURL string) {
+	s.lockAll()
+	defer s.unlockAll()
+	s.removeLocked(shortURL)
+}
+
+// removeLocked удаляет ссылку shortURL. Все сегменты должны быть захвачены вызывающей стороной.
+func (s *Storage) removeLocked(shortURL string) {
+	sh := s.shardFor(shortURL)
+	record, exists := sh.urls[shortURL]
+	if !exists {
+		return
+	}
+	delete(sh.urls, shortURL)
+	originals := s.shardFor(record.OriginalURL).originals
+	if originals[record.OriginalURL] == shortURL {
+		delete(originals, record.OriginalURL)
+	}
+	if record.UserID == "" {
+		return
+	}
+	users := s.shardFor(record.UserID).users
+	ids := users[record.UserID][:0]
+	for _, id := range users[record.UserID] {
+		if id != shortURL {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		delete(users, record.UserID)
+	} else {
+		users[record.UserID] = ids
+	}
 }
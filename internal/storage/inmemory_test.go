@@ -1,19 +1,26 @@
 package storage
 
 import (
+	"context"
 	"fmt"
-	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewStorage(t *testing.T) {
 	// Создаем новое хранилище
 	storage := NewStorage()
 
-	// Проверяем, что хранилище инициализировано и карта URL-адресов не nil
+	// Проверяем, что хранилище инициализировано и пусто
 	assert.NotNil(t, storage)
-	assert.NotNil(t, storage.URLs)
-	assert.Empty(t, storage.URLs) // Проверяем, что карта пустая
+	assert.Zero(t, storage.Len())
+	assert.Empty(t, storage.Snapshot())
 }
 
 func TestSetAndGet(t *testing.T) {
@@ -26,9 +33,14 @@ func TestSetAndGet(t *testing.T) {
 	storage.Set(key, value)
 
 	// Проверяем, что значение корректно сохраняется
-	retrievedValue, exists := storage.Get(key)
-	assert.True(t, exists)                 // Проверяем, что ключ существует
+	retrievedValue, err := storage.Get(context.Background(), key, "")
+	assert.NoError(t, err)                 // Проверяем, что ключ существует
 	assert.Equal(t, value, retrievedValue) // Проверяем, что возвращаемое значение совпадает с сохраненным
+
+	// Проверяем обратный поиск по оригинальному URL
+	retrievedKey, err := storage.Get(context.Background(), "", value)
+	assert.NoError(t, err)
+	assert.Equal(t, key, retrievedKey)
 }
 
 func TestGet_NonExistentKey(t *testing.T) {
@@ -36,10 +48,431 @@ func TestGet_NonExistentKey(t *testing.T) {
 	storage := NewStorage()
 
 	// Проверяем, что получение несуществующего ключа возвращает false
-	retrievedValue, exists := storage.Get("nonexistent")
+	retrievedValue, err := storage.Get(context.Background(), "nonexistent", "")
+
+	assert.ErrorIs(t, err, services.ErrNotFound) // Проверяем, что ключ не существует
+	assert.Empty(t, retrievedValue)              // Проверяем, что возвращаемое значение пустое
+}
+
+func TestCreate_Conflict(t *testing.T) {
+	storage := NewStorage()
+
+	assert.NoError(t, storage.Create(context.Background(), "http://example.com", "abc", "user1", services.LinkOptions{}))
+	// Повторное сокращение того же URL возвращает ошибку уникальности
+	err := storage.Create(context.Background(), "http://example.com", "def", "user2", services.LinkOptions{})
+	var conflict *services.ErrConflict
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "abc", conflict.Existing)
+	// Занятый короткий идентификатор не перезаписывается
+	assert.ErrorIs(t, storage.Create(context.Background(), "http://example.org", "abc", "user2", services.LinkOptions{}), services.ErrShortIDExists)
+
+	shortID, err := storage.Get(context.Background(), "", "http://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", shortID)
+}
+
+// Тест ссылок с параметрами: они не занимают оригинальный URL и не выдаются вместо новой ссылки
+func TestCreate_OptionsNotShared(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	protected := services.LinkOptions{PasswordHash: "hash"}
+
+	// Ссылка без параметров не выдаётся вместо ссылки с паролем
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "abc", "user1", services.LinkOptions{}))
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "def", "user2", protected))
+	// Ссылка с паролем не выдаётся вместо ссылки без параметров
+	assert.NoError(t, storage.Create(ctx, "http://example.org", "ghi", "user1", protected))
+	assert.NoError(t, storage.Create(ctx, "http://example.org", "jkl", "user2", services.LinkOptions{}))
+
+	// Оригинальный URL занимает только ссылка без параметров
+	var conflict *services.ErrConflict
+	assert.ErrorAs(t, storage.Create(ctx, "http://example.org", "mno", "user3", services.LinkOptions{}), &conflict)
+	assert.Equal(t, "jkl", conflict.Existing)
+	items := []services.BatchItem{
+		{OriginalURL: "http://example.com", ShortURL: "pqr"},
+		{OriginalURL: "http://example.org", ShortURL: "stu", Options: protected},
+	}
+	assert.NoError(t, storage.CreateBatch(ctx, "user3", items))
+	assert.Equal(t, services.BatchItem{OriginalURL: "http://example.com", ShortURL: "abc", Conflict: true}, items[0])
+	assert.False(t, items[1].Conflict)
+	assert.Equal(t, []string{"stu"}, shortIDs(t, storage, "user3", services.ListFilter{}))
+}
+
+func TestCreateBatch(t *testing.T) {
+	storage := NewStorage()
+	assert.NoError(t, storage.Create(context.Background(), "http://example.com", "abc", "user1", services.LinkOptions{}))
+
+	items := []services.BatchItem{
+		{OriginalURL: "http://example.org", ShortURL: "def"},
+		{OriginalURL: "http://example.com", ShortURL: "ghi"},
+	}
+	assert.NoError(t, storage.CreateBatch(context.Background(), "user2", items))
+	assert.False(t, items[0].Conflict)
+	assert.Equal(t, services.BatchItem{OriginalURL: "http://example.com", ShortURL: "abc", Conflict: true}, items[1])
+
+	assert.Equal(t, []string{"def"}, shortIDs(t, storage, "user2", services.ListFilter{}))
+
+	// Занятый короткий идентификатор отменяет весь пакет
+	err := storage.CreateBatch(context.Background(), "user2", []services.BatchItem{
+		{OriginalURL: "http://example.net", ShortURL: "jkl"},
+		{OriginalURL: "http://example.edu", ShortURL: "abc"},
+	})
+	assert.ErrorIs(t, err, services.ErrShortIDExists)
+	_, err = storage.Get(context.Background(), "jkl", "")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+}
 
-	assert.False(t, exists)         // Проверяем, что ключ не существует
-	assert.Empty(t, retrievedValue) // Проверяем, что возвращаемое значение пустое
+func TestListURLs(t *testing.T) {
+	storage := NewStorage()
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := created.Add(time.Hour)
+	for i, record := range []URLRecord{
+		{ShortURL: "abc", OriginalURL: "https://example.com/docs", Title: "Документация"},
+		{ShortURL: "def", OriginalURL: "https://Example.ORG/blog"},
+		{ShortURL: "ghi", OriginalURL: "https://sub.example.com/"},
+		{ShortURL: "jkl", OriginalURL: "https://example.com/old", DeletedFlag: true, DeletedAt: deletedAt},
+	} {
+		record.UserID = "user1"
+		record.CreatedAt = created.Add(time.Duration(i) * time.Minute)
+		storage.SetRecord(record)
+	}
+	storage.SetRecord(URLRecord{ShortURL: "mno", OriginalURL: "https://example.net/", UserID: "user2", CreatedAt: created})
+
+	links, err := storage.ListURLs(context.Background(), "user1", services.ListFilter{Limit: 10, Status: services.ListActive})
+	assert.NoError(t, err)
+	if assert.Len(t, links, 3) {
+		assert.Equal(t, services.LinkInfo{ShortID: "abc", OriginalURL: "https://example.com/docs", Title: "Документация",
+			CreatedAt: created}, links[0])
+	}
+
+	tests := []struct {
+		name   string
+		filter services.ListFilter
+		want   []string
+	}{
+		{name: "по убыванию", filter: services.ListFilter{Desc: true}, want: []string{"ghi", "def", "abc"}},
+		{name: "удалённые", filter: services.ListFilter{Status: services.ListDeleted}, want: []string{"jkl"}},
+		{name: "все", filter: services.ListFilter{Status: services.ListAll}, want: []string{"abc", "def", "ghi", "jkl"}},
+		{name: "подстрока", filter: services.ListFilter{Contains: "example.org"}, want: []string{"def"}},
+		{name: "хост", filter: services.ListFilter{Host: "example.com", Status: services.ListAll}, want: []string{"abc", "jkl"}},
+		{name: "страница", filter: services.ListFilter{Limit: 2}, want: []string{"abc", "def"}},
+		{
+			name:   "после курсора",
+			filter: services.ListFilter{After: &services.ListCursor{CreatedAt: created.Add(time.Minute), ShortID: "def"}},
+			want:   []string{"ghi"},
+		},
+		{
+			name:   "до курсора по убыванию",
+			filter: services.ListFilter{Desc: true, After: &services.ListCursor{CreatedAt: created.Add(time.Minute), ShortID: "def"}},
+			want:   []string{"abc"},
+		},
+	}
+	for _, tt := range tests {
+		if tt.filter.Status == "" {
+			tt.filter.Status = services.ListActive
+		}
+		assert.Equal(t, tt.want, shortIDs(t, storage, "user1", tt.filter), tt.name)
+	}
+	assert.Empty(t, shortIDs(t, storage, "unknown", services.ListFilter{}))
+}
+
+// shortIDs возвращает идентификаторы ссылок пользователя userID, выбранных по условиям filter.
+// Незаданный отбор по удалению означает только неудалённые ссылки.
+func shortIDs(t *testing.T, storage *Storage, userID string, filter services.ListFilter) []string {
+	t.Helper()
+	if filter.Status == "" {
+		filter.Status = services.ListActive
+	}
+	links, err := storage.ListURLs(context.Background(), userID, filter)
+	require.NoError(t, err)
+	ids := make([]string, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.ShortID)
+	}
+	return ids
+}
+
+func TestDeleteURLs(t *testing.T) {
+	storage := NewStorage()
+	assert.NoError(t, storage.Create(context.Background(), "http://example.com", "abc", "user1", services.LinkOptions{}))
+
+	// Чужую ссылку удалить нельзя
+	assert.NoError(t, storage.DeleteURLs(context.Background(), "user2", []string{"abc"}))
+	originalURL, err := storage.Get(context.Background(), "abc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", originalURL)
+
+	assert.NoError(t, storage.DeleteURLs(context.Background(), "user1", []string{"abc", "missing"}))
+	_, err = storage.Get(context.Background(), "abc", "")
+	assert.ErrorIs(t, err, services.ErrDeleted)
+
+	// Удалённая ссылка попадает в список только при отборе удалённых
+	assert.Empty(t, shortIDs(t, storage, "user1", services.ListFilter{}))
+	links, err := storage.ListURLs(context.Background(), "user1", services.ListFilter{Limit: 10, Status: services.ListDeleted})
+	assert.NoError(t, err)
+	if assert.Len(t, links, 1) {
+		assert.True(t, links[0].Deleted)
+		assert.WithinDuration(t, time.Now(), links[0].DeletedAt, time.Minute)
+	}
+}
+
+func TestExpiredLinks(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	expired := services.LinkOptions{ExpiresAt: time.Now().Add(-time.Minute)}
+	active := services.LinkOptions{ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "abc", "user1", expired))
+	assert.NoError(t, storage.Create(ctx, "http://example.org", "def", "user1", active))
+
+	_, err := storage.Get(ctx, "abc", "")
+	assert.ErrorIs(t, err, services.ErrExpired)
+	originalURL, err := storage.Get(ctx, "def", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.org", originalURL)
+
+	links, err := storage.ListURLs(ctx, "user1", services.ListFilter{Limit: 10, Status: services.ListActive})
+	assert.NoError(t, err)
+	assert.Len(t, links, 2)
+	for _, link := range links {
+		if link.ShortID == "def" {
+			assert.True(t, active.ExpiresAt.Equal(link.ExpiresAt))
+		}
+	}
+
+	// Ссылка, истёкшая позже границы, не удаляется
+	count, err := storage.PurgeExpired(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	count, err = storage.PurgeExpired(ctx, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = storage.Get(ctx, "abc", "")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	_, err = storage.Get(ctx, "", "http://example.com")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	assert.Equal(t, []string{"def"}, shortIDs(t, storage, "user1", services.ListFilter{}))
+
+	// Освободившийся оригинальный URL можно сократить заново
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "ghi", "user2", services.LinkOptions{}))
+}
+
+func TestVisit_MaxClicks(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "abc", "user1", services.LinkOptions{MaxClicks: 10}))
+	assert.NoError(t, storage.Create(ctx, "http://example.org", "def", "user1", services.LinkOptions{}))
+
+	// Одновременные переходы не превышают лимит
+	var served atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			originalURL, err := storage.Visit(ctx, "abc")
+			if err == nil {
+				assert.Equal(t, "http://example.com", originalURL)
+				served.Add(1)
+			} else {
+				assert.ErrorIs(t, err, services.ErrExhausted)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(10), served.Load())
+
+	// Обычное чтение переходы не засчитывает, ссылки без лимита не исчерпываются
+	_, err := storage.Get(ctx, "abc", "")
+	assert.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err = storage.Visit(ctx, "def")
+		assert.NoError(t, err)
+	}
+	_, err = storage.Visit(ctx, "missing")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+}
+
+func TestOptions(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	forward := true
+	opts := services.LinkOptions{MaxClicks: 3, PasswordHash: "hash", ForwardQuery: &forward}
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "abc", "user1", opts))
+	assert.NoError(t, storage.Create(ctx, "http://example.org", "def", "user1", services.LinkOptions{}))
+
+	originalURL, got, err := storage.Options(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", originalURL)
+	assert.Equal(t, opts, got)
+	_, got, err = storage.Options(ctx, "def")
+	assert.NoError(t, err)
+	assert.Equal(t, services.LinkOptions{}, got)
+	_, _, err = storage.Options(ctx, "missing")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+}
+
+func TestPreview(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	opts := services.LinkOptions{MaxClicks: 1, PasswordHash: "hash", Title: "Пример"}
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "abc", "user1", opts))
+
+	preview, err := storage.Preview(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", preview.OriginalURL)
+	assert.Equal(t, "Пример", preview.Title)
+	assert.True(t, preview.Protected)
+	assert.WithinDuration(t, time.Now(), preview.CreatedAt, time.Minute)
+
+	// Предпросмотр не расходует переходы, а исчерпанная ссылка недоступна и для него
+	_, err = storage.Visit(ctx, "abc")
+	assert.NoError(t, err)
+	_, err = storage.Preview(ctx, "abc")
+	assert.ErrorIs(t, err, services.ErrExhausted)
+	_, err = storage.Preview(ctx, "missing")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+}
+
+func TestUpdateURL(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "abc", "user1", services.LinkOptions{}))
+	assert.NoError(t, storage.Create(ctx, "http://example.org", "def", "user1", services.LinkOptions{}))
+
+	assert.NoError(t, storage.UpdateURL(ctx, "user1", "abc", "http://example.net"))
+	assert.NoError(t, storage.UpdateURL(ctx, "user1", "abc", "http://example.net"))
+	originalURL, err := storage.Get(ctx, "abc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.net", originalURL)
+
+	// Прежний URL освобождается, новый находится по обратному поиску
+	_, err = storage.Get(ctx, "", "http://example.com")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	shortID, err := storage.Get(ctx, "", "http://example.net")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", shortID)
+
+	history, err := storage.History(ctx, "user1", "abc")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "http://example.com", history[0].OriginalURL)
+	}
+
+	var conflict *services.ErrConflict
+	assert.ErrorAs(t, storage.UpdateURL(ctx, "user1", "abc", "http://example.org"), &conflict)
+	assert.Equal(t, "def", conflict.Existing)
+	assert.ErrorIs(t, storage.UpdateURL(ctx, "user2", "abc", "http://example.com"), services.ErrNotOwner)
+	assert.ErrorIs(t, storage.UpdateURL(ctx, "user1", "missing", "http://example.com"), services.ErrNotFound)
+	_, err = storage.History(ctx, "user2", "abc")
+	assert.ErrorIs(t, err, services.ErrNotOwner)
+}
+
+func TestRestoreURLs(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	for _, shortURL := range []string{"abc", "def", "ghi"} {
+		assert.NoError(t, storage.Create(ctx, "http://example.com/"+shortURL, shortURL, "user1", services.LinkOptions{}))
+	}
+	assert.NoError(t, storage.DeleteURLs(ctx, "user1", []string{"abc", "def", "ghi"}))
+
+	// Удалённая ссылка освобождает оригинальный URL, и его можно сократить заново
+	assert.NoError(t, storage.Create(ctx, "http://example.com/def", "new", "user2", services.LinkOptions{}))
+	// Ссылка ghi удалена раньше начала времени восстановления
+	record, _ := storage.Record("ghi")
+	record.DeletedAt = time.Now().Add(-2 * time.Hour)
+	storage.SetRecord(record)
+
+	items := []services.RestoreItem{{ShortURL: "abc"}, {ShortURL: "def"}, {ShortURL: "ghi"}, {ShortURL: "new"}, {ShortURL: "missing"}, {ShortURL: "abc"}}
+	assert.NoError(t, storage.RestoreURLs(ctx, "user1", items, time.Now().Add(-time.Hour)))
+	assert.Equal(t, []services.RestoreItem{
+		{ShortURL: "abc", Status: services.RestoreRestored},
+		{ShortURL: "def", Status: services.RestoreConflict, Existing: "new"},
+		{ShortURL: "ghi", Status: services.RestoreExpired},
+		{ShortURL: "new", Status: services.RestoreNotOwner},
+		{ShortURL: "missing", Status: services.RestoreNotFound},
+		{ShortURL: "abc", Status: services.RestoreNotDeleted},
+	}, items)
+
+	originalURL, err := storage.Get(ctx, "abc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/abc", originalURL)
+	shortID, err := storage.Get(ctx, "", "http://example.com/abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", shortID)
+	_, err = storage.Get(ctx, "def", "")
+	assert.ErrorIs(t, err, services.ErrDeleted)
+}
+
+func TestSetRecord_Replace(t *testing.T) {
+	storage := NewStorage()
+	storage.SetRecord(URLRecord{ShortURL: "abc", OriginalURL: "http://example.com", UserID: "user1"})
+	storage.SetRecord(URLRecord{ShortURL: "abc", OriginalURL: "http://example.org", UserID: "user2"})
+
+	// Старый оригинальный URL освобождается, ссылка переходит к новому владельцу
+	_, err := storage.Get(context.Background(), "", "http://example.com")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	assert.Empty(t, shortIDs(t, storage, "user1", services.ListFilter{}))
+	assert.Equal(t, []string{"abc"}, shortIDs(t, storage, "user2", services.ListFilter{}))
+	assert.Equal(t, 1, storage.Len())
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	storage := NewStorage()
+	const workers, perWorker = 16, 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("user%d", w)
+			for i := 0; i < perWorker; i++ {
+				key := fmt.Sprintf("key%d-%d", w, i)
+				value := fmt.Sprintf("http://example.com/%d/%d", w, i)
+				assert.NoError(t, storage.Create(context.Background(), value, key, userID, services.LinkOptions{}))
+				got, err := storage.Get(context.Background(), key, "")
+				assert.NoError(t, err)
+				assert.Equal(t, value, got)
+				if i%10 == 0 {
+					assert.NoError(t, storage.DeleteURLs(context.Background(), userID, []string{key}))
+				}
+				storage.Snapshot()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assert.Equal(t, workers*perWorker, storage.Len())
+	assert.Len(t, storage.Snapshot(), workers*perWorker)
+}
+
+func TestConcurrentCreate_SameURL(t *testing.T) {
+	storage := NewStorage()
+	const workers = 32
+
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int32
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			err := storage.Create(context.Background(), "http://example.com", fmt.Sprintf("key%d", w), "user", services.LinkOptions{})
+			if err == nil {
+				created.Add(1)
+				return
+			}
+			var conflict *services.ErrConflict
+			assert.ErrorAs(t, err, &conflict)
+		}(w)
+	}
+	wg.Wait()
+
+	// Оригинальный URL сокращается ровно один раз
+	assert.Equal(t, int32(1), created.Load())
+	assert.Equal(t, 1, storage.Len())
 }
 
 func BenchmarkStorageSet(b *testing.B) {
@@ -59,7 +492,7 @@ func BenchmarkStorageGet(b *testing.B) {
 	b.ResetTimer() // Сбрасываем таймер
 
 	for i := 0; i < b.N; i++ {
-		storage.Get(fmt.Sprintf("key%d", i%1000))
+		storage.Get(context.Background(), fmt.Sprintf("key%d", i%1000), "")
 	}
 }
 
@@ -72,6 +505,77 @@ func BenchmarkStorageGetNonExistent(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		storage.Get("nonexistent")
+		storage.Get(context.Background(), "nonexistent", "")
+	}
+}
+
+func BenchmarkStorageMixedParallel(b *testing.B) {
+	storage := NewStorage()
+	for i := 0; i < 1000; i++ {
+		storage.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
 	}
+	var counter atomic.Int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := counter.Add(1)
+			// Одна запись на девять чтений
+			if n%10 == 0 {
+				storage.Create(context.Background(), fmt.Sprintf("http://example.com/%d", n), fmt.Sprintf("new%d", n), "user", services.LinkOptions{})
+				continue
+			}
+			storage.Get(context.Background(), fmt.Sprintf("key%d", n%1000), "")
+		}
+	})
+}
+
+func BenchmarkStorageSnapshot(b *testing.B) {
+	storage := NewStorage()
+	for i := 0; i < 10000; i++ {
+		storage.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		storage.Snapshot()
+	}
+}
+
+func TestKeys(t *testing.T) {
+	storage := NewStorage()
+	ctx := context.Background()
+	assert.NoError(t, storage.Create(ctx, "http://example.com", "used", "user1", services.LinkOptions{}))
+
+	// Ключ, занятый ссылкой, в пул не попадает
+	assert.NoError(t, storage.AddKeys(ctx, []string{"k1", "k2", "used", "k1"}))
+	count, err := storage.CountKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	keys, err := storage.TakeKeys(ctx, 5)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"k1", "k2"}, keys)
+
+	// Выданный ключ повторно не добавляется
+	assert.NoError(t, storage.AddKeys(ctx, []string{"k1", "k3"}))
+	assert.Equal(t, []string{"k3"}, storage.FreeKeys())
+
+	// Отметка о выдаче удаляется, когда ключ занят ссылкой; ключ по-прежнему не добавляется
+	assert.NoError(t, storage.Create(ctx, "http://example.org", "k1", "user1", services.LinkOptions{}))
+	pruned, err := storage.PruneKeys(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	assert.NoError(t, storage.AddKeys(ctx, []string{"k1", "k2"}))
+	assert.Equal(t, []string{"k3"}, storage.FreeKeys())
+
+	// Давно выданный и не занятый ключ считается потерянным: отметка забывается,
+	// и ключ может вернуться в пул как новый
+	pruned, err = storage.PruneKeys(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	assert.NoError(t, storage.AddKeys(ctx, []string{"k2"}))
+	assert.ElementsMatch(t, []string{"k2", "k3"}, storage.FreeKeys())
 }
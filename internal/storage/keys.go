@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// keyPool — пул свободных коротких идентификаторов хранилища в памяти.
+type keyPool struct {
+	mu     sync.Mutex
+	free   map[string]bool      // Ключи, ещё не выданные
+	issued map[string]time.Time // Момент выдачи ключей, ещё не занятых ссылками; повторно в пул не добавляются
+}
+
+// AddKeys добавляет в пул ключи keys, пропуская уже выданные, уже свободные и занятые ссылками.
+func (s *Storage) AddKeys(ctx context.Context, keys []string) error {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	for _, key := range keys {
+		if _, issued := s.keys.issued[key]; issued || s.keys.free[key] {
+			continue
+		}
+		if _, exists := s.Record(key); exists {
+			continue
+		}
+		s.keys.free[key] = true
+	}
+	return nil
+}
+
+// TakeKeys забирает из пула до n ключей. Выданные ключи больше не выдаются.
+func (s *Storage) TakeKeys(ctx context.Context, n int) ([]string, error) {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	keys := make([]string, 0, n)
+	now := time.Now()
+	for key := range s.keys.free {
+		if len(keys) == n {
+			break
+		}
+		delete(s.keys.free, key)
+		s.keys.issued[key] = now
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// PruneKeys забывает выданные ключи, которые уже заняты ссылками: созданными с этими ключами
+// или столкнувшимися с ними, — AddKeys пропускает такие ключи и без отметки о выдаче.
+// Забываются и ключи, выданные раньше takenBefore и так и не занятые: они потеряны.
+// Возвращает количество забытых ключей.
+func (s *Storage) PruneKeys(ctx context.Context, takenBefore time.Time) (int, error) {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	pruned := 0
+	for key, takenAt := range s.keys.issued {
+		if _, exists := s.Record(key); exists || takenAt.Before(takenBefore) {
+			delete(s.keys.issued, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// CountKeys возвращает количество свободных ключей в пуле.
+func (s *Storage) CountKeys(ctx context.Context) (int, error) {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	return len(s.keys.free), nil
+}
+
+// FreeKeys возвращает снимок свободных ключей пула.
+func (s *Storage) FreeKeys() []string {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	keys := make([]string, 0, len(s.keys.free))
+	for key := range s.keys.free {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+)
+
+// UpdateURL заменяет оригинальный URL ссылки shortURL пользователя userID на originalURL
+// и в той же транзакции добавляет прежний URL в url_history. Строка ссылки блокируется до конца
+// транзакции, поэтому одновременные изменения не теряют историю. Если новый URL уже сокращён
+// другой ссылкой, возвращает *services.ErrConflict; чужая ссылка отклоняется ошибкой services.ErrNotOwner.
+func (s *StoreDB) UpdateURL(ctx context.Context, userID, shortURL, originalURL string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT original_url, COALESCE(userID, ''), deletedFlag, expires_at IS NOT NULL AND expires_at <= now()
+        FROM urls
+        WHERE short_id = $1
+        FOR UPDATE
+    `
+	var (
+		current     string
+		owner       string
+		deletedFlag bool
+		expired     bool
+	)
+	err = tx.QueryRowContext(ctx, query, shortURL).Scan(&current, &owner, &deletedFlag, &expired)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return services.ErrNotFound
+	case err != nil:
+		return err
+	case owner != userID:
+		return services.ErrNotOwner
+	case deletedFlag:
+		return services.ErrDeleted
+	case expired:
+		return services.ErrExpired
+	case current == originalURL:
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE urls SET original_url = $2 WHERE short_id = $1`, shortURL, originalURL)
+	if isUniqueViolation(err, originalURLIndex) {
+		// Транзакция прервана ошибкой, поэтому существующую ссылку ищем вне её
+		tx.Rollback()
+		existing, err := s.activeShortID(ctx, originalURL)
+		if err != nil {
+			return err
+		}
+		return &services.ErrConflict{Existing: existing}
+	}
+	if err != nil {
+		return err
+	}
+	query = `INSERT INTO url_history (short_id, original_url) VALUES ($1, $2)`
+	if _, err = tx.ExecContext(ctx, query, shortURL, current); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// History возвращает прежние оригинальные URL ссылки shortURL пользователя userID от старых к новым.
+// Владелец ссылки и её история читаются одним запросом.
+func (s *StoreDB) History(ctx context.Context, userID, shortURL string) ([]services.HistoryEntry, error) {
+	query := `
+        SELECT COALESCE(urls.userID, ''), url_history.original_url, url_history.changed_at
+        FROM urls
+        LEFT JOIN url_history ON url_history.short_id = urls.short_id
+        WHERE urls.short_id = $1
+        ORDER BY url_history.id
+    `
+	rows, err := s.db.QueryContext(ctx, query, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := false
+	var history []services.HistoryEntry
+	for rows.Next() {
+		var (
+			owner       string
+			originalURL sql.NullString
+			changedAt   sql.NullTime
+		)
+		if err := rows.Scan(&owner, &originalURL, &changedAt); err != nil {
+			return nil, err
+		}
+		if owner != userID {
+			return nil, services.ErrNotOwner
+		}
+		found = true
+		if originalURL.Valid {
+			history = append(history, services.HistoryEntry{OriginalURL: originalURL.String, ChangedAt: changedAt.Time.In(time.UTC)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, services.ErrNotFound
+	}
+	return history, nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AddKeys добавляет ключи в пул одним запросом. Ключи, которые уже есть в пуле (в том числе выданные),
+// и ключи, занятые существующими ссылками, пропускаются.
+func (s *StoreDB) AddKeys(ctx context.Context, keys []string) error {
+	query := `
+        INSERT INTO short_keys (key)
+        SELECT k FROM unnest($1::text[]) AS k
+        WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_id = k)
+        ON CONFLICT (key) DO NOTHING
+    `
+	if _, err := s.db.ExecContext(ctx, query, keys); err != nil {
+		return fmt.Errorf("failed to add keys: %w", err)
+	}
+	return nil
+}
+
+// TakeKeys отмечает выданными до n свободных ключей и возвращает их.
+// Строки, заблокированные другими экземплярами, пропускаются, поэтому один ключ
+// никогда не выдаётся двум экземплярам сервиса.
+func (s *StoreDB) TakeKeys(ctx context.Context, n int) ([]string, error) {
+	query := `
+        UPDATE short_keys SET taken = true, taken_at = now()
+        WHERE key IN (
+            SELECT key FROM short_keys WHERE NOT taken
+            LIMIT $1 FOR UPDATE SKIP LOCKED
+        )
+        RETURNING key
+    `
+	rows, err := s.db.QueryContext(ctx, query, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0, n)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during iteration through keys: %w", err)
+	}
+	return keys, nil
+}
+
+// PruneKeys удаляет из пула выданные ключи, которые уже заняты ссылками или выданы раньше takenBefore
+// и потеряны, и возвращает их количество. AddKeys пропускает занятые ключи по таблице urls,
+// поэтому строки пула им больше не нужны.
+func (s *StoreDB) PruneKeys(ctx context.Context, takenBefore time.Time) (int, error) {
+	query := `
+        DELETE FROM short_keys
+        WHERE taken AND (taken_at < $1 OR EXISTS (SELECT 1 FROM urls WHERE short_id = key))
+    `
+	result, err := s.db.ExecContext(ctx, query, takenBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune keys: %w", err)
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune keys: %w", err)
+	}
+	return int(pruned), nil
+}
+
+// CountKeys возвращает количество свободных ключей в пуле.
+func (s *StoreDB) CountKeys(ctx context.Context) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM short_keys WHERE NOT taken`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count keys: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationsFS содержит SQL-файлы миграций вида NNNN_name.up.sql и NNNN_name.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID — ключ advisory lock, под которым миграции применяются одним экземпляром сервиса.
+const migrationLockID = 1602202401
+
+// Migration описывает одну версию схемы базы данных.
+type Migration struct {
+	Version int    // Номер версии
+	Name    string // Имя миграции
+	Up      string // SQL для применения
+	Down    string // SQL для отката
+}
+
+// MigrationStatus описывает состояние миграции в базе данных.
+type MigrationStatus struct {
+	Migration
+	Applied   bool      // Применена ли миграция
+	AppliedAt time.Time // Время применения
+}
+
+// loadMigrations читает встроенные миграции и возвращает их в порядке возрастания версий.
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("некорректное имя файла миграции: %s", base)
+		}
+		number, title, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная версия миграции %s: %w", base, err)
+		}
+		data, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("у миграции %d нет файла up", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock выполняет fn на выделенном соединении под advisory lock,
+// предварительно создав таблицу schema_migrations.
+func withMigrationLock(db *sql.DB, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting db connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("error acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+	return fn(ctx, conn)
+}
+
+// appliedMigrations возвращает время применения миграций по их версиям.
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration выполняет SQL миграции и обновляет schema_migrations в одной транзакции.
+func runMigration(ctx context.Context, conn *sql.Conn, query, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp применяет все ещё не применённые миграции и возвращает их версии.
+func (s *StoreDB) MigrateUp() ([]int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	err = withMigrationLock(s.db, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			record := `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+			if err := runMigration(ctx, conn, m.Up, record, m.Version, m.Name); err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown откатывает steps последних применённых миграций и возвращает их версии.
+func (s *StoreDB) MigrateDown(steps int) ([]int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	err = withMigrationLock(s.db, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("миграцию %d_%s нельзя откатить: нет файла down", m.Version, m.Name)
+			}
+			record := `DELETE FROM schema_migrations WHERE version = $1`
+			if err := runMigration(ctx, conn, m.Down, record, m.Version); err != nil {
+				return fmt.Errorf("error reverting migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrationsStatus возвращает список всех миграций с отметкой об их применении.
+func (s *StoreDB) MigrationsStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = withMigrationLock(s.db, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			appliedAt, ok := applied[m.Version]
+			statuses = append(statuses, MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectMigrationLock настраивает ожидания захвата блокировки и создания schema_migrations.
+func expectMigrationLock(mock sqlmock.Sqlmock, applied *sqlmock.Rows) {
+	mock.ExpectExec("SELECT pg_advisory_lock").
+		WithArgs(migrationLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+		WillReturnRows(applied)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "create_urls", migrations[0].Name)
+	assert.Contains(t, migrations[0].Up, "CREATE TABLE IF NOT EXISTS urls")
+	assert.Contains(t, migrations[0].Down, "DROP TABLE IF EXISTS urls")
+	for i := 1; i < len(migrations); i++ {
+		assert.Less(t, migrations[i-1].Version, migrations[i].Version)
+	}
+}
+
+func TestStoreDB_MigrateUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+
+	store := &StoreDB{db: db}
+	expectMigrationLock(mock, sqlmock.NewRows([]string{"version", "applied_at"}))
+	for _, m := range migrations {
+		mock.ExpectBegin()
+		mock.ExpectExec(".+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").
+			WithArgs(m.Version, m.Name).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectExec("SELECT pg_advisory_unlock").
+		WithArgs(migrationLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := store.MigrateUp()
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_MigrateUp_AlreadyApplied(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+
+	store := &StoreDB{db: db}
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, m := range migrations {
+		rows.AddRow(m.Version, time.Now())
+	}
+	expectMigrationLock(mock, rows)
+	mock.ExpectExec("SELECT pg_advisory_unlock").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := store.MigrateUp()
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_MigrateDown(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	last := migrations[len(migrations)-1]
+
+	store := &StoreDB{db: db}
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, m := range migrations {
+		rows.AddRow(m.Version, time.Now())
+	}
+	expectMigrationLock(mock, rows)
+	mock.ExpectBegin()
+	mock.ExpectExec(".+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").
+		WithArgs(last.Version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("SELECT pg_advisory_unlock").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := store.MigrateDown(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{last.Version}, reverted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_MigrationsStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	appliedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expectMigrationLock(mock, sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, appliedAt))
+	mock.ExpectExec("SELECT pg_advisory_unlock").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	statuses, err := store.MigrationsStatus()
+	assert.NoError(t, err)
+	require.NotEmpty(t, statuses)
+	assert.True(t, statuses[0].Applied)
+	assert.Equal(t, appliedAt, statuses[0].AppliedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
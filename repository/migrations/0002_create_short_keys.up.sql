@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS short_keys (
+    key VARCHAR(256) PRIMARY KEY,
+    taken BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_short_keys_free ON short_keys(key) WHERE NOT taken;
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks INTEGER;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks_left INTEGER CHECK (clicks_left >= 0);
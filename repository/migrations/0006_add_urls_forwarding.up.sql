@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS forward_query BOOLEAN;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS forward_path BOOLEAN;
@@ -0,0 +1,2 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS cache_max_age;
+ALTER TABLE urls DROP COLUMN IF EXISTS redirect_code;
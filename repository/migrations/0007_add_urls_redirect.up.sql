@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_code SMALLINT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS cache_max_age INTEGER CHECK (cache_max_age >= 0);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS url_history (
+    id BIGSERIAL PRIMARY KEY,
+    short_id VARCHAR(256) NOT NULL REFERENCES urls(short_id) ON DELETE CASCADE,
+    original_url TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_history_short_id ON url_history(short_id, id);
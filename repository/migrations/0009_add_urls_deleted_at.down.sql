@@ -0,0 +1,18 @@
+-- Полный уникальный индекс допускает одну ссылку на оригинальный URL. Удалённые ссылки, URL которых
+-- занят действующей или более поздней удалённой ссылкой, вместе с историей переносятся в отдельные таблицы:
+-- повторное применение миграции возвращает их обратно, поэтому откат не теряет строк
+CREATE TABLE urls_parked_0009 AS
+SELECT * FROM urls AS deleted
+WHERE deleted.deletedFlag AND EXISTS (
+    SELECT 1 FROM urls AS other
+    WHERE other.original_url = deleted.original_url AND other.id <> deleted.id
+        AND (NOT other.deletedFlag OR other.id > deleted.id)
+);
+CREATE TABLE url_history_parked_0009 AS
+SELECT * FROM url_history WHERE short_id IN (SELECT short_id FROM urls_parked_0009);
+DELETE FROM urls WHERE id IN (SELECT id FROM urls_parked_0009);
+DROP INDEX IF EXISTS idx_original_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON urls(original_url);
+
+ALTER TABLE urls ALTER COLUMN deletedFlag DROP NOT NULL;
+ALTER TABLE urls DROP COLUMN IF EXISTS deleted_at;
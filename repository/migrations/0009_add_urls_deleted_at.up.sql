@@ -0,0 +1,23 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+UPDATE urls SET deleted_at = now() WHERE deletedFlag AND deleted_at IS NULL;
+UPDATE urls SET deletedFlag = false WHERE deletedFlag IS NULL;
+ALTER TABLE urls ALTER COLUMN deletedFlag SET NOT NULL;
+
+-- Удалённая ссылка освобождает свой оригинальный URL для повторного сокращения
+DROP INDEX IF EXISTS idx_original_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON urls(original_url) WHERE NOT deletedFlag;
+
+-- Возвращаем ссылки, перенесённые откатом этой миграции
+DO $$
+BEGIN
+    IF to_regclass('urls_parked_0009') IS NOT NULL THEN
+        INSERT INTO urls (id, short_id, original_url, created_at, userID, deletedFlag, expires_at, max_clicks,
+            clicks_left, password_hash, forward_query, forward_path, redirect_code, cache_max_age, deleted_at)
+        SELECT id, short_id, original_url, created_at, userID, deletedFlag, expires_at, max_clicks,
+            clicks_left, password_hash, forward_query, forward_path, redirect_code, cache_max_age, COALESCE(deleted_at, now())
+        FROM urls_parked_0009;
+        INSERT INTO url_history (id, short_id, original_url, changed_at)
+        SELECT id, short_id, original_url, changed_at FROM url_history_parked_0009;
+        DROP TABLE urls_parked_0009, url_history_parked_0009;
+    END IF;
+END $$;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_user_created;
+ALTER TABLE urls ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE urls ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
@@ -0,0 +1,8 @@
+-- Момент создания хранится с часовым поясом, чтобы курсор списка сравнивался с ним одинаково
+-- при любом TimeZone сессии. Прежние значения считаются записанными по UTC.
+ALTER TABLE urls ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+UPDATE urls SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE urls ALTER COLUMN created_at SET NOT NULL;
+
+-- Постраничный список ссылок пользователя в порядке создания
+CREATE INDEX IF NOT EXISTS idx_urls_user_created ON urls(userID, created_at, short_id);
@@ -0,0 +1,22 @@
+-- Прежний индекс допускает одну неудалённую ссылку на оригинальный URL. Ссылки с параметрами, URL которых
+-- занят ссылкой без параметров или более ранней ссылкой, вместе с историей переносятся в отдельные таблицы:
+-- повторное применение миграции возвращает их обратно, поэтому откат не теряет строк
+CREATE TABLE urls_parked_0012 AS
+SELECT * FROM urls AS own
+WHERE NOT own.deletedFlag
+    AND NOT (own.expires_at IS NULL AND own.max_clicks IS NULL AND own.password_hash IS NULL
+        AND own.forward_query IS NULL AND own.forward_path IS NULL AND own.redirect_code IS NULL
+        AND own.cache_max_age IS NULL AND own.title IS NULL)
+    AND EXISTS (
+        SELECT 1 FROM urls AS other
+        WHERE other.original_url = own.original_url AND other.id <> own.id AND NOT other.deletedFlag
+            AND (other.id < own.id OR (other.expires_at IS NULL AND other.max_clicks IS NULL
+                AND other.password_hash IS NULL AND other.forward_query IS NULL AND other.forward_path IS NULL
+                AND other.redirect_code IS NULL AND other.cache_max_age IS NULL AND other.title IS NULL))
+    );
+CREATE TABLE url_history_parked_0012 AS
+SELECT * FROM url_history WHERE short_id IN (SELECT short_id FROM urls_parked_0012);
+DELETE FROM urls WHERE id IN (SELECT id FROM urls_parked_0012);
+
+DROP INDEX IF EXISTS idx_original_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON urls(original_url) WHERE NOT deletedFlag;
@@ -0,0 +1,22 @@
+-- Оригинальный URL занимает только ссылка без собственных параметров: ссылки с паролем, сроком
+-- действия, ограничением переходов и другими настройками создаются для каждого запроса заново
+DROP INDEX IF EXISTS idx_original_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON urls(original_url)
+WHERE NOT deletedFlag AND expires_at IS NULL AND max_clicks IS NULL AND password_hash IS NULL
+    AND forward_query IS NULL AND forward_path IS NULL AND redirect_code IS NULL
+    AND cache_max_age IS NULL AND title IS NULL;
+
+-- Возвращаем ссылки, перенесённые откатом этой миграции
+DO $$
+BEGIN
+    IF to_regclass('urls_parked_0012') IS NOT NULL THEN
+        INSERT INTO urls (id, short_id, original_url, created_at, userID, deletedFlag, expires_at, max_clicks,
+            clicks_left, password_hash, forward_query, forward_path, redirect_code, cache_max_age, deleted_at, title)
+        SELECT id, short_id, original_url, created_at, userID, deletedFlag, expires_at, max_clicks,
+            clicks_left, password_hash, forward_query, forward_path, redirect_code, cache_max_age, deleted_at, title
+        FROM urls_parked_0012;
+        INSERT INTO url_history (id, short_id, original_url, changed_at)
+        SELECT id, short_id, original_url, changed_at FROM url_history_parked_0012;
+        DROP TABLE urls_parked_0012, url_history_parked_0012;
+    END IF;
+END $$;
@@ -0,0 +1 @@
+ALTER TABLE short_keys DROP COLUMN IF EXISTS taken_at;
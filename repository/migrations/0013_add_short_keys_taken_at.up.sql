@@ -0,0 +1,3 @@
+-- Момент выдачи ключа: выданный давно и не занятый ссылкой ключ считается потерянным
+ALTER TABLE short_keys ADD COLUMN IF NOT EXISTS taken_at TIMESTAMPTZ;
+UPDATE short_keys SET taken_at = now() WHERE taken AND taken_at IS NULL;
@@ -5,19 +5,37 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	_ "github.com/jackc/pgx/v4/stdlib"
-	"net/http"
+	"strings"
 	"time"
 )
 
+// originalURLIndex — имя уникального индекса по оригинальному URL.
+const originalURLIndex = "idx_original_url"
+
+// sharedLink — условие строки неудалённой ссылки без собственных параметров. Только такая ссылка
+// занимает свой оригинальный URL; условие совпадает с условием индекса originalURLIndex.
+const sharedLink = `NOT deletedFlag AND expires_at IS NULL AND max_clicks IS NULL AND password_hash IS NULL
+    AND forward_query IS NULL AND forward_path IS NULL AND redirect_code IS NULL
+    AND cache_max_age IS NULL AND title IS NULL`
+
+// shortIDConstraint — имя ограничения уникальности короткого идентификатора.
+const shortIDConstraint = "urls_short_id_key"
+
+// batchChunkSize — наибольшее количество ссылок в одном запросе пакетной вставки.
+// Ограничивает число параметров запроса, которое у Postgres не может превышать 65535.
+const batchChunkSize = 1000
+
 // StoreDB представляет хранилище для взаимодействия с базой данных URL
 type StoreDB struct {
 	db *sql.DB
 }
 
-// InitDatabase инициализирует соединение с базой данных по предоставленному пути DatabasePath,
-// создаёт таблицы при необходимости и возвращает структуру StoreDB.
-func InitDatabase(DatabasePath string) (*StoreDB, error) {
+// OpenDatabase открывает соединение с базой данных по пути DatabasePath без применения миграций.
+func OpenDatabase(DatabasePath string) (*StoreDB, error) {
 	db, err := sql.Open("pgx", DatabasePath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening db: %w", err)
@@ -25,11 +43,21 @@ func InitDatabase(DatabasePath string) (*StoreDB, error) {
 
 	storeDB := new(StoreDB)
 	storeDB.db = db
+	return storeDB, nil
+}
+
+// InitDatabase инициализирует соединение с базой данных по предоставленному пути DatabasePath,
+// применяет недостающие миграции схемы и возвращает структуру StoreDB.
+func InitDatabase(DatabasePath string) (*StoreDB, error) {
+	storeDB, err := OpenDatabase(DatabasePath)
+	if err != nil {
+		return nil, err
+	}
 
 	if DatabasePath != "" {
-		err = createTable(db)
-		if err != nil {
-			return nil, fmt.Errorf("error create table db: %w", err)
+		if _, err = storeDB.MigrateUp(); err != nil {
+			storeDB.Close()
+			return nil, fmt.Errorf("error migrating db: %w", err)
 		}
 	}
 
@@ -37,133 +65,553 @@ func InitDatabase(DatabasePath string) (*StoreDB, error) {
 }
 
 // Create добавляет оригинальный URL и его сокращённую версию в базу данных, связывая их с заданным UserID.
-func (s *StoreDB) Create(originalURL, shortURL, UserID string) error {
+// Если ссылка без параметров, а оригинальный URL уже сокращён такой же ссылкой, возвращает
+// *services.ErrConflict с идентификатором существующей ссылки, если занят короткий идентификатор —
+// services.ErrShortIDExists.
+func (s *StoreDB) Create(ctx context.Context, originalURL, shortURL, UserID string, opts services.LinkOptions) error {
 	query := `
-        INSERT INTO urls (short_id, original_url, userID) 
-        VALUES ($1, $2, $3)
+        INSERT INTO urls (short_id, original_url, userID, expires_at, max_clicks, clicks_left, password_hash,
+            forward_query, forward_path, redirect_code, cache_max_age, title) 
+        VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10, $11)
     `
-	_, err := s.db.Exec(query, shortURL, originalURL, UserID)
+	_, err := s.db.ExecContext(ctx, query, shortURL, originalURL, UserID,
+		nullTime(opts.ExpiresAt), nullInt(opts.MaxClicks), nullString(opts.PasswordHash),
+		nullBool(opts.ForwardQuery), nullBool(opts.ForwardPath), nullInt(opts.RedirectCode), nullIntPtr(opts.CacheMaxAge),
+		nullString(opts.Title))
+	if isUniqueViolation(err, shortIDConstraint) {
+		return services.ErrShortIDExists
+	}
+	if isUniqueViolation(err, originalURLIndex) {
+		existing, err := s.activeShortID(ctx, originalURL)
+		if err != nil {
+			return err
+		}
+		return &services.ErrConflict{Existing: existing}
+	}
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// createTable создаёт таблицу для хранения URL, если она не существует, и добавляет индекс для оригинальных URL.
-func createTable(db *sql.DB) error {
-	query := `CREATE TABLE IF NOT EXISTS urls (
-		id SERIAL PRIMARY KEY,
-		short_id VARCHAR(256) NOT NULL UNIQUE,
-		original_url TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    	userID VARCHAR(360),
-    	deletedFlag BOOLEAN DEFAULT FALSE
-	);
-	DO $$ 
-	BEGIN 
-   	 IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE tablename = 'urls' AND indexname = 'idx_original_url') THEN
-        CREATE UNIQUE INDEX idx_original_url ON urls(original_url);
-    END IF;
-	END $$;`
-
-	_, err := db.Exec(query)
+// activeShortID возвращает идентификатор ссылки, которая занимает оригинальный URL originalURL.
+func (s *StoreDB) activeShortID(ctx context.Context, originalURL string) (string, error) {
+	var existing string
+	query := `SELECT short_id FROM urls WHERE original_url = $1 AND ` + sharedLink
+	if err := s.db.QueryRowContext(ctx, query, originalURL).Scan(&existing); err != nil {
+		return "", fmt.Errorf("failed to get existing link: %w", err)
+	}
+	return existing, nil
+}
+
+// nullTime возвращает NULL для нулевого момента времени t.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nullInt возвращает NULL для нулевого значения n.
+func nullInt(n int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(n), Valid: n != 0}
+}
+
+// nullIntPtr возвращает NULL для незаданного значения n.
+func nullIntPtr(n *int) sql.NullInt32 {
+	if n == nil {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: int32(*n), Valid: true}
+}
+
+// intPtr возвращает nil для NULL-значения n.
+func intPtr(n sql.NullInt32) *int {
+	if !n.Valid {
+		return nil
+	}
+	value := int(n.Int32)
+	return &value
+}
+
+// nullString возвращает NULL для пустой строки str.
+func nullString(str string) sql.NullString {
+	return sql.NullString{String: str, Valid: str != ""}
+}
+
+// nullBool возвращает NULL для незаданного значения b.
+func nullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
+
+// boolPtr возвращает nil для NULL-значения b.
+func boolPtr(b sql.NullBool) *bool {
+	if !b.Valid {
+		return nil
+	}
+	return &b.Bool
+}
+
+// isUniqueViolation сообщает, что err — нарушение ограничения уникальности constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == constraint
+}
+
+// CreateBatch добавляет пакет ссылок пользователя userID в одной транзакции.
+// Каждая часть пакета вставляется одним многострочным запросом, который в том же обращении
+// к базе возвращает идентификаторы существующих ссылок для ссылок без параметров, оригинальные URL
+// которых уже заняты.
+// При любой ошибке транзакция откатывается, и ни одна ссылка пакета не сохраняется;
+// если один из коротких идентификаторов занят, возвращает services.ErrShortIDExists.
+func (s *StoreDB) CreateBatch(ctx context.Context, userID string, items []services.BatchItem) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(items); start += batchChunkSize {
+		end := start + batchChunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+		if err = insertChunk(ctx, tx, userID, items[start:end]); err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
+}
 
+// insertChunk вставляет часть пакета и заполняет ссылки, оригинальные URL которых уже были сокращены.
+// Вставленные строки возвращаются из RETURNING, а существующие выбираются из снимка таблицы
+// на начало запроса, поэтому каждая строка пакета встречается в ответе ровно один раз.
+func insertChunk(ctx context.Context, tx *sql.Tx, userID string, items []services.BatchItem) error {
+	values := make([]string, 0, len(items))
+	args := make([]interface{}, 0, len(items)*11+1)
+	args = append(args, userID)
+	for _, item := range items {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d::timestamptz, $%d::integer, $%d::text, $%d::boolean, $%d::boolean, $%d::smallint, $%d::integer, $%d::text, $%d::boolean)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11))
+		opts := item.Options
+		args = append(args, item.ShortURL, item.OriginalURL,
+			nullTime(opts.ExpiresAt), nullInt(opts.MaxClicks), nullString(opts.PasswordHash),
+			nullBool(opts.ForwardQuery), nullBool(opts.ForwardPath), nullInt(opts.RedirectCode), nullIntPtr(opts.CacheMaxAge),
+			nullString(opts.Title), opts.Shared())
+	}
+	query := fmt.Sprintf(`
+        WITH input (short_id, original_url, expires_at, max_clicks, password_hash, forward_query, forward_path,
+            redirect_code, cache_max_age, title, shared) AS (VALUES %s),
+        inserted AS (
+            INSERT INTO urls (short_id, original_url, userID, expires_at, max_clicks, clicks_left, password_hash,
+                forward_query, forward_path, redirect_code, cache_max_age, title)
+            SELECT short_id, original_url, $1, expires_at, max_clicks, max_clicks, password_hash,
+                forward_query, forward_path, redirect_code, cache_max_age, title FROM input
+            ON CONFLICT (original_url) WHERE %s DO NOTHING
+            RETURNING short_id, original_url
+        )
+        SELECT original_url, short_id, false FROM inserted
+        UNION ALL
+        SELECT original_url, short_id, true FROM urls
+        WHERE original_url IN (SELECT original_url FROM input WHERE shared) AND %s
+    `, strings.Join(values, ", "), sharedLink, sharedLink)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if isUniqueViolation(err, shortIDConstraint) {
+		return services.ErrShortIDExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert links: %w", err)
+	}
+	defer rows.Close()
+
+	type result struct {
+		shortID  string
+		conflict bool
+	}
+	results := make(map[string]result, len(items))
+	for rows.Next() {
+		var (
+			originalURL string
+			r           result
+		)
+		if err = rows.Scan(&originalURL, &r.shortID, &r.conflict); err != nil {
+			return err
+		}
+		results[originalURL] = r
+	}
+	// Ошибка вставки может прийти от драйвера только при чтении результата
+	if err = rows.Err(); isUniqueViolation(err, shortIDConstraint) {
+		return services.ErrShortIDExists
+	}
+	if err != nil {
+		return fmt.Errorf("error during iteration through inserted links: %w", err)
+	}
+
+	for i := range items {
+		r, exists := results[items[i].OriginalURL]
+		if !exists {
+			// Ссылку одновременно сохранил другой запрос, и её нет в снимке таблицы
+			return fmt.Errorf("link %q was created concurrently", items[i].OriginalURL)
+		}
+		items[i].ShortURL = r.shortID
+		items[i].Conflict = r.conflict
+	}
 	return nil
 }
 
-// GetFull получает все URL-адреса, созданные пользователем, по заданному userID и возвращает их со статусом удаления.
-func (s *StoreDB) GetFull(userID string, BaseURL string) ([]map[string]string, error) {
-	query := `SELECT short_id, original_url, deletedFlag FROM urls WHERE userID = $1`
-	rows, err := s.db.Query(query, userID)
+// hostPattern — регулярное выражение, первая группа которого выделяет хост из оригинального URL.
+const hostPattern = `^[^:/?#]+://(?:[^/?#@]*@)?(\[[^]]*\]|[^/?#:]*)`
+
+// ListURLs возвращает ссылки пользователя userID, отобранные по условиям filter, одним запросом.
+// Страница выбирается по курсору сравнением пары (created_at, short_id), которое использует индекс
+// по пользователю и моменту создания, поэтому время запроса не растёт с номером страницы.
+func (s *StoreDB) ListURLs(ctx context.Context, userID string, filter services.ListFilter) ([]services.LinkInfo, error) {
+	conditions := []string{"userID = $1"}
+	args := []interface{}{userID}
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	switch filter.Status {
+	case services.ListActive:
+		conditions = append(conditions, "NOT deletedFlag")
+	case services.ListDeleted:
+		conditions = append(conditions, "deletedFlag")
+	}
+	if filter.Contains != "" {
+		conditions = append(conditions, fmt.Sprintf("strpos(lower(original_url), %s) > 0", param(filter.Contains)))
+	}
+	if filter.Host != "" {
+		conditions = append(conditions, fmt.Sprintf("lower(btrim(substring(original_url from '%s'), '[]')) = %s",
+			hostPattern, param(filter.Host)))
+	}
+	order, compare := "ASC", ">"
+	if filter.Desc {
+		order, compare = "DESC", "<"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(created_at, short_id) %s (%s, %s)",
+			compare, param(filter.After.CreatedAt), param(filter.After.ShortID)))
+	}
+	limit := "ALL"
+	if filter.Limit > 0 {
+		limit = param(filter.Limit)
+	}
+	query := fmt.Sprintf(`
+        SELECT short_id, original_url, COALESCE(title, ''), created_at, expires_at, deletedFlag, deleted_at
+        FROM urls
+        WHERE %s
+        ORDER BY created_at %s, short_id %s
+        LIMIT %s
+    `, strings.Join(conditions, " AND "), order, order, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get links: %w", err)
 	}
 	defer rows.Close()
 
-	urls := make([]map[string]string, 0)
+	links := make([]services.LinkInfo, 0)
 	for rows.Next() {
 		var (
-			shortID     string
-			originalURL string
-			deletedFlag bool
+			link      services.LinkInfo
+			expiresAt sql.NullTime
+			deletedAt sql.NullTime
 		)
-		if err = rows.Scan(&shortID, &originalURL, &deletedFlag); err != nil {
+		err = rows.Scan(&link.ShortID, &link.OriginalURL, &link.Title, &link.CreatedAt, &expiresAt, &link.Deleted, &deletedAt)
+		if err != nil {
 			return nil, err
 		}
-		if deletedFlag {
-			err = errors.New(http.StatusText(http.StatusGone))
-			return make([]map[string]string, 0), err
-		}
-		shortURL := fmt.Sprintf("%s/%s", BaseURL, shortID)
-		urlMap := map[string]string{"short_url": shortURL, "original_url": originalURL}
-		urls = append(urls, urlMap)
+		link.ExpiresAt, link.DeletedAt = expiresAt.Time, deletedAt.Time
+		links = append(links, link)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error during iteration through link rows: %w", err)
 	}
 
-	return urls, nil
+	return links, nil
 }
 
-// DeleteURLs помечает URL, соответствующий userID и shortURL, как удалённый, используя канал updateChan для передачи короткого URL.
-func (s *StoreDB) DeleteURLs(userID string, shortURL string, updateChan chan<- string) error {
+// DeleteURLs помечает как удалённые URL пользователя userID из списка shortURLs одним запросом
+// и запоминает момент удаления. Уже удалённые ссылки сохраняют момент первого удаления.
+func (s *StoreDB) DeleteURLs(ctx context.Context, userID string, shortURLs []string) error {
 	query := `
 		UPDATE urls
-		SET deletedFlag = true
-		WHERE short_id = $1 and  userID = $2`
+		SET deletedFlag = true, deleted_at = now()
+		WHERE short_id = ANY($1) AND userID = $2 AND NOT deletedFlag`
 
-	_, err := s.db.Exec(query, shortURL, userID)
+	_, err := s.db.ExecContext(ctx, query, shortURLs, userID)
+	return err
+}
+
+// RestoreURLs восстанавливает удалённые ссылки пользователя userID и заполняет результат каждой из них.
+// Состояние всех ссылок читается одним запросом, а каждая подходящая ссылка восстанавливается отдельным
+// обновлением: если её оригинальный URL тем временем сокращён заново, уникальный индекс отклоняет
+// только это обновление, и ссылке возвращается идентификатор новой ссылки.
+func (s *StoreDB) RestoreURLs(ctx context.Context, userID string, items []services.RestoreItem, deletedAfter time.Time) error {
+	shortURLs := make([]string, len(items))
+	for i, item := range items {
+		shortURLs[i] = item.ShortURL
+	}
+	query := `
+        SELECT short_id, original_url, COALESCE(userID, ''), deletedFlag, deleted_at
+        FROM urls
+        WHERE short_id = ANY($1)
+    `
+	rows, err := s.db.QueryContext(ctx, query, shortURLs)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get links: %w", err)
+	}
+	defer rows.Close()
+
+	type link struct {
+		originalURL string
+		owner       string
+		deletedFlag bool
+		deletedAt   sql.NullTime
+	}
+	links := make(map[string]link, len(items))
+	for rows.Next() {
+		var (
+			shortID string
+			l       link
+		)
+		if err = rows.Scan(&shortID, &l.originalURL, &l.owner, &l.deletedFlag, &l.deletedAt); err != nil {
+			return err
+		}
+		links[shortID] = l
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration through link rows: %w", err)
+	}
+
+	query = `
+        UPDATE urls SET deletedFlag = false, deleted_at = NULL
+        WHERE short_id = $1 AND userID = $2 AND deletedFlag
+    `
+	for i := range items {
+		l, exists := links[items[i].ShortURL]
+		switch {
+		case !exists:
+			items[i].Status = services.RestoreNotFound
+			continue
+		case l.owner != userID:
+			items[i].Status = services.RestoreNotOwner
+			continue
+		case !l.deletedFlag:
+			items[i].Status = services.RestoreNotDeleted
+			continue
+		case !l.deletedAt.Valid || !l.deletedAt.Time.After(deletedAfter):
+			items[i].Status = services.RestoreExpired
+			continue
+		}
+		result, err := s.db.ExecContext(ctx, query, items[i].ShortURL, userID)
+		if isUniqueViolation(err, originalURLIndex) {
+			existing, err := s.activeShortID(ctx, l.originalURL)
+			if err != nil {
+				return err
+			}
+			items[i].Status, items[i].Existing = services.RestoreConflict, existing
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore link: %w", err)
+		}
+		items[i].Status = services.RestoreRestored
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			// Ссылку восстановил одновременный запрос
+			items[i].Status = services.RestoreNotDeleted
+		}
+		links[items[i].ShortURL] = link{originalURL: l.originalURL, owner: l.owner}
 	}
-	updateChan <- shortURL
 	return nil
 }
 
-// Get возвращает оригинальный URL по его сокращённой версии или, если указано, наоборот.
-// Если URL был удалён, возвращает статус 410 Gone.
-func (s *StoreDB) Get(shortURL string, originalURL string) (string, error) {
+// Get возвращает оригинальный URL по его сокращённой версии или, если указано, наоборот:
+// по оригинальному URL ищется ссылка, которая его занимает. Если URL не найден, возвращает services.ErrNotFound, если удалён — services.ErrDeleted,
+// если истёк срок его действия — services.ErrExpired.
+func (s *StoreDB) Get(ctx context.Context, shortURL string, originalURL string) (string, error) {
 	field1 := "original_url"
 	field2 := "short_id"
 	field := shortURL
+	condition := "TRUE"
 	if shortURL == "" {
 		field2 = "original_url"
 		field1 = "short_id"
 		field = originalURL
+		condition = sharedLink
 	}
 
 	query := fmt.Sprintf(`
-        SELECT %s, deletedFlag 
+        SELECT %s, deletedFlag, expires_at 
         FROM urls 
-        WHERE %s = $1
-    `, field1, field2)
+        WHERE %s = $1 AND %s
+        ORDER BY deletedFlag
+        LIMIT 1
+    `, field1, field2, condition)
 
 	var (
 		answer      string
 		deletedFlag bool
+		expiresAt   sql.NullTime
 	)
-	err := s.db.QueryRow(query, field).Scan(&answer, &deletedFlag)
+	err := s.db.QueryRowContext(ctx, query, field).Scan(&answer, &deletedFlag, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", services.ErrNotFound
+	}
 	if err != nil {
 		return "", err
 	}
 
 	if deletedFlag {
-		err = errors.New(http.StatusText(http.StatusGone))
+		return "", services.ErrDeleted
+	}
+	if expiresAt.Valid && !time.Now().Before(expiresAt.Time) {
+		return "", services.ErrExpired
+	}
+
+	return answer, nil
+}
+
+// Visit засчитывает переход по ссылке shortURL и возвращает оригинальный URL.
+// Остаток переходов ограниченной ссылки уменьшается в том же запросе, что читает ссылку:
+// UPDATE блокирует строку и перепроверяет условие clicks_left > 0 после ожидания
+// одновременных переходов, поэтому лимит не превышается. Если переходы исчерпаны,
+// возвращает services.ErrExhausted.
+func (s *StoreDB) Visit(ctx context.Context, shortURL string) (string, error) {
+	query := `
+        WITH visited AS (
+            UPDATE urls SET clicks_left = clicks_left - 1
+            WHERE short_id = $1 AND clicks_left > 0 AND NOT deletedFlag
+                AND (expires_at IS NULL OR expires_at > now())
+            RETURNING short_id
+        )
+        SELECT original_url, deletedFlag, expires_at IS NOT NULL AND expires_at <= now(),
+            max_clicks IS NOT NULL, EXISTS (SELECT 1 FROM visited)
+        FROM urls
+        WHERE short_id = $1
+    `
+	var (
+		originalURL string
+		deletedFlag bool
+		expired     bool
+		limited     bool
+		visited     bool
+	)
+	err := s.db.QueryRowContext(ctx, query, shortURL).Scan(&originalURL, &deletedFlag, &expired, &limited, &visited)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", services.ErrNotFound
+	case err != nil:
 		return "", err
+	case deletedFlag:
+		return "", services.ErrDeleted
+	case expired:
+		return "", services.ErrExpired
+	case limited && !visited:
+		return "", services.ErrExhausted
+	}
+	return originalURL, nil
+}
+
+// Options возвращает оригинальный URL и сохранённые параметры ссылки shortURL.
+// Недоступная для перехода ссылка сообщается теми же ошибками, что и в Visit.
+func (s *StoreDB) Options(ctx context.Context, shortURL string) (string, services.LinkOptions, error) {
+	query := `
+        SELECT original_url, expires_at, max_clicks, COALESCE(password_hash, ''), forward_query, forward_path,
+            redirect_code, cache_max_age, COALESCE(title, ''), deletedFlag, expires_at IS NOT NULL AND expires_at <= now()
+        FROM urls
+        WHERE short_id = $1
+    `
+	var (
+		originalURL  string
+		opts         services.LinkOptions
+		expiresAt    sql.NullTime
+		maxClicks    sql.NullInt32
+		forwardQuery sql.NullBool
+		forwardPath  sql.NullBool
+		redirectCode sql.NullInt32
+		cacheMaxAge  sql.NullInt32
+		deletedFlag  bool
+		expired      bool
+	)
+	err := s.db.QueryRowContext(ctx, query, shortURL).Scan(&originalURL, &expiresAt, &maxClicks, &opts.PasswordHash,
+		&forwardQuery, &forwardPath, &redirectCode, &cacheMaxAge, &opts.Title, &deletedFlag, &expired)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", opts, services.ErrNotFound
+	case err != nil:
+		return "", opts, err
+	case deletedFlag:
+		return "", opts, services.ErrDeleted
+	case expired:
+		return "", opts, services.ErrExpired
 	}
+	opts.ExpiresAt = expiresAt.Time
+	opts.MaxClicks = int(maxClicks.Int32)
+	opts.ForwardQuery, opts.ForwardPath = boolPtr(forwardQuery), boolPtr(forwardPath)
+	opts.RedirectCode, opts.CacheMaxAge = int(redirectCode.Int32), intPtr(cacheMaxAge)
+	return originalURL, opts, nil
+}
 
-	return answer, err
+// Preview возвращает сведения о ссылке shortURL, не засчитывая переход.
+// Недоступная для перехода ссылка, в том числе с исчерпанными переходами, сообщается теми же ошибками, что и в Visit.
+func (s *StoreDB) Preview(ctx context.Context, shortURL string) (services.LinkPreview, error) {
+	query := `
+        SELECT original_url, COALESCE(title, ''), created_at, COALESCE(password_hash, '') <> '',
+            deletedFlag, expires_at IS NOT NULL AND expires_at <= now(), max_clicks IS NOT NULL AND clicks_left <= 0
+        FROM urls
+        WHERE short_id = $1
+    `
+	var (
+		preview     services.LinkPreview
+		createdAt   sql.NullTime
+		deletedFlag bool
+		expired     bool
+		exhausted   bool
+	)
+	err := s.db.QueryRowContext(ctx, query, shortURL).Scan(&preview.OriginalURL, &preview.Title, &createdAt,
+		&preview.Protected, &deletedFlag, &expired, &exhausted)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return services.LinkPreview{}, services.ErrNotFound
+	case err != nil:
+		return services.LinkPreview{}, err
+	case deletedFlag:
+		return services.LinkPreview{}, services.ErrDeleted
+	case expired:
+		return services.LinkPreview{}, services.ErrExpired
+	case exhausted:
+		return services.LinkPreview{}, services.ErrExhausted
+	}
+	preview.CreatedAt = createdAt.Time
+	return preview, nil
+}
+
+// PurgeExpired удаляет ссылки, срок действия которых истёк раньше before, и возвращает их количество.
+func (s *StoreDB) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM urls WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired links: %w", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
 }
 
 // PingStore проверяет соединение с базой данных, возвращая ошибку, если база данных недоступна.
-func (s *StoreDB) PingStore() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+func (s *StoreDB) PingStore(ctx context.Context) error {
 	if err := s.db.PingContext(ctx); err != nil {
 		return fmt.Errorf("pinging db-store: %w", err)
 	}
 	return nil
 }
+
+// Close закрывает соединение с базой данных.
+func (s *StoreDB) Close() error {
+	return s.db.Close()
+}
@@ -1,10 +1,19 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Renal37/musthave_shortener_tpl.git/internal/services"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -16,10 +25,10 @@ func TestStoreDB_Create(t *testing.T) {
 
 	store := &StoreDB{db: db}
 	mock.ExpectExec("INSERT INTO urls").
-		WithArgs("shortURL", "originalURL", "userID").
+		WithArgs("shortURL", "originalURL", "userID", nil, nil, nil, nil, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = store.Create("originalURL", "shortURL", "userID")
+	err = store.Create(context.Background(), "originalURL", "shortURL", "userID", services.LinkOptions{})
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -31,125 +40,159 @@ func TestStoreDB_Create_Error(t *testing.T) {
 
 	store := &StoreDB{db: db}
 	mock.ExpectExec("INSERT INTO urls").
-		WithArgs("shortURL", "originalURL", "userID").
+		WithArgs("shortURL", "originalURL", "userID", nil, nil, nil, nil, nil, nil, nil, nil).
 		WillReturnError(errors.New("some error"))
 
-	err = store.Create("originalURL", "shortURL", "userID")
+	err = store.Create(context.Background(), "originalURL", "shortURL", "userID", services.LinkOptions{})
 	assert.Error(t, err)
 	assert.Equal(t, "some error", err.Error())
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestStoreDB_GetFull(t *testing.T) {
+func TestStoreDB_Create_Conflict(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	rows := sqlmock.NewRows([]string{"short_id", "original_url", "deletedFlag"}).
-		AddRow("shortURL1", "originalURL1", false).
-		AddRow("shortURL2", "originalURL2", false)
+	mock.ExpectExec("INSERT INTO urls").
+		WithArgs("shortURL", "originalURL", "userID", nil, nil, nil, nil, nil, nil, nil, nil).
+		WillReturnError(&pgconn.PgError{Code: pgerrcode.UniqueViolation, ConstraintName: "idx_original_url"})
+	mock.ExpectQuery("SELECT short_id FROM urls WHERE original_url =").
+		WithArgs("originalURL").
+		WillReturnRows(sqlmock.NewRows([]string{"short_id"}).AddRow("existing"))
+
+	err = store.Create(context.Background(), "originalURL", "shortURL", "userID", services.LinkOptions{})
+	var conflict *services.ErrConflict
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "existing", conflict.Existing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	mock.ExpectQuery("SELECT short_id, original_url, deletedFlag FROM urls").
-		WithArgs("userID").
+func TestStoreDB_ListURLs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"short_id", "original_url", "title", "created_at", "expires_at", "deletedFlag", "deleted_at"}).
+		AddRow("shortURL1", "originalURL1", "Docs", createdAt, expiresAt, false, nil).
+		AddRow("shortURL2", "originalURL2", "", createdAt, nil, true, expiresAt)
+
+	mock.ExpectQuery("SELECT short_id, original_url, COALESCE\\(title, ''\\), created_at, expires_at, deletedFlag, deleted_at\\s+"+
+		"FROM urls\\s+WHERE userID = \\$1\\s+ORDER BY created_at ASC, short_id ASC\\s+LIMIT \\$2").
+		WithArgs("userID", 10).
 		WillReturnRows(rows)
 
-	result, err := store.GetFull("userID", "http://localhost:8080")
+	links, err := store.ListURLs(context.Background(), "userID", services.ListFilter{Limit: 10, Status: services.ListAll})
 	assert.NoError(t, err)
-	assert.Len(t, result, 2)
-	assert.Equal(t, "http://localhost:8080/shortURL1", result[0]["short_url"])
-	assert.Equal(t, "originalURL1", result[0]["original_url"])
-	assert.Equal(t, "http://localhost:8080/shortURL2", result[1]["short_url"])
-	assert.Equal(t, "originalURL2", result[1]["original_url"])
+	assert.Equal(t, []services.LinkInfo{
+		{ShortID: "shortURL1", OriginalURL: "originalURL1", Title: "Docs", CreatedAt: createdAt, ExpiresAt: expiresAt},
+		{ShortID: "shortURL2", OriginalURL: "originalURL2", CreatedAt: createdAt, Deleted: true, DeletedAt: expiresAt},
+	}, links)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestStoreDB_GetFull_DeletedURL(t *testing.T) {
+func TestStoreDB_ListURLs_Filters(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	rows := sqlmock.NewRows([]string{"short_id", "original_url", "deletedFlag"}).
-		AddRow("shortURL1", "originalURL1", true)
-
-	mock.ExpectQuery("SELECT short_id, original_url, deletedFlag FROM urls").
+	cursor := services.ListCursor{CreatedAt: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), ShortID: "abc"}
+	mock.ExpectQuery("WHERE userID = \\$1 AND NOT deletedFlag AND strpos\\(lower\\(original_url\\), \\$2\\) > 0 "+
+		"AND lower\\(btrim\\(substring\\(original_url from '.+'\\), '\\[\\]'\\)\\) = \\$3 "+
+		"AND \\(created_at, short_id\\) < \\(\\$4, \\$5\\)\\s+ORDER BY created_at DESC, short_id DESC\\s+LIMIT \\$6").
+		WithArgs("userID", "docs", "example.com", cursor.CreatedAt, "abc", 3).
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "original_url", "title", "created_at", "expires_at", "deletedFlag", "deleted_at"}))
+	mock.ExpectQuery("WHERE userID = \\$1 AND deletedFlag\\s+ORDER BY created_at ASC, short_id ASC\\s+LIMIT ALL").
 		WithArgs("userID").
-		WillReturnRows(rows)
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "original_url", "title", "created_at", "expires_at", "deletedFlag", "deleted_at"}))
 
-	result, err := store.GetFull("userID", "http://localhost:8080")
-	assert.Error(t, err)
-	assert.Empty(t, result)
-	assert.Equal(t, "Gone", err.Error()) // Проверяем правильность статуса ошибки
+	links, err := store.ListURLs(context.Background(), "userID", services.ListFilter{
+		Limit: 3, After: &cursor, Desc: true, Contains: "docs", Host: "example.com", Status: services.ListActive,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+	_, err = store.ListURLs(context.Background(), "userID", services.ListFilter{Status: services.ListDeleted})
+	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestStoreDB_GetFull_Error(t *testing.T) {
+func TestStoreDB_ListURLs_Error(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	mock.ExpectQuery("SELECT short_id, original_url, deletedFlag FROM urls").
-		WithArgs("userID").
+	mock.ExpectQuery("SELECT short_id, original_url").
+		WithArgs("userID", 10).
 		WillReturnError(errors.New("query error"))
 
-	result, err := store.GetFull("userID", "http://localhost:8080")
+	result, err := store.ListURLs(context.Background(), "userID", services.ListFilter{Limit: 10, Status: services.ListAll})
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestStoreDB_DeleteURLs(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
 	require.NoError(t, err)
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	updateChan := make(chan string, 1)
 
 	mock.ExpectExec("UPDATE urls").
-		WithArgs("shortURL", "userID").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WithArgs([]string{"shortURL1", "shortURL2"}, "userID").
+		WillReturnResult(sqlmock.NewResult(0, 2))
 
-	err = store.DeleteURLs("userID", "shortURL", updateChan)
+	err = store.DeleteURLs(context.Background(), "userID", []string{"shortURL1", "shortURL2"})
 	assert.NoError(t, err)
-	assert.Equal(t, "shortURL", <-updateChan)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestStoreDB_DeleteURLs_Error(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
 	require.NoError(t, err)
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	updateChan := make(chan string, 1)
 
 	mock.ExpectExec("UPDATE urls").
-		WithArgs("shortURL", "userID").
+		WithArgs([]string{"shortURL"}, "userID").
 		WillReturnError(errors.New("delete error"))
 
-	err = store.DeleteURLs("userID", "shortURL", updateChan)
+	err = store.DeleteURLs(context.Background(), "userID", []string{"shortURL"})
 	assert.Error(t, err)
 	assert.Equal(t, "delete error", err.Error())
-	assert.Empty(t, updateChan)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// arrayConverter передаёт срезы строк в запрос без преобразования, как это делает драйвер pgx.
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if values, ok := v.([]string); ok {
+		return values, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
 func TestStoreDB_Get(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	rows := sqlmock.NewRows([]string{"original_url", "deletedFlag"}).AddRow("originalURL", false)
+	rows := sqlmock.NewRows([]string{"original_url", "deletedFlag", "expires_at"}).AddRow("originalURL", false, nil)
 
-	mock.ExpectQuery("SELECT original_url, deletedFlag FROM urls WHERE short_id =").
+	mock.ExpectQuery("SELECT original_url, deletedFlag, expires_at FROM urls WHERE short_id =").
 		WithArgs("shortURL").
 		WillReturnRows(rows)
 
-	originalURL, err := store.Get("shortURL", "")
+	originalURL, err := store.Get(context.Background(), "shortURL", "")
 	assert.NoError(t, err)
 	assert.Equal(t, "originalURL", originalURL)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -161,16 +204,154 @@ func TestStoreDB_Get_Deleted(t *testing.T) {
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	rows := sqlmock.NewRows([]string{"original_url", "deletedFlag"}).AddRow("originalURL", true)
+	rows := sqlmock.NewRows([]string{"original_url", "deletedFlag", "expires_at"}).AddRow("originalURL", true, nil)
 
-	mock.ExpectQuery("SELECT original_url, deletedFlag FROM urls WHERE short_id =").
+	mock.ExpectQuery("SELECT original_url, deletedFlag, expires_at FROM urls WHERE short_id =").
 		WithArgs("shortURL").
 		WillReturnRows(rows)
 
-	originalURL, err := store.Get("shortURL", "")
+	originalURL, err := store.Get(context.Background(), "shortURL", "")
 	assert.Error(t, err)
 	assert.Empty(t, originalURL)
-	assert.Equal(t, "Gone", err.Error()) // Проверяем правильность статуса ошибки
+	assert.ErrorIs(t, err, services.ErrDeleted) // Проверяем правильность ошибки
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_Get_Expired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	rows := sqlmock.NewRows([]string{"original_url", "deletedFlag", "expires_at"}).
+		AddRow("originalURL", false, time.Now().Add(-time.Minute))
+
+	mock.ExpectQuery("SELECT original_url, deletedFlag, expires_at FROM urls WHERE short_id =").
+		WithArgs("shortURL").
+		WillReturnRows(rows)
+
+	originalURL, err := store.Get(context.Background(), "shortURL", "")
+	assert.ErrorIs(t, err, services.ErrExpired)
+	assert.Empty(t, originalURL)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_Visit(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     []driver.Value
+		wantErr error
+	}{
+		{name: "unlimited", row: []driver.Value{"originalURL", false, false, false, false}},
+		{name: "visited", row: []driver.Value{"originalURL", false, false, true, true}},
+		{name: "exhausted", row: []driver.Value{"originalURL", false, false, true, false}, wantErr: services.ErrExhausted},
+		{name: "deleted", row: []driver.Value{"originalURL", true, false, true, false}, wantErr: services.ErrDeleted},
+		{name: "expired", row: []driver.Value{"originalURL", false, true, false, false}, wantErr: services.ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			store := &StoreDB{db: db}
+			rows := sqlmock.NewRows([]string{"original_url", "deletedFlag", "expired", "limited", "visited"}).AddRow(tt.row...)
+			mock.ExpectQuery("UPDATE urls SET clicks_left = clicks_left - 1").
+				WithArgs("shortURL").
+				WillReturnRows(rows)
+
+			originalURL, err := store.Visit(context.Background(), "shortURL")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, originalURL)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "originalURL", originalURL)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestStoreDB_Options(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	columns := []string{"original_url", "expires_at", "max_clicks", "password_hash", "forward_query", "forward_path",
+		"redirect_code", "cache_max_age", "title", "deletedFlag", "expired"}
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT original_url, expires_at, max_clicks, COALESCE\\(password_hash, ''\\), forward_query, forward_path").
+		WithArgs("shortURL").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("https://example.com", expiresAt, 3, "hash", true, nil, 308, 0, "Docs", false, false))
+	mock.ExpectQuery("SELECT original_url, expires_at, max_clicks").
+		WithArgs("plain").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("https://example.org", nil, nil, "", nil, nil, nil, nil, "", false, false))
+	mock.ExpectQuery("SELECT original_url, expires_at, max_clicks").
+		WithArgs("deleted").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("https://example.net", nil, nil, "", nil, nil, nil, nil, "", true, false))
+
+	forward, maxAge := true, 0
+	originalURL, opts, err := store.Options(context.Background(), "shortURL")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", originalURL)
+	assert.Equal(t, services.LinkOptions{ExpiresAt: expiresAt, MaxClicks: 3, PasswordHash: "hash", ForwardQuery: &forward,
+		RedirectCode: 308, CacheMaxAge: &maxAge, Title: "Docs"}, opts)
+	_, opts, err = store.Options(context.Background(), "plain")
+	assert.NoError(t, err)
+	assert.Equal(t, services.LinkOptions{}, opts)
+	_, _, err = store.Options(context.Background(), "deleted")
+	assert.ErrorIs(t, err, services.ErrDeleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_Preview(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	columns := []string{"original_url", "title", "created_at", "protected", "deletedFlag", "expired", "exhausted"}
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	mock.ExpectQuery("SELECT original_url, COALESCE\\(title, ''\\), created_at").
+		WithArgs("shortURL").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("https://example.com", "Docs", createdAt, true, false, false, false))
+	mock.ExpectQuery("SELECT original_url").
+		WithArgs("expired").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("https://example.com", "", nil, false, false, true, false))
+	mock.ExpectQuery("SELECT original_url").
+		WithArgs("exhausted").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("https://example.com", "", nil, false, false, false, true))
+	mock.ExpectQuery("SELECT original_url").
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+
+	preview, err := store.Preview(context.Background(), "shortURL")
+	assert.NoError(t, err)
+	assert.Equal(t, services.LinkPreview{OriginalURL: "https://example.com", Title: "Docs", CreatedAt: createdAt, Protected: true}, preview)
+	_, err = store.Preview(context.Background(), "expired")
+	assert.ErrorIs(t, err, services.ErrExpired)
+	_, err = store.Preview(context.Background(), "exhausted")
+	assert.ErrorIs(t, err, services.ErrExhausted)
+	_, err = store.Preview(context.Background(), "missing")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_Get_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	mock.ExpectQuery("SELECT original_url, deletedFlag, expires_at FROM urls WHERE short_id =").
+		WithArgs("shortURL").
+		WillReturnError(sql.ErrNoRows)
+
+	originalURL, err := store.Get(context.Background(), "shortURL", "")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	assert.Empty(t, originalURL)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -180,11 +361,11 @@ func TestStoreDB_Get_Error(t *testing.T) {
 	defer db.Close()
 
 	store := &StoreDB{db: db}
-	mock.ExpectQuery("SELECT original_url, deletedFlag FROM urls WHERE short_id =").
+	mock.ExpectQuery("SELECT original_url, deletedFlag, expires_at FROM urls WHERE short_id =").
 		WithArgs("shortURL").
 		WillReturnError(errors.New("get error"))
 
-	originalURL, err := store.Get("shortURL", "")
+	originalURL, err := store.Get(context.Background(), "shortURL", "")
 	assert.Error(t, err)
 	assert.Empty(t, originalURL)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -198,7 +379,7 @@ func TestStoreDB_PingStore(t *testing.T) {
 	store := &StoreDB{db: db}
 	mock.ExpectPing()
 
-	err = store.PingStore()
+	err = store.PingStore(context.Background())
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -213,21 +394,459 @@ func TestStoreDB_PingStore_Error(t *testing.T) {
 	// Установите ожидание на пинг, который вернет ошибку
 	mock.ExpectPing().WillReturnError(errors.New("ping error"))
 
-	err = store.PingStore()
+	err = store.PingStore(context.Background())
 	assert.Error(t, err)
 	assert.Equal(t, "pinging db-store: ping error", err.Error()) // Проверяем текст ошибки
 	assert.NoError(t, mock.ExpectationsWereMet())                // Проверяем, что все ожидания выполнены
 }
 
-func TestCreateTable(t *testing.T) {
+func TestStoreDB_CreateBatch(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer db.Close()
 
-	mock.ExpectExec("CREATE TABLE IF NOT EXISTS urls").
+	store := &StoreDB{db: db}
+	rows := sqlmock.NewRows([]string{"original_url", "short_id", "conflict"}).
+		AddRow("originalURL1", "shortURL1", false).
+		AddRow("originalURL2", "existing", true)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO urls").
+		WithArgs("userID", "shortURL1", "originalURL1", nil, nil, nil, nil, nil, nil, nil, nil, true, "shortURL2", "originalURL2", nil, nil, nil, nil, nil, nil, nil, nil, true).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	items := []services.BatchItem{
+		{OriginalURL: "originalURL1", ShortURL: "shortURL1"},
+		{OriginalURL: "originalURL2", ShortURL: "shortURL2"},
+	}
+	err = store.CreateBatch(context.Background(), "userID", items)
+	assert.NoError(t, err)
+	assert.Equal(t, services.BatchItem{OriginalURL: "originalURL1", ShortURL: "shortURL1"}, items[0])
+	assert.Equal(t, services.BatchItem{OriginalURL: "originalURL2", ShortURL: "existing", Conflict: true}, items[1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_CreateBatch_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO urls").
+		WithArgs("userID", "shortURL1", "originalURL1", nil, nil, nil, nil, nil, nil, nil, nil, true).
+		WillReturnError(errors.New("insert error"))
+	mock.ExpectRollback()
+
+	err = store.CreateBatch(context.Background(), "userID", []services.BatchItem{
+		{OriginalURL: "originalURL1", ShortURL: "shortURL1"},
+	})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_CreateBatch_Chunks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	items := make([]services.BatchItem, batchChunkSize+1)
+	first := sqlmock.NewRows([]string{"original_url", "short_id", "conflict"})
+	for i := range items {
+		items[i] = services.BatchItem{OriginalURL: fmt.Sprintf("originalURL%d", i), ShortURL: fmt.Sprintf("shortURL%d", i)}
+		if i < batchChunkSize {
+			first.AddRow(items[i].OriginalURL, items[i].ShortURL, false)
+		}
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO urls").WillReturnRows(first)
+	mock.ExpectQuery("INSERT INTO urls").
+		WithArgs("userID", items[batchChunkSize].ShortURL, items[batchChunkSize].OriginalURL, nil, nil, nil, nil, nil, nil, nil, nil, true).
+		WillReturnRows(sqlmock.NewRows([]string{"original_url", "short_id", "conflict"}))
+	mock.ExpectRollback()
+
+	// Ссылка из второй части не вставлена и не найдена: пакет откатывается целиком
+	err = store.CreateBatch(context.Background(), "userID", items)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_Create_ShortIDExists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	mock.ExpectExec("INSERT INTO urls").
+		WithArgs("shortURL", "originalURL", "userID", nil, nil, nil, nil, nil, nil, nil, nil).
+		WillReturnError(&pgconn.PgError{Code: pgerrcode.UniqueViolation, ConstraintName: "urls_short_id_key"})
+
+	err = store.Create(context.Background(), "originalURL", "shortURL", "userID", services.LinkOptions{})
+	assert.ErrorIs(t, err, services.ErrShortIDExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_AddKeys(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	mock.ExpectExec("INSERT INTO short_keys").
+		WithArgs([]string{"k1", "k2"}).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	assert.NoError(t, store.AddKeys(context.Background(), []string{"k1", "k2"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_TakeKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	mock.ExpectQuery("UPDATE short_keys SET taken = true").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("k1").AddRow("k2"))
+
+	keys, err := store.TakeKeys(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_PruneKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	takenBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec("DELETE FROM short_keys\\s+WHERE taken AND \\(taken_at < \\$1 OR EXISTS \\(SELECT 1 FROM urls WHERE short_id = key\\)\\)").
+		WithArgs(takenBefore).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	pruned, err := store.PruneKeys(context.Background(), takenBefore)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pruned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_CountKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	mock.ExpectQuery("SELECT count").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+	count, err := store.CountKeys(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 7, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_PurgeExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	before := time.Now()
+	mock.ExpectExec("DELETE FROM urls WHERE expires_at <").
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	count, err := store.PurgeExpired(context.Background(), before)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_UpdateURL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	columns := []string{"original_url", "userID", "deletedFlag", "expired"}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT original_url, COALESCE\\(userID, ''\\), deletedFlag").
+		WithArgs("shortURL").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("oldURL", "userID", false, false))
+	mock.ExpectExec("UPDATE urls SET original_url =").
+		WithArgs("shortURL", "newURL").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO url_history").
+		WithArgs("shortURL", "oldURL").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = store.UpdateURL(context.Background(), "userID", "shortURL", "newURL")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_UpdateURL_Rejected(t *testing.T) {
+	columns := []string{"original_url", "userID", "deletedFlag", "expired"}
+	tests := []struct {
+		name string
+		rows *sqlmock.Rows
+		want error
+	}{
+		{name: "not found", rows: sqlmock.NewRows(columns), want: services.ErrNotFound},
+		{name: "not owner", rows: sqlmock.NewRows(columns).AddRow("oldURL", "other", false, false), want: services.ErrNotOwner},
+		{name: "deleted", rows: sqlmock.NewRows(columns).AddRow("oldURL", "userID", true, false), want: services.ErrDeleted},
+		{name: "expired", rows: sqlmock.NewRows(columns).AddRow("oldURL", "userID", false, true), want: services.ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			store := &StoreDB{db: db}
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT original_url").WithArgs("shortURL").WillReturnRows(tt.rows)
+			mock.ExpectRollback()
+
+			err = store.UpdateURL(context.Background(), "userID", "shortURL", "newURL")
+			assert.ErrorIs(t, err, tt.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestStoreDB_UpdateURL_Conflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT original_url").
+		WithArgs("shortURL").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url", "userID", "deletedFlag", "expired"}).
+			AddRow("oldURL", "userID", false, false))
+	mock.ExpectExec("UPDATE urls SET original_url =").
+		WithArgs("shortURL", "newURL").
+		WillReturnError(&pgconn.PgError{Code: pgerrcode.UniqueViolation, ConstraintName: "idx_original_url"})
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT short_id FROM urls WHERE original_url =").
+		WithArgs("newURL").
+		WillReturnRows(sqlmock.NewRows([]string{"short_id"}).AddRow("existing"))
+
+	err = store.UpdateURL(context.Background(), "userID", "shortURL", "newURL")
+	var conflict *services.ErrConflict
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "existing", conflict.Existing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStoreDB_History(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	columns := []string{"userID", "original_url", "changed_at"}
+	changedAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT COALESCE\\(urls.userID, ''\\), url_history.original_url").
+		WithArgs("shortURL").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("userID", "first", changedAt).AddRow("userID", "second", changedAt))
+	mock.ExpectQuery("SELECT COALESCE").
+		WithArgs("unchanged").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("userID", nil, nil))
+	mock.ExpectQuery("SELECT COALESCE").
+		WithArgs("foreign").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("other", nil, nil))
+	mock.ExpectQuery("SELECT COALESCE").
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	history, err := store.History(context.Background(), "userID", "shortURL")
+	assert.NoError(t, err)
+	assert.Equal(t, []services.HistoryEntry{{OriginalURL: "first", ChangedAt: changedAt}, {OriginalURL: "second", ChangedAt: changedAt}}, history)
+	history, err = store.History(context.Background(), "userID", "unchanged")
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+	_, err = store.History(context.Background(), "userID", "foreign")
+	assert.ErrorIs(t, err, services.ErrNotOwner)
+	_, err = store.History(context.Background(), "userID", "missing")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	err = createTable(db)
+func TestStoreDB_RestoreURLs(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := &StoreDB{db: db}
+	deletedAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent, old := deletedAfter.Add(time.Hour), deletedAfter.Add(-time.Hour)
+	shortURLs := []string{"restored", "conflict", "expired", "foreign", "active", "missing"}
+	mock.ExpectQuery("SELECT short_id, original_url, COALESCE\\(userID, ''\\), deletedFlag, deleted_at").
+		WithArgs(shortURLs).
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "original_url", "userID", "deletedFlag", "deleted_at"}).
+			AddRow("restored", "url1", "userID", true, recent).
+			AddRow("conflict", "url2", "userID", true, recent).
+			AddRow("expired", "url3", "userID", true, old).
+			AddRow("foreign", "url4", "other", true, recent).
+			AddRow("active", "url5", "userID", false, nil))
+	mock.ExpectExec("UPDATE urls SET deletedFlag = false").
+		WithArgs("restored", "userID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE urls SET deletedFlag = false").
+		WithArgs("conflict", "userID").
+		WillReturnError(&pgconn.PgError{Code: pgerrcode.UniqueViolation, ConstraintName: "idx_original_url"})
+	mock.ExpectQuery("SELECT short_id FROM urls WHERE original_url = \\$1 AND NOT deletedFlag").
+		WithArgs("url2").
+		WillReturnRows(sqlmock.NewRows([]string{"short_id"}).AddRow("existing"))
+
+	items := make([]services.RestoreItem, len(shortURLs))
+	for i, shortURL := range shortURLs {
+		items[i].ShortURL = shortURL
+	}
+	err = store.RestoreURLs(context.Background(), "userID", items, deletedAfter)
 	assert.NoError(t, err)
+	assert.Equal(t, []services.RestoreItem{
+		{ShortURL: "restored", Status: services.RestoreRestored},
+		{ShortURL: "conflict", Status: services.RestoreConflict, Existing: "existing"},
+		{ShortURL: "expired", Status: services.RestoreExpired},
+		{ShortURL: "foreign", Status: services.RestoreNotOwner},
+		{ShortURL: "active", Status: services.RestoreNotDeleted},
+		{ShortURL: "missing", Status: services.RestoreNotFound},
+	}, items)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// openTestDB открывает настоящую базу, заданную переменной DATABASE_DSN, и применяет миграции.
+// Без переменной тест пропускается. База должна быть отдельной тестовой: тесты откатывают схему.
+func openTestDB(t *testing.T) *StoreDB {
+	t.Helper()
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+	store, err := InitDatabase(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestStoreDB_Integration проверяет на настоящей базе откат и повторное применение миграций,
+// а затем создание ссылок поодиночке и пакетом, переходы и постраничный список ссылок.
+func TestStoreDB_Integration(t *testing.T) {
+	store := openTestDB(t)
+	ctx := context.Background()
+
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	reverted, err := store.MigrateDown(len(migrations))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(migrations))
+	applied, err := store.MigrateUp()
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+
+	userID := fmt.Sprintf("it-%d", time.Now().UnixNano())
+	defer store.db.ExecContext(ctx, "DELETE FROM urls WHERE userID = $1", userID)
+	link := func(name string) (string, string) {
+		return userID + "-" + name, "http://example.com/" + userID + "/" + name
+	}
+
+	// Create: повторное сокращение того же URL без параметров возвращает существующую ссылку
+	plainID, plainURL := link("plain")
+	require.NoError(t, store.Create(ctx, plainURL, plainID, userID, services.LinkOptions{}))
+	var conflict *services.ErrConflict
+	err = store.Create(ctx, plainURL, plainID+"-again", userID, services.LinkOptions{})
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, plainID, conflict.Existing)
+	assert.ErrorIs(t, store.Create(ctx, plainURL+"/other", plainID, userID, services.LinkOptions{}), services.ErrShortIDExists)
+
+	// Ссылка с ограничением переходов не участвует в дедупликации
+	limitedID, _ := link("limited")
+	require.NoError(t, store.Create(ctx, plainURL, limitedID, userID, services.LinkOptions{MaxClicks: 1}))
+
+	// CreateBatch: новая ссылка вставляется, а уже сокращённый URL получает существующий идентификатор
+	batchID, batchURL := link("batch")
+	items := []services.BatchItem{
+		{OriginalURL: batchURL, ShortURL: batchID},
+		{OriginalURL: plainURL, ShortURL: plainID + "-batch"},
+	}
+	require.NoError(t, store.CreateBatch(ctx, userID, items))
+	assert.Equal(t, services.BatchItem{OriginalURL: batchURL, ShortURL: batchID}, items[0])
+	assert.Equal(t, services.BatchItem{OriginalURL: plainURL, ShortURL: plainID, Conflict: true}, items[1])
+
+	// Visit: обычная ссылка открывается всегда, ограниченная — пока не исчерпаны переходы
+	for i := 0; i < 2; i++ {
+		target, err := store.Visit(ctx, plainID)
+		require.NoError(t, err)
+		assert.Equal(t, plainURL, target)
+	}
+	target, err := store.Visit(ctx, limitedID)
+	require.NoError(t, err)
+	assert.Equal(t, plainURL, target)
+	_, err = store.Visit(ctx, limitedID)
+	assert.ErrorIs(t, err, services.ErrExhausted)
+	_, err = store.Visit(ctx, userID+"-missing")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+
+	// ListURLs: обход по одной ссылке на странице выдаёт все ссылки пользователя в порядке создания
+	var got []string
+	filter := services.ListFilter{Limit: 1, Status: services.ListAll}
+	for len(got) <= 3 {
+		links, err := store.ListURLs(ctx, userID, filter)
+		require.NoError(t, err)
+		if len(links) == 0 {
+			break
+		}
+		last := links[len(links)-1]
+		got = append(got, last.ShortID)
+		filter.After = &services.ListCursor{CreatedAt: last.CreatedAt, ShortID: last.ShortID}
+	}
+	assert.ElementsMatch(t, []string{plainID, limitedID, batchID}, got)
+}
+
+// TestStoreDB_ListURLs_SessionTimeZone проверяет постраничный обход списка на настоящей базе,
+// когда часовой пояс сессии отличается от UTC.
+func TestStoreDB_ListURLs_SessionTimeZone(t *testing.T) {
+	store := openTestDB(t)
+
+	// Единственное соединение, чтобы часовой пояс действовал на все запросы теста
+	store.db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	_, err := store.db.ExecContext(ctx, "SET TIME ZONE 'Asia/Vladivostok'")
+	require.NoError(t, err)
+
+	userID := fmt.Sprintf("tz-%d", time.Now().UnixNano())
+	defer store.db.ExecContext(ctx, "DELETE FROM urls WHERE userID = $1", userID)
+	var want []string
+	for i := 0; i < 3; i++ {
+		shortID := fmt.Sprintf("%s-%d", userID, i)
+		err = store.Create(ctx, "http://example.com/"+shortID, shortID, userID, services.LinkOptions{})
+		require.NoError(t, err)
+		want = append(want, shortID)
+	}
+
+	var got []string
+	filter := services.ListFilter{Limit: 1, Status: services.ListAll}
+	for len(got) <= len(want) {
+		links, err := store.ListURLs(ctx, userID, filter)
+		require.NoError(t, err)
+		if len(links) == 0 {
+			break
+		}
+		last := links[len(links)-1]
+		got = append(got, last.ShortID)
+		// Курсор, как и у клиента, приходит в UTC
+		filter.After = &services.ListCursor{CreatedAt: last.CreatedAt.UTC(), ShortID: last.ShortID}
+	}
+	assert.Equal(t, want, got)
+}